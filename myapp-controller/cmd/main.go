@@ -1,18 +1,34 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"net/http"
 	"os"
+	"strings"
+	"time"
 
+	uberzap "go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	myappv1 "github.com/example/myapp-controller/pkg/apis/example/v1"
+	"github.com/example/myapp-controller/pkg/config"
+	"github.com/example/myapp-controller/pkg/config/v1alpha1"
 	"github.com/example/myapp-controller/pkg/controller"
+	"github.com/example/myapp-controller/pkg/debug"
+	"github.com/example/myapp-controller/pkg/features"
+	"github.com/example/myapp-controller/pkg/health"
+	"github.com/example/myapp-controller/pkg/logging"
+	"github.com/example/myapp-controller/pkg/metricsauth"
+	"github.com/example/myapp-controller/pkg/tracing"
 )
 
 var (
@@ -26,43 +42,329 @@ func init() {
 }
 
 func main() {
-	var metricsAddr string
-	var enableLeaderElection bool
-	var probeAddr string
-	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
-	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
-	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
+	var configFile string
+	var watchNamespaces string
+	// 命令行参数写入 base，配置文件中出现的字段会覆盖命令行参数
+	base := config.Default()
+	flag.StringVar(&configFile, "config", "",
+		"The path to a ControllerConfig YAML file. Fields set in the file override the corresponding flags. "+
+			"Changes to logLevel and defaults are applied without a restart.")
+	flag.StringVar(&base.Metrics.BindAddress, "metrics-bind-address", base.Metrics.BindAddress,
+		"The address the metric endpoint binds to. Set to \"0\" to disable the metrics server.")
+	flag.BoolVar(&base.Metrics.Secure, "metrics-secure", base.Metrics.Secure,
+		"If set, the metrics endpoint is served securely via HTTPS and requires authentication and authorization. "+
+			"Use --metrics-bind-address=:8443 together with this flag.")
+	flag.StringVar(&base.Metrics.CertDir, "metrics-cert-path", base.Metrics.CertDir,
+		"The directory that contains the metrics server certificate. "+
+			"If empty, a self-signed certificate is generated. Certificates in this directory are reloaded on change.")
+	flag.StringVar(&base.Metrics.CertName, "metrics-cert-name", base.Metrics.CertName, "The name of the metrics server certificate file.")
+	flag.StringVar(&base.Metrics.KeyName, "metrics-cert-key", base.Metrics.KeyName, "The name of the metrics server key file.")
+	flag.BoolVar(&base.Webhook.Enabled, "enable-webhooks", base.Webhook.Enabled,
+		"If set, the webhook server is started and validates MyApps on create and update. "+
+			"Requires a serving certificate and the ValidatingWebhookConfiguration in config/webhook.")
+	flag.IntVar(&base.Webhook.Port, "webhook-port", base.Webhook.Port, "The port the webhook server listens on.")
+	flag.StringVar(&base.Webhook.CertDir, "webhook-cert-path", base.Webhook.CertDir,
+		"The directory that contains the webhook server certificate. "+
+			"If empty, the controller-runtime default <temp-dir>/k8s-webhook-server/serving-certs is used.")
+	flag.StringVar(&base.Webhook.CertName, "webhook-cert-name", base.Webhook.CertName, "The name of the webhook server certificate file.")
+	flag.StringVar(&base.Webhook.KeyName, "webhook-cert-key", base.Webhook.KeyName, "The name of the webhook server key file.")
+	flag.StringVar(&base.Health.BindAddress, "health-probe-bind-address", base.Health.BindAddress, "The address the probe endpoint binds to.")
+	flag.StringVar(&base.Pprof.BindAddress, "pprof-bind-address", base.Pprof.BindAddress,
+		"The address the pprof endpoint binds to, e.g. \"localhost:6060\". The endpoint is disabled if empty or \"0\".")
+	flag.BoolVar(&base.LeaderElection.Enabled, "leader-elect", base.LeaderElection.Enabled,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
-	opts := zap.Options{
-		Development: true,
-	}
+	flag.StringVar(&base.LeaderElection.Namespace, "leader-election-namespace", base.LeaderElection.Namespace,
+		"The namespace in which the leader election lease is created. Defaults to the namespace the controller runs in.")
+	flag.DurationVar(&base.LeaderElection.LeaseDuration.Duration, "leader-election-lease-duration", base.LeaderElection.LeaseDuration.Duration,
+		"The duration that non-leader candidates will wait to force acquire leadership.")
+	flag.DurationVar(&base.LeaderElection.RenewDeadline.Duration, "leader-election-renew-deadline", base.LeaderElection.RenewDeadline.Duration,
+		"The duration that the acting leader will retry refreshing leadership before giving up.")
+	flag.DurationVar(&base.LeaderElection.RetryPeriod.Duration, "leader-election-retry-period", base.LeaderElection.RetryPeriod.Duration,
+		"The duration the leader election clients should wait between tries of actions.")
+	flag.BoolVar(&base.LeaderElection.ReleaseOnCancel, "leader-election-release-on-cancel", base.LeaderElection.ReleaseOnCancel,
+		"If set, the leader steps down voluntarily when the manager is stopped, "+
+			"so a standby replica can take over without waiting for the lease to expire.")
+	flag.IntVar(&base.Controller.MaxConcurrentReconciles, "max-concurrent-reconciles", base.Controller.MaxConcurrentReconciles,
+		"The maximum number of MyApp reconciles that can run concurrently.")
+	flag.DurationVar(&base.Controller.RateLimiter.BaseDelay.Duration, "rate-limiter-base-delay", base.Controller.RateLimiter.BaseDelay.Duration,
+		"The initial per-item backoff delay when a MyApp reconcile fails.")
+	flag.DurationVar(&base.Controller.RateLimiter.MaxDelay.Duration, "rate-limiter-max-delay", base.Controller.RateLimiter.MaxDelay.Duration,
+		"The maximum per-item backoff delay when a MyApp reconcile fails.")
+	flag.Float64Var(&base.Controller.RateLimiter.QPS, "rate-limiter-qps", base.Controller.RateLimiter.QPS,
+		"The overall token bucket rate (requeues per second) shared by all MyApps.")
+	flag.IntVar(&base.Controller.RateLimiter.Burst, "rate-limiter-burst", base.Controller.RateLimiter.Burst,
+		"The overall token bucket size shared by all MyApps.")
+	flag.StringVar(&watchNamespaces, "watch-namespaces", "",
+		"Comma-separated list of namespaces to watch. If empty, all namespaces are watched.")
+	flag.StringVar(&base.ShardSelector, "shard-selector", base.ShardSelector,
+		"Label selector restricting which MyApps this instance reconciles, e.g. \"myapp.example.com/shard=0\". "+
+			"Run several instances with disjoint selectors to split MyApps between them.")
+	flag.StringVar(&base.Defaults.ImageRegistry, "default-image-registry", base.Defaults.ImageRegistry,
+		"The registry prepended to MyApp images that do not specify one, e.g. \"registry.example.com/library\".")
+	flag.StringVar(&base.Defaults.SecurityProfile, "default-security-profile", base.Defaults.SecurityProfile,
+		"The security profile applied to MyApp fields not set in spec.security: \"none\" or \"hardened\".")
+	flag.StringVar(&base.Tracing.Endpoint, "tracing-endpoint", base.Tracing.Endpoint,
+		"The OTLP gRPC endpoint traces are exported to, e.g. \"otel-collector.observability:4317\". Tracing is disabled if empty.")
+	flag.BoolVar(&base.Tracing.Insecure, "tracing-insecure", base.Tracing.Insecure,
+		"If set, traces are exported over a plaintext connection.")
+	flag.Float64Var(&base.Tracing.SamplingRatio, "tracing-sampling-ratio", base.Tracing.SamplingRatio,
+		"The fraction of new traces that are sampled, between 0 and 1.")
+	featureGate := features.NewFeatureGate()
+	flag.Func("feature-gates",
+		"A set of key=value pairs that enable or disable features, e.g. \"ServerSideApply=true\". Options are:\n"+
+			strings.Join(featureGate.KnownFeatures(), "\n"),
+		func(value string) error {
+			gates, err := features.ParseFeatureGates(value)
+			if err != nil {
+				return err
+			}
+			if base.FeatureGates == nil {
+				base.FeatureGates = map[string]bool{}
+			}
+			for name, enabled := range gates {
+				base.FeatureGates[name] = enabled
+			}
+			return nil
+		})
+	flag.IntVar(&base.LogSampling.Initial, "log-sampling-initial", base.LogSampling.Initial,
+		"The number of debug and info log entries with the same message logged per second before sampling starts. Set to 0 to disable sampling.")
+	flag.IntVar(&base.LogSampling.Thereafter, "log-sampling-thereafter", base.LogSampling.Thereafter,
+		"After the initial entries, only every Nth debug or info entry with the same message is logged within the same second.")
+	// 默认输出 JSON 日志，开发时可以使用 --zap-devel 或 --zap-encoder=console
+	opts := zap.Options{}
 	opts.BindFlags(flag.CommandLine)
 	flag.Parse()
+	base.WatchNamespaces = controller.ParseNamespaces(watchNamespaces)
+
+	cfg := base
+	var cfgErr error
+	if configFile != "" {
+		if loaded, err := config.Load(configFile, base); err != nil {
+			cfgErr = err
+		} else {
+			cfg = loaded
+		}
+	} else {
+		cfgErr = config.Validate(cfg)
+	}
+
+	// 使用可修改的日志级别，以便配置文件中的 logLevel 可以热加载
+	logLevel := uberzap.NewAtomicLevelAt(zapcore.InfoLevel)
+	if opts.Development {
+		logLevel.SetLevel(zapcore.DebugLevel)
+	}
+	if l, ok := opts.Level.(uberzap.AtomicLevel); ok {
+		logLevel = l
+	}
+	if cfgErr == nil && cfg.LogLevel != "" {
+		// 已通过校验，不会出错
+		level, _ := config.ParseLogLevel(cfg.LogLevel)
+		logLevel.SetLevel(level)
+	}
+	ctrl.SetLogger(logging.New(logging.Options{
+		Zap:                opts,
+		Level:              logLevel,
+		SamplingInitial:    cfg.LogSampling.Initial,
+		SamplingThereafter: cfg.LogSampling.Thereafter,
+	}))
+
+	if cfgErr != nil {
+		setupLog.Error(cfgErr, "invalid configuration")
+		os.Exit(1)
+	}
+	if configFile != "" {
+		setupLog.Info("loaded config file", "path", configFile)
+	}
 
-	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
+	// 已通过校验，不会出错
+	_ = featureGate.SetFromMap(cfg.FeatureGates)
+	featureGate.RecordMetrics()
+	setupLog.Info("feature gates", "gates", featureGate.String())
 
+	defaults := &controller.RuntimeDefaults{}
+	defaults.SetImageRegistry(cfg.Defaults.ImageRegistry)
+	defaults.SetSecurityProfile(cfg.Defaults.SecurityProfile)
+
+	ctx := ctrl.SetupSignalHandler()
+	shutdownTracing := func(context.Context) error { return nil }
+	if cfg.Tracing.Endpoint != "" {
+		shutdown, err := tracing.Setup(ctx, tracing.Options{
+			Endpoint:      cfg.Tracing.Endpoint,
+			Insecure:      cfg.Tracing.Insecure,
+			SamplingRatio: cfg.Tracing.SamplingRatio,
+			ServiceName:   "myapp-controller",
+		})
+		if err != nil {
+			setupLog.Error(err, "unable to set up tracing")
+			os.Exit(1)
+		}
+		shutdownTracing = shutdown
+		setupLog.Info("exporting traces", "endpoint", cfg.Tracing.Endpoint, "samplingRatio", cfg.Tracing.SamplingRatio)
+	}
+
+	metricsServerOptions := metricsserver.Options{
+		BindAddress:   cfg.Metrics.BindAddress,
+		SecureServing: cfg.Metrics.Secure,
+	}
+	if cfg.Metrics.Secure {
+		// 通过 TokenReview 和 SubjectAccessReview 对访问指标的请求进行认证和鉴权
+		metricsServerOptions.FilterProvider = metricsauth.WithAuthenticationAndAuthorization
+		if cfg.Metrics.CertDir != "" {
+			// 证书目录中的文件变化时会被 certwatcher 自动重新加载
+			setupLog.Info("using certificates for the metrics server", "path", cfg.Metrics.CertDir,
+				"cert", cfg.Metrics.CertName, "key", cfg.Metrics.KeyName)
+			metricsServerOptions.CertDir = cfg.Metrics.CertDir
+			metricsServerOptions.CertName = cfg.Metrics.CertName
+			metricsServerOptions.KeyName = cfg.Metrics.KeyName
+		}
+	}
+
+	cacheOptions, err := controller.CacheOptions(cfg.WatchNamespaces, cfg.ShardSelector)
+	if err != nil {
+		setupLog.Error(err, "unable to build cache options")
+		os.Exit(1)
+	}
+	if len(cfg.WatchNamespaces) > 0 {
+		setupLog.Info("watching namespaces", "namespaces", cfg.WatchNamespaces)
+	}
+	if cfg.ShardSelector != "" {
+		setupLog.Info("reconciling MyApp shard", "selector", cfg.ShardSelector)
+	}
+
+	// 未开启 webhook 时 manager 不会启动 webhook server
+	webhookServer := webhook.NewServer(webhook.Options{
+		Port:     cfg.Webhook.Port,
+		CertDir:  cfg.Webhook.CertDir,
+		CertName: cfg.Webhook.CertName,
+		KeyName:  cfg.Webhook.KeyName,
+	})
+
+	leaderElectionID := controller.LeaderElectionID("myapp-controller-leader", cfg.ShardSelector)
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                 scheme,
-		Metrics:                ctrl.Options{}.Metrics,
-		WebhookServer:          ctrl.Options{}.WebhookServer,
-		HealthProbeBindAddress: probeAddr,
-		LeaderElection:         enableLeaderElection,
-		LeaderElectionID:       "myapp-controller-leader",
+		Cache:                  cacheOptions,
+		Metrics:                metricsServerOptions,
+		WebhookServer:          webhookServer,
+		HealthProbeBindAddress: cfg.Health.BindAddress,
+		PprofBindAddress:       cfg.Pprof.BindAddress,
+		LeaderElection:         cfg.LeaderElection.Enabled,
+		LeaderElectionID:       leaderElectionID,
+		// 进程在 mgr.Start 返回后立即退出，因此可以安全地在停止时主动释放 Lease
+		LeaderElectionReleaseOnCancel: cfg.LeaderElection.ReleaseOnCancel,
+		LeaderElectionNamespace:       cfg.LeaderElection.Namespace,
+		LeaseDuration:                 &cfg.LeaderElection.LeaseDuration.Duration,
+		RenewDeadline:                 &cfg.LeaderElection.RenewDeadline.Duration,
+		RetryPeriod:                   &cfg.LeaderElection.RetryPeriod.Duration,
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
+	if cfg.Pprof.BindAddress != "" && cfg.Pprof.BindAddress != "0" {
+		setupLog.Info("serving pprof", "address", cfg.Pprof.BindAddress)
+	}
+
+	// /debug/cache 和 /debug/queue 与 /metrics 使用同一个端口和同样的认证鉴权
+	queueTracker := debug.NewQueueTracker()
+	debugHandlers := map[string]http.Handler{
+		debug.CachePath: debug.CacheHandler(mgr.GetCache(), mgr.GetScheme(), mgr.Elected(),
+			controller.CachedLists(featureGate)...),
+		debug.QueuePath: debug.QueueHandler(queueTracker),
+	}
+	if cfg.Metrics.BindAddress != "0" {
+		for path, handler := range debugHandlers {
+			if err := mgr.AddMetricsServerExtraHandler(path, handler); err != nil {
+				setupLog.Error(err, "unable to set up debug endpoint", "path", path)
+				os.Exit(1)
+			}
+		}
+	}
+
+	reconcilerClient := mgr.GetClient()
+	if cfg.Tracing.Endpoint != "" {
+		// 每个 API 调用记录为 Reconcile span 的子 span
+		reconcilerClient = tracing.WrapClient(reconcilerClient)
+	}
 	if err = (&controller.MyAppReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:    reconcilerClient,
+		Scheme:    mgr.GetScheme(),
+		APIReader: mgr.GetAPIReader(),
+		Options: controller.Options{
+			MaxConcurrentReconciles: cfg.Controller.MaxConcurrentReconciles,
+			BaseDelay:               cfg.Controller.RateLimiter.BaseDelay.Duration,
+			MaxDelay:                cfg.Controller.RateLimiter.MaxDelay.Duration,
+			QPS:                     cfg.Controller.RateLimiter.QPS,
+			Burst:                   cfg.Controller.RateLimiter.Burst,
+		},
+		Defaults: defaults,
+		Features: featureGate,
+		Queue:    queueTracker,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "MyApp")
 		os.Exit(1)
 	}
 
+	if featureGate.Enabled(features.MyAppSet) {
+		// MyAppSet 是集群级别的资源，生成的 MyApp 可以位于任意命名空间
+		if len(cfg.WatchNamespaces) > 0 {
+			setupLog.Error(nil, "the MyAppSet feature requires watching all namespaces", "namespaces", cfg.WatchNamespaces)
+			os.Exit(1)
+		}
+		// 分片的缓存只包含本分片的 MyApp，MyAppSet 看不到其他分片中生成的 MyApp，
+		// 会重复创建或漏删它们，并且每个分片的 leader 都会协调同一个 MyAppSet
+		if cfg.ShardSelector != "" {
+			setupLog.Error(nil, "the MyAppSet feature cannot be used with a shard selector", "selector", cfg.ShardSelector)
+			os.Exit(1)
+		}
+		if err = (&controller.MyAppSetReconciler{
+			Client: reconcilerClient,
+			Scheme: mgr.GetScheme(),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "MyAppSet")
+			os.Exit(1)
+		}
+	}
+
+	if cfg.Webhook.Enabled {
+		if err = (&controller.MyAppValidator{
+			Client:    mgr.GetClient(),
+			APIReader: mgr.GetAPIReader(),
+			Defaults:  defaults,
+			Features:  featureGate,
+		}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "MyApp")
+			os.Exit(1)
+		}
+		// 证书加载完成、webhook server 开始监听之前不接收 apiserver 的准入请求
+		if err := mgr.AddReadyzCheck("webhook", mgr.GetWebhookServer().StartedChecker()); err != nil {
+			setupLog.Error(err, "unable to set up webhook ready check")
+			os.Exit(1)
+		}
+		setupLog.Info("serving webhooks", "port", cfg.Webhook.Port)
+	}
+
+	if configFile != "" {
+		// 配置文件变化时热加载日志级别和 MyApp 默认值
+		watcher := config.NewWatcher(configFile, base, cfg, func(updated *v1alpha1.ControllerConfig) {
+			level := zapcore.InfoLevel
+			if opts.Development {
+				level = zapcore.DebugLevel
+			}
+			if updated.LogLevel != "" {
+				level, _ = config.ParseLogLevel(updated.LogLevel)
+			}
+			logLevel.SetLevel(level)
+			defaults.SetImageRegistry(updated.Defaults.ImageRegistry)
+			defaults.SetSecurityProfile(updated.Defaults.SecurityProfile)
+		})
+		if err := mgr.Add(watcher); err != nil {
+			setupLog.Error(err, "unable to set up config watcher")
+			os.Exit(1)
+		}
+	}
+
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
@@ -71,9 +373,28 @@ func main() {
 		setupLog.Error(err, "unable to set up ready check")
 		os.Exit(1)
 	}
+	// /readyz/leader 报告当前实例是否为 leader
+	if err := mgr.AddReadyzCheck("leader", health.LeaderCheck(mgr.Elected())); err != nil {
+		setupLog.Error(err, "unable to set up leader check")
+		os.Exit(1)
+	}
+
+	if cfg.LeaderElection.Enabled {
+		go func() {
+			<-mgr.Elected()
+			setupLog.Info("acquired leadership", "lease", leaderElectionID)
+		}()
+	}
 
 	setupLog.Info("starting manager")
-	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+	err = mgr.Start(ctx)
+	// 导出尚未发送的 span
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if shutdownErr := shutdownTracing(shutdownCtx); shutdownErr != nil {
+		setupLog.Error(shutdownErr, "failed to flush traces")
+	}
+	if err != nil {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
@@ -0,0 +1,65 @@
+package v1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// MyAppClassSpec 定义 MyAppClass 的默认值和限制
+type MyAppClassSpec struct {
+	// Defaults MyApp 未设置的字段使用的默认值
+	Defaults MyAppClassDefaults `json:"defaults,omitempty"`
+	// Limits MyApp 应用默认值之后必须满足的限制
+	Limits MyAppClassLimits `json:"limits,omitempty"`
+}
+
+// MyAppClassDefaults 是 MyApp 未设置的字段使用的默认值，MyApp 中设置的字段优先
+type MyAppClassDefaults struct {
+	// Resources 主容器未设置 spec.resources 时使用的资源请求和限制
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+	// ReadinessProbe 主容器未设置 spec.readinessProbe 时使用的就绪探针
+	ReadinessProbe *corev1.Probe `json:"readinessProbe,omitempty"`
+	// LivenessProbe 主容器未设置 spec.livenessProbe 时使用的存活探针
+	LivenessProbe *corev1.Probe `json:"livenessProbe,omitempty"`
+	// Security 逐个字段作为 spec.security 的默认值，优先于控制器的默认安全配置档
+	Security *SecuritySpec `json:"security,omitempty"`
+	// NodeSelector MyApp 未设置 spec.nodeSelector 时使用的节点选择器
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// Tolerations MyApp 未设置 spec.tolerations 时使用的容忍
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+	// PriorityClassName MyApp 未设置 spec.priorityClassName 时使用的 PriorityClass
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+}
+
+// MyAppClassLimits 是 MyApp 的硬性限制，超出限制的 MyApp 被 webhook 拒绝，已存在的进入 Failed
+type MyAppClassLimits struct {
+	// MaxReplicas 副本数上限
+	MaxReplicas *int32 `json:"maxReplicas,omitempty"`
+	// MaxResources 每个容器（包括 sidecar 和 init 容器）的资源请求和限制的上限
+	MaxResources corev1.ResourceList `json:"maxResources,omitempty"`
+}
+
+// +genclient
+// +genclient:nonNamespaced
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+
+// MyAppClass 是集群级别的 MyApp 默认值和限制，类似 StorageClass。
+// MyApp 通过 spec.className 引用，未引用时使用默认的 MyAppClass
+type MyAppClass struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec MyAppClassSpec `json:"spec,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:object:root=true
+
+// MyAppClassList 包含 MyAppClass 的列表
+type MyAppClassList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MyAppClass `json:"items"`
+}
@@ -0,0 +1,49 @@
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// MyAppPolicySpec 定义命名空间中所有 MyApp 必须满足的规则
+type MyAppPolicySpec struct {
+	// Images 镜像仓库的允许和拒绝规则
+	Images ImagePolicy `json:"images,omitempty"`
+	// MaxReplicasPerApp 单个 MyApp 的副本数上限
+	MaxReplicasPerApp *int32 `json:"maxReplicasPerApp,omitempty"`
+	// MaxReplicasPerNamespace 命名空间中所有 MyApp 的副本数之和的上限
+	MaxReplicasPerNamespace *int32 `json:"maxReplicasPerNamespace,omitempty"`
+	// RequiredLabels MyApp 必须带有的标签键
+	RequiredLabels []string `json:"requiredLabels,omitempty"`
+}
+
+// ImagePolicy 限制 MyApp 中所有容器（包括 sidecar、init 容器和钩子 Job）使用的镜像。
+// 规则匹配镜像仓库地址或仓库路径的前缀，例如 registry.example.com、registry.example.com/team-a，
+// 支持 path.Match 的通配符，例如 *.corp.example.com。没有仓库地址的镜像视为 docker.io 的镜像
+type ImagePolicy struct {
+	// AllowedRegistries 允许的镜像仓库，为空时允许所有仓库
+	AllowedRegistries []string `json:"allowedRegistries,omitempty"`
+	// DeniedRegistries 拒绝的镜像仓库，优先于 AllowedRegistries
+	DeniedRegistries []string `json:"deniedRegistries,omitempty"`
+}
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:object:root=true
+
+// MyAppPolicy 是命名空间级别的 MyApp 规则，命名空间中的所有 MyApp 必须同时满足该命名空间中的所有 MyAppPolicy
+type MyAppPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec MyAppPolicySpec `json:"spec,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:object:root=true
+
+// MyAppPolicyList 包含 MyAppPolicy 的列表
+type MyAppPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MyAppPolicy `json:"items"`
+}
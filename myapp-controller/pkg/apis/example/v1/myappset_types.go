@@ -0,0 +1,109 @@
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// MyAppSetSpec 定义 MyAppSet 的期望状态
+type MyAppSetSpec struct {
+	// Generators 生成参数的生成器，所有生成器产生的参数合并在一起，每组参数生成一个 MyApp
+	Generators []MyAppSetGenerator `json:"generators"`
+	// Template 生成 MyApp 的模板，字符串字段中的 {{key}} 会被替换为参数 key 的值
+	Template MyAppTemplate `json:"template"`
+	// Strategy 模板变化时更新已生成的 MyApp 的策略
+	Strategy MyAppSetStrategy `json:"strategy,omitempty"`
+}
+
+// MyAppSetGenerator 生成一组参数，list、namespaces 和 matrix 只能设置一个
+type MyAppSetGenerator struct {
+	ParameterGenerator `json:",inline"`
+	// Matrix 子生成器参数的笛卡尔积，每组参数合并了每个子生成器的一组参数
+	Matrix []ParameterGenerator `json:"matrix,omitempty"`
+}
+
+// ParameterGenerator 是可以在 matrix 中组合的生成器，list 和 namespaces 只能设置一个
+type ParameterGenerator struct {
+	// List 静态的参数列表
+	List []map[string]string `json:"list,omitempty"`
+	// Namespaces 为每个匹配的命名空间生成一组参数：namespace 为命名空间名称，
+	// label.<key> 为命名空间上的标签
+	Namespaces *NamespaceGenerator `json:"namespaces,omitempty"`
+}
+
+// NamespaceGenerator 按标签选择命名空间
+type NamespaceGenerator struct {
+	// Selector 命名空间的标签选择器，为空时选择所有命名空间
+	Selector metav1.LabelSelector `json:"selector"`
+}
+
+// MyAppTemplate 是生成 MyApp 的模板
+type MyAppTemplate struct {
+	// Metadata 生成的 MyApp 的名称、命名空间、标签和注解
+	Metadata MyAppTemplateMeta `json:"metadata"`
+	// Spec 生成的 MyApp 的规格
+	Spec MyAppSpec `json:"spec"`
+}
+
+// MyAppTemplateMeta 是生成的 MyApp 的元数据
+type MyAppTemplateMeta struct {
+	// Name MyApp 名称，必须引用参数以区分不同的 MyApp，例如 shop-{{tenant}}
+	Name string `json:"name"`
+	// Namespace MyApp 所在的命名空间，例如 {{namespace}}
+	Namespace string `json:"namespace"`
+	// Labels 添加到 MyApp 上的标签
+	Labels map[string]string `json:"labels,omitempty"`
+	// Annotations 添加到 MyApp 上的注解
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// MyAppSetStrategy 定义更新已生成的 MyApp 的策略
+type MyAppSetStrategy struct {
+	// MaxUnavailable 更新时最多允许多少个 MyApp 不处于 Running，默认 1。
+	// 新生成的 MyApp 和已经不处于 Running 的 MyApp 不受限制
+	MaxUnavailable int32 `json:"maxUnavailable,omitempty"`
+}
+
+// MyAppSetStatus 汇总生成的 MyApp 的状态
+type MyAppSetStatus struct {
+	// ObservedGeneration 最近一次处理的 MyAppSet 的 generation
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Phase Running 表示所有 MyApp 都已更新到当前模板并处于 Running
+	Phase string `json:"phase,omitempty"`
+	// Message 状态消息
+	Message string `json:"message,omitempty"`
+	// Apps 生成的 MyApp 数量
+	Apps int32 `json:"apps"`
+	// UpdatedApps 已更新到当前模板的 MyApp 数量
+	UpdatedApps int32 `json:"updatedApps"`
+	// ReadyApps 处于 Running 的 MyApp 数量
+	ReadyApps int32 `json:"readyApps"`
+	// FailedApps 处于 Failed 的 MyApp 数量
+	FailedApps int32 `json:"failedApps"`
+}
+
+// +genclient
+// +genclient:nonNamespaced
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:subresource:status
+
+// MyAppSet 根据生成器产生的参数为每个租户等生成一个 MyApp。
+// MyAppSet 是集群级别的资源，生成的 MyApp 可以位于不同的命名空间
+type MyAppSet struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   MyAppSetSpec   `json:"spec,omitempty"`
+	Status MyAppSetStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:object:root=true
+
+// MyAppSetList 包含 MyAppSet 的列表
+type MyAppSetList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MyAppSet `json:"items"`
+}
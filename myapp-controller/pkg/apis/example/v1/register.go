@@ -31,6 +31,12 @@ func addKnownTypes(scheme *runtime.Scheme) error {
 	scheme.AddKnownTypes(SchemeGroupVersion,
 		&MyApp{},
 		&MyAppList{},
+		&MyAppClass{},
+		&MyAppClassList{},
+		&MyAppPolicy{},
+		&MyAppPolicyList{},
+		&MyAppSet{},
+		&MyAppSetList{},
 	)
 	metav1.AddToGroupVersion(scheme, SchemeGroupVersion)
 	return nil
@@ -1,6 +1,11 @@
 package v1
 
 import (
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -17,6 +22,180 @@ type MyAppSpec struct {
 	Replicas int32 `json:"replicas"`
 	// Port 服务端口
 	Port int32 `json:"port"`
+	// Resources 主容器的资源请求和限制，未设置时使用 MyAppClass 的默认值
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+	// ReadinessProbe 主容器的就绪探针，未设置时使用 MyAppClass 的默认值
+	ReadinessProbe *corev1.Probe `json:"readinessProbe,omitempty"`
+	// LivenessProbe 主容器的存活探针，未设置时使用 MyAppClass 的默认值
+	LivenessProbe *corev1.Probe `json:"livenessProbe,omitempty"`
+	// VolumeMounts 主容器挂载的共享卷
+	VolumeMounts []corev1.VolumeMount `json:"volumeMounts,omitempty"`
+	// Sidecars 与主容器一起运行的辅助容器，例如日志收集或代理
+	Sidecars []Container `json:"sidecars,omitempty"`
+	// InitContainers 在主容器启动前依次运行完成的容器，例如数据库迁移
+	InitContainers []Container `json:"initContainers,omitempty"`
+	// Volumes 容器之间共享的卷
+	Volumes []SharedVolume `json:"volumes,omitempty"`
+	// Hooks 发布新版本前后运行的 Job
+	Hooks *Hooks `json:"hooks,omitempty"`
+	// NodeSelector 限定 Pod 只能调度到带有这些标签的节点
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// Tolerations 允许 Pod 调度到带有相应污点的节点
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+	// Affinity 节点亲和性以及 Pod 亲和性和反亲和性
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+	// PriorityClassName Pod 使用的 PriorityClass
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+	// RuntimeClassName Pod 使用的 RuntimeClass，例如 gVisor 或 Kata
+	RuntimeClassName *string `json:"runtimeClassName,omitempty"`
+	// Security Pod 和所有容器的安全配置，未设置的字段使用控制器的默认安全配置档
+	Security *SecuritySpec `json:"security,omitempty"`
+	// ServiceAccount 设置后控制器为 MyApp 创建同名的 ServiceAccount，未设置时 Pod 使用命名空间的 default
+	ServiceAccount *ServiceAccountSpec `json:"serviceAccount,omitempty"`
+	// NetworkPolicy 设置后控制器为 MyApp 创建同名的 NetworkPolicy，只放行声明的入站和出站流量
+	NetworkPolicy *NetworkPolicySpec `json:"networkPolicy,omitempty"`
+	// DependsOn 该 MyApp 依赖的其他 MyApp，依赖全部处于 Running 之前不发布新版本
+	DependsOn []Dependency `json:"dependsOn,omitempty"`
+	// ClassName 使用的 MyAppClass，为空时使用默认的 MyAppClass
+	ClassName string `json:"className,omitempty"`
+}
+
+// Dependency 引用另一个 MyApp
+type Dependency struct {
+	// Name MyApp 名称
+	Name string `json:"name"`
+	// Namespace MyApp 所在的命名空间，默认与依赖方相同
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// NetworkPolicySpec 定义 MyApp 的 Pod 允许的流量，对端通过其他 MyApp 的 app 标签、命名空间或 IP 地址段指定
+type NetworkPolicySpec struct {
+	// Ingress 允许访问 Pod 的来源，只放行主容器端口和 sidecar 暴露的端口。为空时拒绝所有入站流量
+	Ingress []NetworkPeer `json:"ingress,omitempty"`
+	// Egress 允许 Pod 访问的目标，非空时拒绝其他出站流量（DNS 除外）。为空时不限制出站流量
+	Egress []NetworkEgressRule `json:"egress,omitempty"`
+}
+
+// NetworkPeer 定义流量的对端。Apps 和 Namespaces 同时设置时表示这些命名空间中的这些 MyApp，
+// CIDRs 与前两者是或的关系
+type NetworkPeer struct {
+	// Apps MyApp 名称，未设置 Namespaces 时表示同一命名空间中的 MyApp
+	Apps []string `json:"apps,omitempty"`
+	// Namespaces 命名空间名称，未设置 Apps 时表示这些命名空间中的所有 Pod
+	Namespaces []string `json:"namespaces,omitempty"`
+	// CIDRs IP 地址段，例如集群外的数据库
+	CIDRs []string `json:"cidrs,omitempty"`
+}
+
+// NetworkEgressRule 定义允许访问的目标及端口
+type NetworkEgressRule struct {
+	NetworkPeer `json:",inline"`
+	// Ports 目标端口，为空时允许所有端口
+	Ports []networkingv1.NetworkPolicyPort `json:"ports,omitempty"`
+}
+
+// ServiceAccountSpec 定义控制器为 MyApp 创建的 ServiceAccount 及其权限
+type ServiceAccountSpec struct {
+	// Annotations 添加到 ServiceAccount 上的注解，例如云厂商的工作负载身份
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Rules 授予 ServiceAccount 的命名空间内权限，非空时创建同名的 Role 和 RoleBinding。
+	// 控制器自身必须持有这些权限
+	Rules []rbacv1.PolicyRule `json:"rules,omitempty"`
+}
+
+// SecuritySpec 定义 Pod 的安全配置，容器级别的字段应用到主容器、sidecar 和 init 容器
+type SecuritySpec struct {
+	// RunAsNonRoot 要求容器以非 root 用户运行
+	RunAsNonRoot *bool `json:"runAsNonRoot,omitempty"`
+	// RunAsUser 容器进程的 UID
+	RunAsUser *int64 `json:"runAsUser,omitempty"`
+	// RunAsGroup 容器进程的 GID
+	RunAsGroup *int64 `json:"runAsGroup,omitempty"`
+	// FSGroup 卷的属组
+	FSGroup *int64 `json:"fsGroup,omitempty"`
+	// ReadOnlyRootFilesystem 容器的根文件系统是否只读，需要写入的目录可以挂载 spec.volumes 中的 emptyDir
+	ReadOnlyRootFilesystem *bool `json:"readOnlyRootFilesystem,omitempty"`
+	// AllowPrivilegeEscalation 是否允许进程获得比父进程更多的权限
+	AllowPrivilegeEscalation *bool `json:"allowPrivilegeEscalation,omitempty"`
+	// Capabilities 容器增加和去掉的 Linux capabilities，设置后整体替换默认值
+	Capabilities *corev1.Capabilities `json:"capabilities,omitempty"`
+	// SeccompProfile Pod 使用的 seccomp 配置
+	SeccompProfile *corev1.SeccompProfile `json:"seccompProfile,omitempty"`
+	// AutomountServiceAccountToken 是否挂载 ServiceAccount 的令牌
+	AutomountServiceAccountToken *bool `json:"automountServiceAccountToken,omitempty"`
+}
+
+// Hooks 定义发布前后运行的 Job，Pod 模板变化（例如更换镜像）时视为新版本
+type Hooks struct {
+	// PreDeploy 在新版本应用到 Deployment 之前运行，例如数据库迁移。
+	// 运行期间发布被阻塞，失败时中止该版本的发布
+	PreDeploy *batchv1.JobSpec `json:"preDeploy,omitempty"`
+	// PostDeploy 在新版本的所有副本就绪后运行，例如冒烟测试，失败时 MyApp 进入 Failed 状态
+	PostDeploy *batchv1.JobSpec `json:"postDeploy,omitempty"`
+}
+
+// HookType 是钩子的类型
+type HookType string
+
+const (
+	// HookPreDeploy 发布前运行的钩子
+	HookPreDeploy HookType = "PreDeploy"
+	// HookPostDeploy 发布后运行的钩子
+	HookPostDeploy HookType = "PostDeploy"
+)
+
+// HookPhase 是钩子 Job 的运行阶段
+type HookPhase string
+
+const (
+	// HookRunning Job 正在运行
+	HookRunning HookPhase = "Running"
+	// HookSucceeded Job 已成功完成
+	HookSucceeded HookPhase = "Succeeded"
+	// HookFailed Job 已失败
+	HookFailed HookPhase = "Failed"
+)
+
+// Container 定义 sidecar 或 init 容器
+type Container struct {
+	// Name 容器名称，在 Pod 内唯一，不能为 app
+	Name string `json:"name"`
+	// Image 容器镜像
+	Image string `json:"image"`
+	// Command 覆盖镜像的 ENTRYPOINT
+	Command []string `json:"command,omitempty"`
+	// Args 覆盖镜像的 CMD
+	Args []string `json:"args,omitempty"`
+	// Env 环境变量
+	Env []corev1.EnvVar `json:"env,omitempty"`
+	// Ports 容器端口，init 容器的端口不会被 Service 暴露
+	Ports []ContainerPort `json:"ports,omitempty"`
+	// Resources 资源请求和限制
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+	// VolumeMounts 挂载的共享卷
+	VolumeMounts []corev1.VolumeMount `json:"volumeMounts,omitempty"`
+}
+
+// ContainerPort 定义容器端口
+type ContainerPort struct {
+	// Name 端口名称，为空或与其他端口重名时由控制器生成唯一的名称
+	Name string `json:"name,omitempty"`
+	// ContainerPort 容器监听的端口
+	ContainerPort int32 `json:"containerPort"`
+	// Protocol 协议，默认 TCP
+	Protocol corev1.Protocol `json:"protocol,omitempty"`
+	// Expose 为 true 时在 MyApp 的 Service 上以相同的端口号暴露该端口
+	Expose bool `json:"expose,omitempty"`
+}
+
+// SharedVolume 定义容器之间共享的 emptyDir 卷
+type SharedVolume struct {
+	// Name 卷名称，容器通过 volumeMounts 引用
+	Name string `json:"name"`
+	// Medium 存储介质，Memory 表示使用 tmpfs
+	Medium corev1.StorageMedium `json:"medium,omitempty"`
+	// SizeLimit 卷的容量上限
+	SizeLimit *resource.Quantity `json:"sizeLimit,omitempty"`
 }
 
 // MyAppStatus 定义 MyApp 的实际状态
@@ -27,6 +206,39 @@ type MyAppStatus struct {
 	Message string `json:"message,omitempty"`
 	// ReadyReplicas 就绪的副本数
 	ReadyReplicas int32 `json:"readyReplicas,omitempty"`
+	// Revision 期望的 Pod 模板版本
+	Revision string `json:"revision,omitempty"`
+	// Hooks 最近几个版本的钩子运行结果
+	Hooks []HookStatus `json:"hooks,omitempty"`
+	// ObservedGeneration 状态对应的 MyApp 的 generation
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Conditions MyApp 的状况，例如 SecurityCompliant
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+const (
+	// ConditionSecurityCompliant 表示 Pod 规格是否符合所在命名空间的 Pod Security Standard 级别
+	ConditionSecurityCompliant = "SecurityCompliant"
+	// ConditionDependenciesReady 表示 spec.dependsOn 中的 MyApp 是否全部处于 Running
+	ConditionDependenciesReady = "DependenciesReady"
+)
+
+// HookStatus 记录一个版本的一个钩子的运行结果
+type HookStatus struct {
+	// Type 钩子类型
+	Type HookType `json:"type"`
+	// Revision 钩子所属的 Pod 模板版本
+	Revision string `json:"revision"`
+	// JobName 钩子 Job 的名称
+	JobName string `json:"jobName"`
+	// Phase 钩子 Job 的运行阶段
+	Phase HookPhase `json:"phase"`
+	// Message 失败原因
+	Message string `json:"message,omitempty"`
+	// CompletionTime Job 成功或失败的时间
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
 }
 
 // +genclient
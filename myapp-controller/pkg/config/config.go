@@ -0,0 +1,216 @@
+// Package config 负责加载、校验和热加载 myapp-controller 的配置文件。
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/yaml"
+
+	"github.com/example/myapp-controller/pkg/config/v1alpha1"
+	"github.com/example/myapp-controller/pkg/features"
+)
+
+// Default 返回默认配置，与不传任何命令行参数时的行为一致
+func Default() *v1alpha1.ControllerConfig {
+	return &v1alpha1.ControllerConfig{
+		TypeMeta: metav1.TypeMeta{APIVersion: v1alpha1.GroupVersion, Kind: v1alpha1.Kind},
+		Metrics: v1alpha1.MetricsConfig{
+			BindAddress: ":8080",
+			CertName:    "tls.crt",
+			KeyName:     "tls.key",
+		},
+		Health: v1alpha1.HealthConfig{BindAddress: ":8081"},
+		Webhook: v1alpha1.WebhookConfig{
+			Port:     9443,
+			CertName: "tls.crt",
+			KeyName:  "tls.key",
+		},
+		LeaderElection: v1alpha1.LeaderElectionConfig{
+			LeaseDuration:   metav1.Duration{Duration: 15 * time.Second},
+			RenewDeadline:   metav1.Duration{Duration: 10 * time.Second},
+			RetryPeriod:     metav1.Duration{Duration: 2 * time.Second},
+			ReleaseOnCancel: true,
+		},
+		Controller: v1alpha1.ControllerSettings{
+			MaxConcurrentReconciles: 1,
+			RateLimiter: v1alpha1.RateLimiterConfig{
+				BaseDelay: metav1.Duration{Duration: 5 * time.Millisecond},
+				MaxDelay:  metav1.Duration{Duration: 1000 * time.Second},
+				QPS:       10,
+				Burst:     100,
+			},
+		},
+		Defaults:    v1alpha1.DefaultsConfig{SecurityProfile: "none"},
+		Tracing:     v1alpha1.TracingConfig{SamplingRatio: 1},
+		LogSampling: v1alpha1.LogSamplingConfig{Initial: 100, Thereafter: 100},
+	}
+}
+
+// Load 读取 path 指向的配置文件并覆盖到 base 的副本上：
+// 文件中出现的字段覆盖 base，未出现的字段保留 base 的值（通常来自命令行参数）。
+// 返回的配置已通过校验。
+func Load(path string, base *v1alpha1.ControllerConfig) (*v1alpha1.ControllerConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+
+	cfg := base.DeepCopy()
+	cfg.APIVersion, cfg.Kind = "", ""
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	if cfg.APIVersion != v1alpha1.GroupVersion || cfg.Kind != v1alpha1.Kind {
+		return nil, fmt.Errorf("config file %s has apiVersion %q and kind %q, want %q and %q",
+			path, cfg.APIVersion, cfg.Kind, v1alpha1.GroupVersion, v1alpha1.Kind)
+	}
+
+	if err := Validate(cfg); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Validate 检查配置是否合法，返回所有不合法字段组成的错误
+func Validate(cfg *v1alpha1.ControllerConfig) error {
+	var errs field.ErrorList
+
+	if cfg.Metrics.BindAddress == "" {
+		errs = append(errs, field.Required(field.NewPath("metrics", "bindAddress"), "use \"0\" to disable the metrics server"))
+	}
+	if cfg.Metrics.CertDir != "" && (cfg.Metrics.CertName == "" || cfg.Metrics.KeyName == "") {
+		errs = append(errs, field.Required(field.NewPath("metrics"), "certName and keyName are required when certDir is set"))
+	}
+
+	if cfg.Webhook.Enabled {
+		if port := cfg.Webhook.Port; port < 1 || port > 65535 {
+			errs = append(errs, field.Invalid(field.NewPath("webhook", "port"), port, "must be between 1 and 65535"))
+		}
+		if cfg.Webhook.CertName == "" || cfg.Webhook.KeyName == "" {
+			errs = append(errs, field.Required(field.NewPath("webhook"), "certName and keyName are required when the webhook is enabled"))
+		}
+	}
+
+	if addr := cfg.Pprof.BindAddress; addr != "" && addr != "0" && (addr == cfg.Metrics.BindAddress || addr == cfg.Health.BindAddress) {
+		errs = append(errs, field.Invalid(field.NewPath("pprof", "bindAddress"), addr, "must differ from the metrics and health bind addresses"))
+	}
+
+	le := field.NewPath("leaderElection")
+	lease := cfg.LeaderElection.LeaseDuration.Duration
+	renew := cfg.LeaderElection.RenewDeadline.Duration
+	retry := cfg.LeaderElection.RetryPeriod.Duration
+	if lease <= 0 {
+		errs = append(errs, field.Invalid(le.Child("leaseDuration"), lease.String(), "must be positive"))
+	}
+	if renew <= 0 {
+		errs = append(errs, field.Invalid(le.Child("renewDeadline"), renew.String(), "must be positive"))
+	}
+	if retry <= 0 {
+		errs = append(errs, field.Invalid(le.Child("retryPeriod"), retry.String(), "must be positive"))
+	}
+	if renew >= lease {
+		errs = append(errs, field.Invalid(le.Child("renewDeadline"), renew.String(), "must be less than leaseDuration"))
+	}
+
+	for i, ns := range cfg.WatchNamespaces {
+		if strings.TrimSpace(ns) == "" {
+			errs = append(errs, field.Invalid(field.NewPath("watchNamespaces").Index(i), ns, "must not be empty"))
+		}
+	}
+	if cfg.ShardSelector != "" {
+		if _, err := labels.Parse(cfg.ShardSelector); err != nil {
+			errs = append(errs, field.Invalid(field.NewPath("shardSelector"), cfg.ShardSelector, err.Error()))
+		}
+	}
+
+	c := field.NewPath("controller")
+	rl := c.Child("rateLimiter")
+	if cfg.Controller.MaxConcurrentReconciles < 0 {
+		errs = append(errs, field.Invalid(c.Child("maxConcurrentReconciles"), cfg.Controller.MaxConcurrentReconciles, "must not be negative"))
+	}
+	if cfg.Controller.RateLimiter.BaseDelay.Duration < 0 {
+		errs = append(errs, field.Invalid(rl.Child("baseDelay"), cfg.Controller.RateLimiter.BaseDelay.String(), "must not be negative"))
+	}
+	if cfg.Controller.RateLimiter.MaxDelay.Duration < 0 {
+		errs = append(errs, field.Invalid(rl.Child("maxDelay"), cfg.Controller.RateLimiter.MaxDelay.String(), "must not be negative"))
+	}
+	if cfg.Controller.RateLimiter.QPS < 0 {
+		errs = append(errs, field.Invalid(rl.Child("qps"), cfg.Controller.RateLimiter.QPS, "must not be negative"))
+	}
+	if cfg.Controller.RateLimiter.Burst < 0 {
+		errs = append(errs, field.Invalid(rl.Child("burst"), cfg.Controller.RateLimiter.Burst, "must not be negative"))
+	}
+
+	if registry := cfg.Defaults.ImageRegistry; registry != "" {
+		if strings.Contains(registry, "://") || strings.HasSuffix(registry, "/") {
+			errs = append(errs, field.Invalid(field.NewPath("defaults", "imageRegistry"), registry,
+				"must be a registry host with optional path, without scheme or trailing slash"))
+		}
+	}
+
+	switch cfg.Defaults.SecurityProfile {
+	case "", "hardened", "none":
+	default:
+		errs = append(errs, field.NotSupported(field.NewPath("defaults", "securityProfile"), cfg.Defaults.SecurityProfile, []string{"hardened", "none"}))
+	}
+
+	if ratio := cfg.Tracing.SamplingRatio; ratio < 0 || ratio > 1 {
+		errs = append(errs, field.Invalid(field.NewPath("tracing", "samplingRatio"), ratio, "must be between 0 and 1"))
+	}
+
+	if err := features.NewFeatureGate().SetFromMap(cfg.FeatureGates); err != nil {
+		errs = append(errs, field.Invalid(field.NewPath("featureGates"), cfg.FeatureGates, err.Error()))
+	}
+
+	if cfg.LogLevel != "" {
+		if _, err := ParseLogLevel(cfg.LogLevel); err != nil {
+			errs = append(errs, field.Invalid(field.NewPath("logLevel"), cfg.LogLevel, err.Error()))
+		}
+	}
+
+	ls := field.NewPath("logSampling")
+	if cfg.LogSampling.Initial < 0 {
+		errs = append(errs, field.Invalid(ls.Child("initial"), cfg.LogSampling.Initial, "must not be negative"))
+	}
+	if cfg.LogSampling.Initial > 0 && cfg.LogSampling.Thereafter <= 0 {
+		errs = append(errs, field.Invalid(ls.Child("thereafter"), cfg.LogSampling.Thereafter, "must be positive when sampling is enabled"))
+	}
+
+	return errs.ToAggregate()
+}
+
+// ParseLogLevel 按与 --zap-log-level 相同的规则解析日志级别：
+// debug、info、error，或大于 0 的整数表示更详细的调试级别
+func ParseLogLevel(value string) (zapcore.Level, error) {
+	switch strings.ToLower(value) {
+	case "debug":
+		return zapcore.DebugLevel, nil
+	case "info":
+		return zapcore.InfoLevel, nil
+	case "error":
+		return zapcore.ErrorLevel, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 || n > 127 {
+		return 0, fmt.Errorf("must be debug, info, error or a positive integer")
+	}
+	return zapcore.Level(int8(-n)), nil
+}
+
+// RequiresRestart 判断两份配置之间是否存在只能通过重启生效的差异。
+// 日志级别和 MyApp 默认值可以热加载，其余字段都需要重启。
+func RequiresRestart(old, updated *v1alpha1.ControllerConfig) bool {
+	a, b := old.DeepCopy(), updated.DeepCopy()
+	a.LogLevel, b.LogLevel = "", ""
+	a.Defaults, b.Defaults = v1alpha1.DefaultsConfig{}, v1alpha1.DefaultsConfig{}
+	return !equality.Semantic.DeepEqual(a, b)
+}
@@ -0,0 +1,154 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/example/myapp-controller/pkg/config/v1alpha1"
+)
+
+// writeConfig 在临时目录中写入配置文件并返回其路径
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	return path
+}
+
+const header = "apiVersion: config.example.com/v1alpha1\nkind: ControllerConfig\n"
+
+func TestLoadOverlaysBase(t *testing.T) {
+	base := Default()
+	base.Metrics.BindAddress = ":9090"
+	base.LeaderElection.Enabled = true
+
+	path := writeConfig(t, header+`
+leaderElection:
+  leaseDuration: 30s
+  releaseOnCancel: false
+watchNamespaces: [team-a, team-b]
+controller:
+  maxConcurrentReconciles: 8
+defaults:
+  imageRegistry: registry.example.com/library
+featureGates:
+  ServerSideApply: true
+logLevel: debug
+`)
+	cfg, err := Load(path, base)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	// 文件中未出现的字段保留 base 的值
+	if cfg.Metrics.BindAddress != ":9090" || !cfg.LeaderElection.Enabled {
+		t.Errorf("fields absent from the file were not kept: %+v", cfg)
+	}
+	if cfg.LeaderElection.RenewDeadline.Duration != 10*time.Second {
+		t.Errorf("renewDeadline = %s, want default 10s", cfg.LeaderElection.RenewDeadline.Duration)
+	}
+	if cfg.LeaderElection.LeaseDuration.Duration != 30*time.Second || cfg.LeaderElection.ReleaseOnCancel {
+		t.Errorf("leader election fields from the file were not applied: %+v", cfg.LeaderElection)
+	}
+	if strings.Join(cfg.WatchNamespaces, ",") != "team-a,team-b" || cfg.Controller.MaxConcurrentReconciles != 8 {
+		t.Errorf("unexpected config: %+v", cfg)
+	}
+	if cfg.Defaults.ImageRegistry != "registry.example.com/library" || !cfg.FeatureGates["ServerSideApply"] || cfg.LogLevel != "debug" {
+		t.Errorf("unexpected config: %+v", cfg)
+	}
+	if base.LeaderElection.LeaseDuration.Duration != 15*time.Second {
+		t.Errorf("Load() modified base")
+	}
+}
+
+func TestLoadRejectsInvalidFiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{name: "unknown field", content: header + "metricz: {}\n", want: "unknown field"},
+		{name: "wrong kind", content: "apiVersion: config.example.com/v1alpha1\nkind: Other\n", want: "kind"},
+		{name: "missing apiVersion", content: "kind: ControllerConfig\n", want: "apiVersion"},
+		{name: "webhook port out of range", content: header + "webhook:\n  enabled: true\n  port: 70000\n", want: "webhook.port"},
+		{name: "pprof on metrics port", content: header + "pprof:\n  bindAddress: \":8080\"\n", want: "pprof.bindAddress"},
+		{name: "renew after lease", content: header + "leaderElection:\n  renewDeadline: 20s\n", want: "leaderElection.renewDeadline"},
+		{name: "bad selector", content: header + "shardSelector: \"a in (\"\n", want: "shardSelector"},
+		{name: "negative concurrency", content: header + "controller:\n  maxConcurrentReconciles: -1\n", want: "controller.maxConcurrentReconciles"},
+		{name: "registry with scheme", content: header + "defaults:\n  imageRegistry: https://registry.example.com\n", want: "defaults.imageRegistry"},
+		{name: "unknown security profile", content: header + "defaults:\n  securityProfile: strict\n", want: "defaults.securityProfile"},
+		{name: "bad log level", content: header + "logLevel: verbose\n", want: "logLevel"},
+		{name: "unknown feature gate", content: header + "featureGates:\n  Foo: true\n", want: "unrecognized feature gate"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Load(writeConfig(t, tc.content), Default())
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("Load() error = %v, want it to mention %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestRequiresRestart(t *testing.T) {
+	old := Default()
+
+	updated := old.DeepCopy()
+	updated.LogLevel = "debug"
+	updated.Defaults.ImageRegistry = "registry.example.com"
+	updated.Defaults.SecurityProfile = "hardened"
+	if RequiresRestart(old, updated) {
+		t.Errorf("logLevel and defaults changes should not require a restart")
+	}
+
+	updated.Controller.MaxConcurrentReconciles = 4
+	if !RequiresRestart(old, updated) {
+		t.Errorf("controller changes should require a restart")
+	}
+}
+
+func TestWatcherReloadAppliesHotSettings(t *testing.T) {
+	path := writeConfig(t, header+"logLevel: info\n")
+	base := Default()
+	current, err := Load(path, base)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	var reloaded []*v1alpha1.ControllerConfig
+	w := NewWatcher(path, base, current, func(cfg *v1alpha1.ControllerConfig) {
+		reloaded = append(reloaded, cfg)
+	})
+
+	// 无变化时不回调
+	w.Reload()
+	if len(reloaded) != 0 {
+		t.Fatalf("reload without changes triggered %d callbacks", len(reloaded))
+	}
+
+	// 同时修改可热加载和需要重启的字段，只应用可热加载的字段
+	if err := os.WriteFile(path, []byte(header+"logLevel: debug\ncontroller:\n  maxConcurrentReconciles: 4\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	w.Reload()
+	if len(reloaded) != 1 {
+		t.Fatalf("got %d callbacks, want 1", len(reloaded))
+	}
+	if got := reloaded[0]; got.LogLevel != "debug" || got.Controller.MaxConcurrentReconciles != 1 {
+		t.Errorf("reloaded config = %+v, want logLevel debug and unchanged concurrency", got)
+	}
+
+	// 无效文件保留当前配置
+	if err := os.WriteFile(path, []byte(header+"logLevel: verbose\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	w.Reload()
+	if len(reloaded) != 1 {
+		t.Errorf("invalid config triggered a callback")
+	}
+}
@@ -0,0 +1,165 @@
+// Package v1alpha1 定义 myapp-controller 配置文件的 v1alpha1 版本。
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// GroupVersion 是配置文件的 apiVersion
+	GroupVersion = "config.example.com/v1alpha1"
+	// Kind 是配置文件的 kind
+	Kind = "ControllerConfig"
+)
+
+// ControllerConfig 是通过 --config 加载的控制器配置
+type ControllerConfig struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// Metrics 指标端点配置
+	Metrics MetricsConfig `json:"metrics,omitempty"`
+	// Health 健康检查端点配置
+	Health HealthConfig `json:"health,omitempty"`
+	// Webhook 准入 webhook 配置
+	Webhook WebhookConfig `json:"webhook,omitempty"`
+	// Pprof pprof 端点配置
+	Pprof PprofConfig `json:"pprof,omitempty"`
+	// LeaderElection 选主配置
+	LeaderElection LeaderElectionConfig `json:"leaderElection,omitempty"`
+	// WatchNamespaces 只 watch 这些命名空间，为空时 watch 整个集群
+	WatchNamespaces []string `json:"watchNamespaces,omitempty"`
+	// ShardSelector 只协调匹配该标签选择器的 MyApp
+	ShardSelector string `json:"shardSelector,omitempty"`
+	// Controller 并发和限速配置
+	Controller ControllerSettings `json:"controller,omitempty"`
+	// Defaults MyApp 的默认值，修改后无需重启即可生效
+	Defaults DefaultsConfig `json:"defaults,omitempty"`
+	// Tracing 链路追踪配置
+	Tracing TracingConfig `json:"tracing,omitempty"`
+	// FeatureGates 功能开关
+	FeatureGates map[string]bool `json:"featureGates,omitempty"`
+	// LogLevel 日志级别（debug、info、error 或数字），修改后无需重启即可生效
+	LogLevel string `json:"logLevel,omitempty"`
+	// LogSampling 高频日志的采样配置
+	LogSampling LogSamplingConfig `json:"logSampling,omitempty"`
+}
+
+// LogSamplingConfig 高频日志的采样配置，Warn 及以上级别的日志不采样
+type LogSamplingConfig struct {
+	// Initial 每秒内相同级别和消息的日志先完整输出的条数，0 表示不采样
+	Initial int `json:"initial,omitempty"`
+	// Thereafter 超过 Initial 后每隔多少条输出一条
+	Thereafter int `json:"thereafter,omitempty"`
+}
+
+// MetricsConfig 指标端点配置
+type MetricsConfig struct {
+	// BindAddress 指标端点监听地址，"0" 表示关闭
+	BindAddress string `json:"bindAddress,omitempty"`
+	// Secure 是否通过 HTTPS 并带认证鉴权地暴露指标
+	Secure bool `json:"secure,omitempty"`
+	// CertDir 证书目录，为空时使用自签名证书
+	CertDir string `json:"certDir,omitempty"`
+	// CertName 证书文件名
+	CertName string `json:"certName,omitempty"`
+	// KeyName 私钥文件名
+	KeyName string `json:"keyName,omitempty"`
+}
+
+// HealthConfig 健康检查端点配置
+type HealthConfig struct {
+	// BindAddress 健康检查端点监听地址
+	BindAddress string `json:"bindAddress,omitempty"`
+}
+
+// WebhookConfig 准入 webhook 配置
+type WebhookConfig struct {
+	// Enabled 是否启动 webhook server 并注册 MyApp 的准入校验
+	Enabled bool `json:"enabled,omitempty"`
+	// Port webhook server 监听的端口
+	Port int `json:"port,omitempty"`
+	// CertDir 证书目录，通常由 cert-manager 签发并挂载
+	CertDir string `json:"certDir,omitempty"`
+	// CertName 证书文件名
+	CertName string `json:"certName,omitempty"`
+	// KeyName 私钥文件名
+	KeyName string `json:"keyName,omitempty"`
+}
+
+// PprofConfig pprof 端点配置
+type PprofConfig struct {
+	// BindAddress pprof 端点监听地址，为空或 "0" 表示关闭
+	BindAddress string `json:"bindAddress,omitempty"`
+}
+
+// LeaderElectionConfig 选主配置
+type LeaderElectionConfig struct {
+	// Enabled 是否开启选主
+	Enabled bool `json:"enabled,omitempty"`
+	// Namespace Lease 所在命名空间
+	Namespace string `json:"namespace,omitempty"`
+	// LeaseDuration 备用实例强制接管前等待的时间
+	LeaseDuration metav1.Duration `json:"leaseDuration,omitempty"`
+	// RenewDeadline leader 续约失败多久后放弃
+	RenewDeadline metav1.Duration `json:"renewDeadline,omitempty"`
+	// RetryPeriod 选主客户端的重试间隔
+	RetryPeriod metav1.Duration `json:"retryPeriod,omitempty"`
+	// ReleaseOnCancel 停止时是否主动释放 Lease
+	ReleaseOnCancel bool `json:"releaseOnCancel,omitempty"`
+}
+
+// ControllerSettings 并发和限速配置
+type ControllerSettings struct {
+	// MaxConcurrentReconciles 同时运行的 Reconcile 数量
+	MaxConcurrentReconciles int `json:"maxConcurrentReconciles,omitempty"`
+	// RateLimiter 工作队列限速配置
+	RateLimiter RateLimiterConfig `json:"rateLimiter,omitempty"`
+}
+
+// RateLimiterConfig 工作队列限速配置
+type RateLimiterConfig struct {
+	// BaseDelay 单个对象失败重试的初始退避时间
+	BaseDelay metav1.Duration `json:"baseDelay,omitempty"`
+	// MaxDelay 单个对象失败重试的最大退避时间
+	MaxDelay metav1.Duration `json:"maxDelay,omitempty"`
+	// QPS 全局令牌桶每秒放行的重试次数
+	QPS float64 `json:"qps,omitempty"`
+	// Burst 全局令牌桶的容量
+	Burst int `json:"burst,omitempty"`
+}
+
+// TracingConfig 链路追踪配置
+type TracingConfig struct {
+	// Endpoint OTLP gRPC 接收端地址，为空时不开启追踪
+	Endpoint string `json:"endpoint,omitempty"`
+	// Insecure 是否使用明文连接接收端
+	Insecure bool `json:"insecure,omitempty"`
+	// SamplingRatio 新建 trace 的采样比例，0 到 1 之间
+	SamplingRatio float64 `json:"samplingRatio,omitempty"`
+}
+
+// DefaultsConfig MyApp 的默认值
+type DefaultsConfig struct {
+	// ImageRegistry 镜像未指定仓库时使用的默认仓库，例如 registry.example.com/library
+	ImageRegistry string `json:"imageRegistry,omitempty"`
+	// SecurityProfile MyApp 未设置 spec.security 字段时使用的安全配置档，none（默认）或 hardened
+	SecurityProfile string `json:"securityProfile,omitempty"`
+}
+
+// DeepCopy 返回配置的深拷贝
+func (in *ControllerConfig) DeepCopy() *ControllerConfig {
+	if in == nil {
+		return nil
+	}
+	out := *in
+	if in.WatchNamespaces != nil {
+		out.WatchNamespaces = append([]string(nil), in.WatchNamespaces...)
+	}
+	if in.FeatureGates != nil {
+		out.FeatureGates = make(map[string]bool, len(in.FeatureGates))
+		for k, v := range in.FeatureGates {
+			out.FeatureGates[k] = v
+		}
+	}
+	return &out
+}
@@ -0,0 +1,111 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"github.com/example/myapp-controller/pkg/config/v1alpha1"
+)
+
+// reloadDebounce 合并短时间内的多个文件事件，编辑器保存或 ConfigMap 更新通常会产生多个事件
+const reloadDebounce = 500 * time.Millisecond
+
+var watcherLog = ctrl.Log.WithName("config")
+
+// Watcher 监视配置文件，在文件变化时重新加载并回调可以热加载的配置。
+// Watcher 实现了 manager.Runnable，所有副本（不只是 leader）都会运行它。
+type Watcher struct {
+	path     string
+	base     *v1alpha1.ControllerConfig
+	onReload func(*v1alpha1.ControllerConfig)
+
+	mu      sync.Mutex
+	current *v1alpha1.ControllerConfig
+}
+
+// NewWatcher 创建配置文件监视器。
+// base 是加载时使用的基础配置（来自命令行参数），current 是启动时已生效的配置，
+// 每次重新加载成功后调用 onReload。
+func NewWatcher(path string, base, current *v1alpha1.ControllerConfig, onReload func(*v1alpha1.ControllerConfig)) *Watcher {
+	return &Watcher{
+		path:     path,
+		base:     base.DeepCopy(),
+		current:  current.DeepCopy(),
+		onReload: onReload,
+	}
+}
+
+// NeedLeaderElection 返回 false，备用副本也需要热加载配置
+func (w *Watcher) NeedLeaderElection() bool {
+	return false
+}
+
+// Start 开始监视配置文件，直到 ctx 结束。
+// 监视的是文件所在目录而不是文件本身，这样 ConfigMap 通过替换符号链接更新时也能收到事件。
+func (w *Watcher) Start(ctx context.Context) error {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create config watcher: %w", err)
+	}
+	defer fsw.Close()
+
+	dir := filepath.Dir(w.path)
+	if err := fsw.Add(dir); err != nil {
+		return fmt.Errorf("failed to watch config directory %s: %w", dir, err)
+	}
+	watcherLog.Info("watching config file", "path", w.path)
+
+	var debounce <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-fsw.Events:
+			if !ok {
+				return nil
+			}
+			if event.Has(fsnotify.Chmod) {
+				continue
+			}
+			debounce = time.After(reloadDebounce)
+		case err, ok := <-fsw.Errors:
+			if !ok {
+				return nil
+			}
+			watcherLog.Error(err, "config watcher error")
+		case <-debounce:
+			debounce = nil
+			w.Reload()
+		}
+	}
+}
+
+// Reload 重新加载配置文件。
+// 加载失败时保留当前配置；只能通过重启生效的字段发生变化时记录日志并忽略这些字段。
+func (w *Watcher) Reload() {
+	cfg, err := Load(w.path, w.base)
+	if err != nil {
+		watcherLog.Error(err, "failed to reload config, keeping the current one")
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if RequiresRestart(w.current, cfg) {
+		watcherLog.Info("config changed in fields that require a restart, only logLevel and defaults are applied", "path", w.path)
+	}
+	if cfg.LogLevel == w.current.LogLevel && cfg.Defaults == w.current.Defaults {
+		return
+	}
+
+	w.current.LogLevel = cfg.LogLevel
+	w.current.Defaults = cfg.Defaults
+	watcherLog.Info("reloaded config", "logLevel", cfg.LogLevel, "imageRegistry", cfg.Defaults.ImageRegistry)
+	w.onReload(w.current.DeepCopy())
+}
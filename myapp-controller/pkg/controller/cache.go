@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	myappv1 "github.com/example/myapp-controller/pkg/apis/example/v1"
+	"github.com/example/myapp-controller/pkg/features"
+)
+
+const (
+	// ManagedByLabel 标记由控制器创建的 Deployment 和 Service，缓存只保存带有该标签的对象
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+	// ManagedByValue 是 ManagedByLabel 的取值
+	ManagedByValue = "myapp-controller"
+)
+
+// ParseNamespaces 解析逗号分隔的命名空间列表，忽略空白项和重复项
+func ParseNamespaces(value string) []string {
+	var namespaces []string
+	seen := map[string]bool{}
+	for _, ns := range strings.Split(value, ",") {
+		ns = strings.TrimSpace(ns)
+		if ns == "" || seen[ns] {
+			continue
+		}
+		seen[ns] = true
+		namespaces = append(namespaces, ns)
+	}
+	return namespaces
+}
+
+// LeaderElectionID 返回选主使用的 Lease 名称。
+// 不同分片需要各自选主，因此分片选择器非空时在 base 后追加选择器的哈希。
+func LeaderElectionID(base, shardSelector string) string {
+	if shardSelector == "" {
+		return base
+	}
+	sum := sha256.Sum256([]byte(shardSelector))
+	return base + "-" + hex.EncodeToString(sum[:])[:8]
+}
+
+// CacheOptions 构造 manager 的缓存选项：
+//   - namespaces 非空时只 watch 这些命名空间，否则 watch 整个集群
+//   - shardSelector 非空时只缓存匹配该标签选择器的 MyApp，
+//     多个控制器副本使用不同的选择器即可分担 MyApp
+//   - Deployment、Service、钩子 Job、ServiceAccount、Role、RoleBinding 和 NetworkPolicy 只缓存带有 ManagedByLabel 的对象，
+//     不再缓存集群中所有的同类对象
+//   - 所有对象在写入缓存前去掉 managedFields，控制器不读取该字段
+func CacheOptions(namespaces []string, shardSelector string) (cache.Options, error) {
+	managed := labels.SelectorFromSet(labels.Set{ManagedByLabel: ManagedByValue})
+	opts := cache.Options{
+		ByObject: map[client.Object]cache.ByObject{
+			&appsv1.Deployment{}:          {Label: managed},
+			&corev1.Service{}:             {Label: managed},
+			&batchv1.Job{}:                {Label: managed},
+			&corev1.ServiceAccount{}:      {Label: managed},
+			&rbacv1.Role{}:                {Label: managed},
+			&rbacv1.RoleBinding{}:         {Label: managed},
+			&networkingv1.NetworkPolicy{}: {Label: managed},
+		},
+		DefaultTransform: cache.TransformStripManagedFields(),
+	}
+
+	if len(namespaces) > 0 {
+		opts.DefaultNamespaces = make(map[string]cache.Config, len(namespaces))
+		for _, ns := range namespaces {
+			opts.DefaultNamespaces[ns] = cache.Config{}
+		}
+	}
+
+	if shardSelector != "" {
+		selector, err := labels.Parse(shardSelector)
+		if err != nil {
+			return cache.Options{}, fmt.Errorf("invalid shard selector %q: %w", shardSelector, err)
+		}
+		opts.ByObject[&myappv1.MyApp{}] = cache.ByObject{Label: selector}
+	}
+
+	return opts, nil
+}
+
+// CachedLists 返回开启 gate 中的功能时控制器和准入 webhook 从缓存读取的所有资源的列表类型，供 /debug/cache 统计。
+// 新的 watch 或缓存读取需要同时加到这里，未开启的功能对应的资源不会被 watch，也不会出现在结果中
+func CachedLists(gate *features.FeatureGate) []client.ObjectList {
+	lists := []client.ObjectList{
+		&myappv1.MyAppList{},
+		&appsv1.DeploymentList{},
+		&corev1.ServiceList{},
+		&batchv1.JobList{},
+		&corev1.ServiceAccountList{},
+		&rbacv1.RoleList{},
+		&rbacv1.RoleBindingList{},
+		&networkingv1.NetworkPolicyList{},
+	}
+	if gate.Enabled(features.MyAppSet) {
+		lists = append(lists, &myappv1.MyAppSetList{}, &corev1.NamespaceList{})
+	}
+	if gate.Enabled(features.MyAppClass) {
+		lists = append(lists, &myappv1.MyAppClassList{})
+	}
+	if gate.Enabled(features.MyAppPolicy) {
+		lists = append(lists, &myappv1.MyAppPolicyList{})
+	}
+	return lists
+}
@@ -0,0 +1,176 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+// BenchmarkCacheMemory 在独立的 envtest 环境中构造一个合成集群：大量与 MyApp 无关的 Deployment 和 Service，
+// 以及少量由控制器管理的对象，比较缓存所有对象与按 ManagedByLabel 过滤并去掉 managedFields 时的堆内存：
+//
+//	make cachebench
+//	MYAPP_CACHEBENCH_OBJECTS=5000 go test ./pkg/controller -run '^$' -bench CacheMemory -benchtime 1x
+func BenchmarkCacheMemory(b *testing.B) {
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		b.Skip("KUBEBUILDER_ASSETS is not set")
+	}
+
+	objects := 2000
+	if v := os.Getenv("MYAPP_CACHEBENCH_OBJECTS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			b.Fatalf("invalid MYAPP_CACHEBENCH_OBJECTS: %v", err)
+		}
+		objects = n
+	}
+	// 十分之一的对象由控制器管理
+	managed := objects / 10
+
+	env := &envtest.Environment{
+		CRDDirectoryPaths:     []string{filepath.Join("..", "..", "config", "crd")},
+		ErrorIfCRDPathMissing: true,
+	}
+	restCfg, err := env.Start()
+	if err != nil {
+		b.Fatalf("failed to start envtest: %v", err)
+	}
+	defer func() { _ = env.Stop() }()
+
+	s := newTestScheme()
+	c, err := client.New(restCfg, client.Options{Scheme: s})
+	if err != nil {
+		b.Fatalf("failed to create client: %v", err)
+	}
+	if err := populateSyntheticCluster(context.Background(), c, objects, managed); err != nil {
+		b.Fatalf("failed to populate cluster: %v", err)
+	}
+
+	filtered, err := CacheOptions(nil, "")
+	if err != nil {
+		b.Fatalf("failed to build cache options: %v", err)
+	}
+	for _, variant := range []struct {
+		name string
+		opts cache.Options
+	}{
+		{name: "cache=all", opts: cache.Options{}},
+		{name: "cache=managed", opts: filtered},
+	} {
+		b.Run(variant.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				heap, cached := measureCache(b, restCfg, variant.opts)
+				b.ReportMetric(float64(heap)/(1<<20), "heap-MiB")
+				b.ReportMetric(float64(cached), "objects")
+			}
+		})
+	}
+}
+
+// populateSyntheticCluster 创建 objects 个 Deployment 和 Service，其中 managed 个带有 ManagedByLabel
+func populateSyntheticCluster(ctx context.Context, c client.Client, objects, managed int) error {
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "cachebench"}}
+	if err := c.Create(ctx, ns); err != nil {
+		return err
+	}
+	for i := 0; i < objects; i++ {
+		name := fmt.Sprintf("workload-%d", i)
+		labels := map[string]string{"app": name, "team": fmt.Sprintf("team-%d", i%20)}
+		objLabels := labels
+		if i < managed {
+			objLabels = withManagedByLabel(labels)
+		}
+		// 较大的注解模拟 kubectl apply 等工具留下的 last-applied-configuration
+		annotations := map[string]string{"example.com/description": strings.Repeat("x", 512)}
+
+		replicas := int32(1)
+		deploy := &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: ns.Name, Labels: objLabels, Annotations: annotations},
+			Spec: appsv1.DeploymentSpec{
+				Replicas: &replicas,
+				Selector: &metav1.LabelSelector{MatchLabels: labels},
+				Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{Labels: labels},
+					Spec: corev1.PodSpec{Containers: []corev1.Container{{
+						Name:  "app",
+						Image: "nginx:1.25",
+						Env:   []corev1.EnvVar{{Name: "WORKLOAD", Value: name}},
+					}}},
+				},
+			},
+		}
+		if err := c.Create(ctx, deploy, client.FieldOwner("cachebench")); err != nil {
+			return err
+		}
+		svc := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: ns.Name, Labels: objLabels, Annotations: annotations},
+			Spec: corev1.ServiceSpec{
+				Selector: labels,
+				Ports:    []corev1.ServicePort{{Port: 80, TargetPort: intstr.FromInt(8080)}},
+			},
+		}
+		if err := c.Create(ctx, svc, client.FieldOwner("cachebench")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// measureCache 启动使用 opts 的缓存并等待 Deployment 和 Service 同步完成，
+// 返回缓存占用的堆内存和缓存中的对象数量
+func measureCache(b *testing.B, restCfg *rest.Config, opts cache.Options) (uint64, int) {
+	b.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	opts.Scheme = newTestScheme()
+	informers, err := cache.New(restCfg, opts)
+	if err != nil {
+		b.Fatalf("failed to create cache: %v", err)
+	}
+	for _, obj := range []client.Object{&appsv1.Deployment{}, &corev1.Service{}} {
+		if _, err := informers.GetInformer(ctx, obj); err != nil {
+			b.Fatalf("failed to get informer for %T: %v", obj, err)
+		}
+	}
+	go func() { _ = informers.Start(ctx) }()
+	if !informers.WaitForCacheSync(ctx) {
+		b.Fatalf("cache did not sync")
+	}
+
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+
+	cached := 0
+	for _, list := range []client.ObjectList{&appsv1.DeploymentList{}, &corev1.ServiceList{}} {
+		if err := informers.List(ctx, list, client.UnsafeDisableDeepCopy); err != nil {
+			b.Fatalf("failed to list cached objects: %v", err)
+		}
+		cached += meta.LenList(list)
+	}
+	runtime.KeepAlive(informers)
+
+	if after.HeapAlloc < before.HeapAlloc {
+		return 0, cached
+	}
+	return after.HeapAlloc - before.HeapAlloc, cached
+}
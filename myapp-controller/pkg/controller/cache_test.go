@@ -0,0 +1,147 @@
+package controller
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+
+	myappv1 "github.com/example/myapp-controller/pkg/apis/example/v1"
+	"github.com/example/myapp-controller/pkg/features"
+)
+
+func TestParseNamespaces(t *testing.T) {
+	got := ParseNamespaces(" team-a, team-b,,team-a ")
+	want := []string{"team-a", "team-b"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseNamespaces() = %v, want %v", got, want)
+	}
+	if got := ParseNamespaces(""); got != nil {
+		t.Errorf("ParseNamespaces(\"\") = %v, want nil", got)
+	}
+}
+
+func TestLeaderElectionID(t *testing.T) {
+	if got := LeaderElectionID("myapp", ""); got != "myapp" {
+		t.Errorf("LeaderElectionID without shard = %q, want %q", got, "myapp")
+	}
+	shard0 := LeaderElectionID("myapp", "shard=0")
+	shard1 := LeaderElectionID("myapp", "shard=1")
+	if shard0 == shard1 || shard0 == "myapp" {
+		t.Errorf("shards must use distinct lease names, got %q and %q", shard0, shard1)
+	}
+}
+
+func TestCacheOptions(t *testing.T) {
+	opts, err := CacheOptions([]string{"team-a", "team-b"}, "myapp.example.com/shard=0")
+	if err != nil {
+		t.Fatalf("CacheOptions() error = %v", err)
+	}
+	if len(opts.DefaultNamespaces) != 2 {
+		t.Errorf("DefaultNamespaces = %v, want team-a and team-b", opts.DefaultNamespaces)
+	}
+
+	var found bool
+	for obj, byObject := range opts.ByObject {
+		if _, ok := obj.(*myappv1.MyApp); !ok {
+			continue
+		}
+		found = true
+		if !byObject.Label.Matches(labels.Set{"myapp.example.com/shard": "0"}) {
+			t.Errorf("shard selector does not match its own shard")
+		}
+		if byObject.Label.Matches(labels.Set{"myapp.example.com/shard": "1"}) {
+			t.Errorf("shard selector matches another shard")
+		}
+	}
+	if !found {
+		t.Errorf("ByObject has no entry for MyApp")
+	}
+
+	opts, err = CacheOptions(nil, "")
+	if err != nil {
+		t.Fatalf("CacheOptions() error = %v", err)
+	}
+	if opts.DefaultNamespaces != nil {
+		t.Errorf("expected cluster-wide cache, got namespaces %v", opts.DefaultNamespaces)
+	}
+	if opts.DefaultTransform == nil {
+		t.Errorf("expected a transform stripping managed fields")
+	}
+	managed := labels.Set{ManagedByLabel: ManagedByValue}
+	var owned int
+	for obj, byObject := range opts.ByObject {
+		switch obj.(type) {
+		case *myappv1.MyApp:
+			t.Errorf("MyApp must not be filtered without a shard selector")
+		case *appsv1.Deployment, *corev1.Service, *batchv1.Job, *corev1.ServiceAccount, *rbacv1.Role, *rbacv1.RoleBinding, *networkingv1.NetworkPolicy:
+			owned++
+			if !byObject.Label.Matches(managed) || byObject.Label.Matches(labels.Set{"app": "web"}) {
+				t.Errorf("%T selector %q must only match objects managed by the controller", obj, byObject.Label)
+			}
+		}
+	}
+	if owned != 7 {
+		t.Errorf("expected label selectors for every object the controller owns, got %v", opts.ByObject)
+	}
+
+	if _, err := CacheOptions(nil, "shard in ("); err == nil {
+		t.Errorf("expected error for invalid selector")
+	}
+}
+
+func TestCachedLists(t *testing.T) {
+	scheme := newTestScheme()
+	kinds := func(gate *features.FeatureGate) map[string]bool {
+		out := map[string]bool{}
+		for _, list := range CachedLists(gate) {
+			gvk, err := apiutil.GVKForObject(list, scheme)
+			if err != nil {
+				t.Fatalf("list %T is not registered: %v", list, err)
+			}
+			out[strings.TrimSuffix(gvk.Kind, "List")] = true
+		}
+		return out
+	}
+
+	// 缓存选项中单独配置的资源都是控制器 watch 的资源
+	opts, err := CacheOptions(nil, "shard=0")
+	if err != nil {
+		t.Fatalf("CacheOptions() error = %v", err)
+	}
+	cached := kinds(features.NewFeatureGate())
+	for obj := range opts.ByObject {
+		gvk, err := apiutil.GVKForObject(obj, scheme)
+		if err != nil {
+			t.Fatalf("object %T is not registered: %v", obj, err)
+		}
+		if !cached[gvk.Kind] {
+			t.Errorf("CachedLists() is missing %s", gvk.Kind)
+		}
+	}
+	for _, kind := range []string{"MyAppSet", "MyAppClass", "MyAppPolicy"} {
+		if cached[kind] {
+			t.Errorf("CachedLists() includes %s with its feature disabled", kind)
+		}
+	}
+
+	gate := features.NewFeatureGate()
+	if err := gate.SetFromMap(map[string]bool{
+		string(features.MyAppSet): true, string(features.MyAppClass): true, string(features.MyAppPolicy): true,
+	}); err != nil {
+		t.Fatalf("failed to enable features: %v", err)
+	}
+	cached = kinds(gate)
+	for _, kind := range []string{"MyAppSet", "Namespace", "MyAppClass", "MyAppPolicy"} {
+		if !cached[kind] {
+			t.Errorf("CachedLists() is missing %s with its feature enabled", kind)
+		}
+	}
+}
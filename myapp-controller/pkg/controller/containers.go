@@ -0,0 +1,357 @@
+package controller
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	myappv1 "github.com/example/myapp-controller/pkg/apis/example/v1"
+)
+
+const (
+	// appContainerName 是主容器的名称
+	appContainerName = "app"
+	// appPortName 是主容器端口的名称
+	appPortName = "http"
+	// servicePort 是 Service 暴露主容器端口时使用的端口
+	servicePort = 80
+	// maxPortNameLength 是 Kubernetes 端口名称的最大长度
+	maxPortNameLength = 15
+)
+
+// validateSpec 检查 sidecar、init 容器、共享卷、钩子和 ServiceAccount 权限的配置，
+// 不合法的规格无法通过重试修复，由调用方写入状态而不是重新排队
+func validateSpec(m *myappv1.MyApp) error {
+	volumes := map[string]bool{}
+	for _, v := range m.Spec.Volumes {
+		if volumes[v.Name] {
+			return fmt.Errorf("volume %q is defined more than once", v.Name)
+		}
+		volumes[v.Name] = true
+	}
+	checkMounts := func(container string, mounts []corev1.VolumeMount) error {
+		for _, mount := range mounts {
+			if !volumes[mount.Name] {
+				return fmt.Errorf("container %q mounts undefined volume %q", container, mount.Name)
+			}
+		}
+		return nil
+	}
+	if err := checkMounts(appContainerName, m.Spec.VolumeMounts); err != nil {
+		return err
+	}
+
+	names := map[string]bool{appContainerName: true}
+	// Service 上同一协议的端口号必须唯一
+	exposed := map[string]string{fmt.Sprintf("%s/%d", corev1.ProtocolTCP, servicePort): appContainerName}
+	for _, c := range append(append([]myappv1.Container{}, m.Spec.Sidecars...), m.Spec.InitContainers...) {
+		if names[c.Name] {
+			return fmt.Errorf("container name %q is reserved or used more than once", c.Name)
+		}
+		names[c.Name] = true
+		if err := checkMounts(c.Name, c.VolumeMounts); err != nil {
+			return err
+		}
+	}
+	for _, c := range m.Spec.Sidecars {
+		for _, p := range c.Ports {
+			if !p.Expose {
+				continue
+			}
+			key := fmt.Sprintf("%s/%d", protocolOrDefault(p.Protocol), p.ContainerPort)
+			if other, ok := exposed[key]; ok {
+				return fmt.Errorf("port %s of container %q is already exposed by container %q", key, c.Name, other)
+			}
+			exposed[key] = c.Name
+		}
+	}
+	if h := m.Spec.Hooks; h != nil {
+		for hookType, spec := range map[myappv1.HookType]*batchv1.JobSpec{myappv1.HookPreDeploy: h.PreDeploy, myappv1.HookPostDeploy: h.PostDeploy} {
+			if spec != nil && len(spec.Template.Spec.Containers) == 0 {
+				return fmt.Errorf("%s hook has no containers", hookType)
+			}
+		}
+	}
+	if sa := m.Spec.ServiceAccount; sa != nil {
+		for i, rule := range sa.Rules {
+			// Role 只能授予命名空间内资源的权限
+			if len(rule.NonResourceURLs) > 0 {
+				return fmt.Errorf("serviceAccount rule %d uses nonResourceURLs, which a Role cannot grant", i)
+			}
+			if len(rule.Verbs) == 0 || len(rule.APIGroups) == 0 || len(rule.Resources) == 0 {
+				return fmt.Errorf("serviceAccount rule %d must list verbs, apiGroups and resources", i)
+			}
+		}
+	}
+	for _, dep := range m.Spec.DependsOn {
+		if dependencyKey(m, dep) == client.ObjectKeyFromObject(m) {
+			return fmt.Errorf("dependsOn must not reference the MyApp itself")
+		}
+	}
+	if np := m.Spec.NetworkPolicy; np != nil {
+		for i, peer := range np.Ingress {
+			// 空的对端在 NetworkPolicy 中表示允许所有来源
+			if len(peer.Apps) == 0 && len(peer.Namespaces) == 0 && len(peer.CIDRs) == 0 {
+				return fmt.Errorf("networkPolicy ingress rule %d must list apps, namespaces or cidrs", i)
+			}
+			if err := checkCIDRs("ingress", i, peer.CIDRs); err != nil {
+				return err
+			}
+		}
+		for i, rule := range np.Egress {
+			if len(rule.Apps) == 0 && len(rule.Namespaces) == 0 && len(rule.CIDRs) == 0 && len(rule.Ports) == 0 {
+				return fmt.Errorf("networkPolicy egress rule %d must list apps, namespaces, cidrs or ports", i)
+			}
+			if err := checkCIDRs("egress", i, rule.CIDRs); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkCIDRs 检查 NetworkPolicy 规则中的 IP 地址段格式
+func checkCIDRs(direction string, rule int, cidrs []string) error {
+	for _, cidr := range cidrs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("networkPolicy %s rule %d has invalid cidr %q", direction, rule, cidr)
+		}
+	}
+	return nil
+}
+
+// podSpecForMyApp 返回 MyApp 的容器、init 容器、共享卷、调度配置以及需要在 Service 上额外暴露的 sidecar 端口。
+// 所有端口名称在 Pod 内唯一，Service 通过端口名称引用 sidecar 的端口。
+func podSpecForMyApp(m *myappv1.MyApp, resolveImage func(string) string) (corev1.PodSpec, []corev1.ServicePort) {
+	names := newPortNamer()
+	spec := corev1.PodSpec{
+		NodeSelector:      m.Spec.NodeSelector,
+		Tolerations:       m.Spec.Tolerations,
+		Affinity:          m.Spec.Affinity,
+		PriorityClassName: m.Spec.PriorityClassName,
+		RuntimeClassName:  m.Spec.RuntimeClassName,
+		Containers: []corev1.Container{{
+			Image: resolveImage(m.Spec.Image),
+			Name:  appContainerName,
+			Ports: []corev1.ContainerPort{{
+				ContainerPort: m.Spec.Port,
+				Name:          names.name(appPortName, appContainerName, m.Spec.Port),
+				Protocol:      corev1.ProtocolTCP,
+			}},
+			Resources:      m.Spec.Resources,
+			ReadinessProbe: probeWithDefaults(m.Spec.ReadinessProbe),
+			LivenessProbe:  probeWithDefaults(m.Spec.LivenessProbe),
+			VolumeMounts:   m.Spec.VolumeMounts,
+		}},
+	}
+
+	var exposed []corev1.ServicePort
+	for _, c := range m.Spec.Sidecars {
+		container := buildContainer(c, names, resolveImage)
+		spec.Containers = append(spec.Containers, container)
+		for i, p := range c.Ports {
+			if !p.Expose {
+				continue
+			}
+			port := container.Ports[i]
+			exposed = append(exposed, corev1.ServicePort{
+				Name:       port.Name,
+				Port:       port.ContainerPort,
+				TargetPort: intstr.FromString(port.Name),
+				Protocol:   port.Protocol,
+			})
+		}
+	}
+	for _, c := range m.Spec.InitContainers {
+		spec.InitContainers = append(spec.InitContainers, buildContainer(c, names, resolveImage))
+	}
+	for _, v := range m.Spec.Volumes {
+		spec.Volumes = append(spec.Volumes, corev1.Volume{
+			Name: v.Name,
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{Medium: v.Medium, SizeLimit: v.SizeLimit},
+			},
+		})
+	}
+	return spec, exposed
+}
+
+// buildContainer 将 MyApp 中的容器定义转换为 Pod 容器，
+// 并显式填写 apiserver 会补上的默认值，避免每次协调都认为容器发生了变化
+func buildContainer(c myappv1.Container, names *portNamer, resolveImage func(string) string) corev1.Container {
+	container := corev1.Container{
+		Name:         c.Name,
+		Image:        resolveImage(c.Image),
+		Command:      c.Command,
+		Args:         c.Args,
+		Resources:    c.Resources,
+		VolumeMounts: c.VolumeMounts,
+	}
+	for _, env := range c.Env {
+		if env.ValueFrom != nil && env.ValueFrom.FieldRef != nil && env.ValueFrom.FieldRef.APIVersion == "" {
+			env = *env.DeepCopy()
+			env.ValueFrom.FieldRef.APIVersion = "v1"
+		}
+		container.Env = append(container.Env, env)
+	}
+	for _, p := range c.Ports {
+		container.Ports = append(container.Ports, corev1.ContainerPort{
+			Name:          names.name(p.Name, c.Name, p.ContainerPort),
+			ContainerPort: p.ContainerPort,
+			Protocol:      protocolOrDefault(p.Protocol),
+		})
+	}
+	return container
+}
+
+// probeWithDefaults 返回填写了 apiserver 默认值的探针副本，避免每次协调都认为探针发生了变化
+func probeWithDefaults(p *corev1.Probe) *corev1.Probe {
+	if p == nil {
+		return nil
+	}
+	p = p.DeepCopy()
+	if p.TimeoutSeconds == 0 {
+		p.TimeoutSeconds = 1
+	}
+	if p.PeriodSeconds == 0 {
+		p.PeriodSeconds = 10
+	}
+	if p.SuccessThreshold == 0 {
+		p.SuccessThreshold = 1
+	}
+	if p.FailureThreshold == 0 {
+		p.FailureThreshold = 3
+	}
+	if p.HTTPGet != nil && p.HTTPGet.Scheme == "" {
+		p.HTTPGet.Scheme = corev1.URISchemeHTTP
+	}
+	return p
+}
+
+// protocolOrDefault 返回端口协议，未指定时为 TCP
+func protocolOrDefault(p corev1.Protocol) corev1.Protocol {
+	if p == "" {
+		return corev1.ProtocolTCP
+	}
+	return p
+}
+
+// portNamer 为 Pod 内的端口分配唯一且合法的名称
+type portNamer struct {
+	used map[string]bool
+}
+
+func newPortNamer() *portNamer {
+	return &portNamer{used: map[string]bool{}}
+}
+
+// name 优先使用 requested，为空或已被使用时根据容器名和端口号生成，例如 proxy-9901
+func (n *portNamer) name(requested, container string, port int32) string {
+	if requested != "" && !n.used[requested] {
+		n.used[requested] = true
+		return requested
+	}
+
+	suffix := fmt.Sprintf("-%d", port)
+	prefix := container
+	for strings.Contains(prefix, "--") {
+		prefix = strings.ReplaceAll(prefix, "--", "-")
+	}
+	if len(prefix)+len(suffix) > maxPortNameLength {
+		prefix = prefix[:maxPortNameLength-len(suffix)]
+	}
+	prefix = strings.TrimRight(prefix, "-")
+	// 端口名称至少包含一个字母
+	if !strings.ContainsAny(prefix, "abcdefghijklmnopqrstuvwxyz") {
+		prefix = "p"
+	}
+
+	candidate := prefix + suffix
+	for i := 1; n.used[candidate]; i++ {
+		candidate = fmt.Sprintf("p%d-%d", port, i)
+	}
+	n.used[candidate] = true
+	return candidate
+}
+
+// syncContainers 按名称将期望的容器同步到已存在的容器列表：
+// 只比较控制器设置的字段，保留 apiserver 填写的其他默认值，删除不再需要的容器。有变化时返回 true
+func syncContainers(found *[]corev1.Container, desired []corev1.Container) bool {
+	existing := make(map[string]corev1.Container, len(*found))
+	for _, c := range *found {
+		existing[c.Name] = c
+	}
+
+	changed := len(*found) != len(desired)
+	out := make([]corev1.Container, 0, len(desired))
+	for i, d := range desired {
+		c, ok := existing[d.Name]
+		if !ok {
+			out = append(out, d)
+			changed = true
+			continue
+		}
+		if i >= len(*found) || (*found)[i].Name != d.Name {
+			changed = true
+		}
+		if !containerMatches(c, d) {
+			c.Image, c.Command, c.Args, c.Env = d.Image, d.Command, d.Args, d.Env
+			c.Ports, c.Resources, c.VolumeMounts = d.Ports, d.Resources, d.VolumeMounts
+			c.ReadinessProbe, c.LivenessProbe = d.ReadinessProbe, d.LivenessProbe
+			c.SecurityContext = d.SecurityContext
+			changed = true
+		}
+		out = append(out, c)
+	}
+	if changed {
+		*found = out
+	}
+	return changed
+}
+
+// containerMatches 判断容器中由控制器设置的字段是否与期望一致
+func containerMatches(c, d corev1.Container) bool {
+	return c.Image == d.Image &&
+		equality.Semantic.DeepEqual(c.Command, d.Command) &&
+		equality.Semantic.DeepEqual(c.Args, d.Args) &&
+		equality.Semantic.DeepEqual(c.Env, d.Env) &&
+		equality.Semantic.DeepEqual(c.Ports, d.Ports) &&
+		equality.Semantic.DeepEqual(c.Resources, d.Resources) &&
+		equality.Semantic.DeepEqual(c.VolumeMounts, d.VolumeMounts) &&
+		equality.Semantic.DeepEqual(c.ReadinessProbe, d.ReadinessProbe) &&
+		equality.Semantic.DeepEqual(c.LivenessProbe, d.LivenessProbe) &&
+		equality.Semantic.DeepEqual(c.SecurityContext, d.SecurityContext)
+}
+
+// syncScheduling 将期望 Pod 的调度配置同步到已存在的 Pod 模板，有变化时返回 true。
+// 空列表与 nil 视为相同，避免 apiserver 省略空字段后反复更新
+func syncScheduling(found, desired *corev1.PodSpec) bool {
+	changed := false
+	if !equality.Semantic.DeepEqual(found.NodeSelector, desired.NodeSelector) {
+		found.NodeSelector = desired.NodeSelector
+		changed = true
+	}
+	if !equality.Semantic.DeepEqual(found.Tolerations, desired.Tolerations) {
+		found.Tolerations = desired.Tolerations
+		changed = true
+	}
+	if !equality.Semantic.DeepEqual(found.Affinity, desired.Affinity) {
+		found.Affinity = desired.Affinity
+		changed = true
+	}
+	if found.PriorityClassName != desired.PriorityClassName {
+		found.PriorityClassName = desired.PriorityClassName
+		changed = true
+	}
+	if !equality.Semantic.DeepEqual(found.RuntimeClassName, desired.RuntimeClassName) {
+		found.RuntimeClassName = desired.RuntimeClassName
+		changed = true
+	}
+	return changed
+}
@@ -0,0 +1,129 @@
+package controller
+
+import (
+	"strings"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+
+	myappv1 "github.com/example/myapp-controller/pkg/apis/example/v1"
+)
+
+func TestPortNamer(t *testing.T) {
+	n := newPortNamer()
+	tests := []struct {
+		requested string
+		container string
+		port      int32
+		want      string
+	}{
+		{requested: "http", container: "app", port: 8080, want: "http"},
+		// 重名时根据容器名生成
+		{requested: "http", container: "proxy", port: 8443, want: "proxy-8443"},
+		{container: "proxy", port: 9901, want: "proxy-9901"},
+		// 超过 15 个字符时截断容器名
+		{container: "very-long-sidecar-name", port: 65535, want: "very-long-65535"},
+		{container: "a--b", port: 80, want: "a-b-80"},
+		{container: "123", port: 80, want: "p-80"},
+		// 生成的名称也重名时使用序号
+		{container: "proxy", port: 9901, want: "p9901-1"},
+	}
+	for _, tc := range tests {
+		got := n.name(tc.requested, tc.container, tc.port)
+		if got != tc.want {
+			t.Errorf("name(%q, %q, %d) = %q, want %q", tc.requested, tc.container, tc.port, got, tc.want)
+		}
+		if len(got) > maxPortNameLength {
+			t.Errorf("name %q is longer than %d characters", got, maxPortNameLength)
+		}
+	}
+}
+
+func TestValidateSpec(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(*myappv1.MyAppSpec)
+		want   string
+	}{
+		{name: "valid", mutate: func(s *myappv1.MyAppSpec) {
+			s.Volumes = []myappv1.SharedVolume{{Name: "data"}}
+			s.VolumeMounts = []corev1.VolumeMount{{Name: "data", MountPath: "/data"}}
+			s.Sidecars = []myappv1.Container{{Name: "proxy", Ports: []myappv1.ContainerPort{{ContainerPort: 8443, Expose: true}}}}
+			s.InitContainers = []myappv1.Container{{Name: "migrate", VolumeMounts: []corev1.VolumeMount{{Name: "data", MountPath: "/data"}}}}
+		}},
+		{name: "reserved name", mutate: func(s *myappv1.MyAppSpec) {
+			s.Sidecars = []myappv1.Container{{Name: "app"}}
+		}, want: "reserved"},
+		{name: "duplicate name across sidecars and init containers", mutate: func(s *myappv1.MyAppSpec) {
+			s.Sidecars = []myappv1.Container{{Name: "proxy"}}
+			s.InitContainers = []myappv1.Container{{Name: "proxy"}}
+		}, want: "used more than once"},
+		{name: "undefined volume", mutate: func(s *myappv1.MyAppSpec) {
+			s.Sidecars = []myappv1.Container{{Name: "shipper", VolumeMounts: []corev1.VolumeMount{{Name: "logs", MountPath: "/logs"}}}}
+		}, want: "undefined volume"},
+		{name: "duplicate volume", mutate: func(s *myappv1.MyAppSpec) {
+			s.Volumes = []myappv1.SharedVolume{{Name: "data"}, {Name: "data"}}
+		}, want: "more than once"},
+		{name: "exposed port collides with the main service port", mutate: func(s *myappv1.MyAppSpec) {
+			s.Sidecars = []myappv1.Container{{Name: "proxy", Ports: []myappv1.ContainerPort{{ContainerPort: 80, Expose: true}}}}
+		}, want: "already exposed"},
+		{name: "hook without containers", mutate: func(s *myappv1.MyAppSpec) {
+			s.Hooks = &myappv1.Hooks{PostDeploy: &batchv1.JobSpec{}}
+		}, want: "PostDeploy hook has no containers"},
+		{name: "non-resource rule", mutate: func(s *myappv1.MyAppSpec) {
+			s.ServiceAccount = &myappv1.ServiceAccountSpec{Rules: []rbacv1.PolicyRule{{NonResourceURLs: []string{"/healthz"}, Verbs: []string{"get"}}}}
+		}, want: "nonResourceURLs"},
+		{name: "empty ingress peer", mutate: func(s *myappv1.MyAppSpec) {
+			s.NetworkPolicy = &myappv1.NetworkPolicySpec{Ingress: []myappv1.NetworkPeer{{}}}
+		}, want: "must list apps, namespaces or cidrs"},
+		{name: "invalid cidr", mutate: func(s *myappv1.MyAppSpec) {
+			s.NetworkPolicy = &myappv1.NetworkPolicySpec{Egress: []myappv1.NetworkEgressRule{{NetworkPeer: myappv1.NetworkPeer{CIDRs: []string{"10.0.0.1"}}}}}
+		}, want: "invalid cidr"},
+		{name: "depends on itself", mutate: func(s *myappv1.MyAppSpec) {
+			s.DependsOn = []myappv1.Dependency{{Name: "web", Namespace: "default"}}
+		}, want: "itself"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			app := newMyApp("default", "web", 1)
+			tc.mutate(&app.Spec)
+			err := validateSpec(app)
+			if tc.want == "" {
+				if err != nil {
+					t.Fatalf("validateSpec() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("validateSpec() error = %v, want it to contain %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestSyncContainers(t *testing.T) {
+	desired := []corev1.Container{
+		{Name: "app", Image: "web:v2"},
+		{Name: "proxy", Image: "envoy:v1", Args: []string{"--log-level", "info"}},
+	}
+	// apiserver 填写的默认值需要保留
+	found := []corev1.Container{
+		{Name: "app", Image: "web:v1", TerminationMessagePath: "/dev/termination-log"},
+		{Name: "old-sidecar", Image: "shipper:v1"},
+	}
+
+	if !syncContainers(&found, desired) {
+		t.Fatalf("expected a change")
+	}
+	if len(found) != 2 || found[0].Name != "app" || found[1].Name != "proxy" {
+		t.Fatalf("containers = %+v, want app and proxy", found)
+	}
+	if found[0].Image != "web:v2" || found[0].TerminationMessagePath != "/dev/termination-log" {
+		t.Errorf("app container = %+v, want the new image and the defaulted termination message path", found[0])
+	}
+	if syncContainers(&found, desired) {
+		t.Errorf("expected no change after syncing")
+	}
+}
@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"strings"
+	"sync/atomic"
+)
+
+// RuntimeDefaults 保存可以在运行时修改的 MyApp 默认值，可被多个 Reconcile 并发读取
+type RuntimeDefaults struct {
+	imageRegistry   atomic.Pointer[string]
+	securityProfile atomic.Pointer[SecurityProfile]
+}
+
+// SetImageRegistry 设置镜像未指定仓库时使用的默认仓库，为空表示不改写镜像
+func (d *RuntimeDefaults) SetImageRegistry(registry string) {
+	d.imageRegistry.Store(&registry)
+}
+
+// ImageRegistry 返回当前的默认镜像仓库
+func (d *RuntimeDefaults) ImageRegistry() string {
+	if d == nil {
+		return ""
+	}
+	if p := d.imageRegistry.Load(); p != nil {
+		return *p
+	}
+	return ""
+}
+
+// ResolveImage 返回应用默认值后的镜像，d 为 nil 时原样返回
+func (d *RuntimeDefaults) ResolveImage(image string) string {
+	return applyImageRegistry(d.ImageRegistry(), image)
+}
+
+// SetSecurityProfile 设置 MyApp 未设置 spec.security 字段时使用的安全配置档，为空表示 none
+func (d *RuntimeDefaults) SetSecurityProfile(profile string) {
+	p := SecurityProfile(profile)
+	if p == "" {
+		p = SecurityProfileNone
+	}
+	d.securityProfile.Store(&p)
+}
+
+// SecurityProfile 返回当前的默认安全配置档，d 为 nil 或未设置时为 none，不改变升级前已有的 Pod 模板
+func (d *RuntimeDefaults) SecurityProfile() SecurityProfile {
+	if d == nil {
+		return SecurityProfileNone
+	}
+	if p := d.securityProfile.Load(); p != nil {
+		return *p
+	}
+	return SecurityProfileNone
+}
+
+// applyImageRegistry 在镜像没有指定仓库时加上 registry 前缀。
+// 与 docker 的规则一致：第一段包含 "."、":" 或等于 localhost 时视为仓库地址。
+func applyImageRegistry(registry, image string) string {
+	if registry == "" || image == "" {
+		return image
+	}
+	if first, _, found := strings.Cut(image, "/"); found &&
+		(strings.ContainsAny(first, ".:") || first == "localhost") {
+		return image
+	}
+	return registry + "/" + image
+}
@@ -0,0 +1,55 @@
+package controller
+
+import "testing"
+
+func TestApplyImageRegistry(t *testing.T) {
+	tests := []struct {
+		registry, image, want string
+	}{
+		{registry: "", image: "nginx:1.25", want: "nginx:1.25"},
+		{registry: "registry.example.com", image: "nginx:1.25", want: "registry.example.com/nginx:1.25"},
+		{registry: "registry.example.com/library", image: "team/app:v1", want: "registry.example.com/library/team/app:v1"},
+		{registry: "registry.example.com", image: "ghcr.io/team/app:v1", want: "ghcr.io/team/app:v1"},
+		{registry: "registry.example.com", image: "localhost:5000/app", want: "localhost:5000/app"},
+		{registry: "registry.example.com", image: "localhost/app", want: "localhost/app"},
+	}
+	for _, tc := range tests {
+		if got := applyImageRegistry(tc.registry, tc.image); got != tc.want {
+			t.Errorf("applyImageRegistry(%q, %q) = %q, want %q", tc.registry, tc.image, got, tc.want)
+		}
+	}
+}
+
+func TestRuntimeDefaultsResolveImage(t *testing.T) {
+	var nilDefaults *RuntimeDefaults
+	if got := nilDefaults.ResolveImage("nginx"); got != "nginx" {
+		t.Errorf("nil defaults changed the image to %q", got)
+	}
+
+	d := &RuntimeDefaults{}
+	d.SetImageRegistry("registry.example.com")
+	if got := d.ResolveImage("nginx"); got != "registry.example.com/nginx" {
+		t.Errorf("ResolveImage() = %q", got)
+	}
+	d.SetImageRegistry("")
+	if got := d.ResolveImage("nginx"); got != "nginx" {
+		t.Errorf("ResolveImage() after clearing registry = %q", got)
+	}
+}
+
+func TestRuntimeDefaultsSecurityProfile(t *testing.T) {
+	var nilDefaults *RuntimeDefaults
+	if got := nilDefaults.SecurityProfile(); got != SecurityProfileNone {
+		t.Errorf("nil defaults profile = %q, want none", got)
+	}
+
+	d := &RuntimeDefaults{}
+	d.SetSecurityProfile("hardened")
+	if got := d.SecurityProfile(); got != SecurityProfileHardened {
+		t.Errorf("SecurityProfile() = %q, want hardened", got)
+	}
+	d.SetSecurityProfile("")
+	if got := d.SecurityProfile(); got != SecurityProfileNone {
+		t.Errorf("SecurityProfile() after clearing = %q, want none", got)
+	}
+}
@@ -0,0 +1,205 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	myappv1 "github.com/example/myapp-controller/pkg/apis/example/v1"
+	"github.com/example/myapp-controller/pkg/logging"
+)
+
+// dependsOnIndex 是 MyApp 按依赖建立的缓存索引，值为依赖的 namespace/name
+const dependsOnIndex = "spec.dependsOn"
+
+// DependenciesReady 状况的原因，存在依赖环时为 reasonDependencyCycle
+const (
+	reasonDependenciesAvailable = "DependenciesAvailable"
+	reasonDependencyNotReady    = "DependencyNotReady"
+	reasonDependencyNotFound    = "DependencyNotFound"
+	reasonDependencyForbidden   = "DependencyForbidden"
+)
+
+// dependencyRecheckInterval 是等待依赖时重新检查的间隔。
+// 依赖可能不在本实例的缓存中（其他分片或未 watch 的命名空间），它的变化不会触发协调
+const dependencyRecheckInterval = 30 * time.Second
+
+// dependencyKey 返回依赖的 MyApp，未指定命名空间时与依赖方相同
+func dependencyKey(m *myappv1.MyApp, dep myappv1.Dependency) types.NamespacedName {
+	ns := dep.Namespace
+	if ns == "" {
+		ns = m.Namespace
+	}
+	return types.NamespacedName{Namespace: ns, Name: dep.Name}
+}
+
+// indexDependsOn 为 dependsOnIndex 提取 MyApp 的所有依赖
+func indexDependsOn(obj client.Object) []string {
+	m, ok := obj.(*myappv1.MyApp)
+	if !ok {
+		return nil
+	}
+	var keys []string
+	for _, dep := range m.Spec.DependsOn {
+		keys = append(keys, dependencyKey(m, dep).String())
+	}
+	return keys
+}
+
+// dependentsOf 返回依赖 obj 的所有 MyApp，依赖变化时重新协调它们
+func (r *MyAppReconciler) dependentsOf(ctx context.Context, obj client.Object) []reconcile.Request {
+	var dependents myappv1.MyAppList
+	if err := r.List(ctx, &dependents, client.MatchingFields{dependsOnIndex: client.ObjectKeyFromObject(obj).String()}); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list dependent MyApps", logging.KeyAction, actionGet, logging.KeyResource, "MyApp")
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(dependents.Items))
+	for _, m := range dependents.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&m)})
+	}
+	return requests
+}
+
+// dependencyReader 在一次协调中读取依赖的 MyApp，每个依赖最多读取一次。
+// 先读取缓存，缓存中没有时（其他分片或未 watch 的命名空间）再从 apiserver 读取
+type dependencyReader struct {
+	r     *MyAppReconciler
+	found map[types.NamespacedName]*myappv1.MyApp
+	errs  map[types.NamespacedName]error
+}
+
+func (r *MyAppReconciler) newDependencyReader() *dependencyReader {
+	return &dependencyReader{r: r, found: map[types.NamespacedName]*myappv1.MyApp{}, errs: map[types.NamespacedName]error{}}
+}
+
+// get 返回依赖的 MyApp，不存在时返回 NotFound，没有权限读取时返回 Forbidden
+func (d *dependencyReader) get(ctx context.Context, key types.NamespacedName) (*myappv1.MyApp, error) {
+	if app, ok := d.found[key]; ok {
+		return app, nil
+	}
+	if err, ok := d.errs[key]; ok {
+		return nil, err
+	}
+	app := &myappv1.MyApp{}
+	err := d.r.Get(ctx, key, app)
+	if err != nil {
+		err = d.r.apiReader().Get(ctx, key, app)
+	}
+	if err != nil {
+		d.errs[key] = err
+		return nil, err
+	}
+	d.found[key] = app
+	return app, nil
+}
+
+// dependenciesCondition 检查 MyApp 的依赖是否全部可用（处于 Running 且已协调最新的规格），
+// 并在第一次检查、MyApp 的规格变化或上次检测到依赖环时检测包含该 MyApp 的依赖环。
+// 环上其他 MyApp 的规格未变化时不再遍历，它们因依赖不可用而等待。
+// 存在依赖环时同时返回状况和 permanentError，修改环中任意一个 MyApp 才能解决
+func (r *MyAppReconciler) dependenciesCondition(ctx context.Context, m *myappv1.MyApp) (metav1.Condition, error) {
+	cond := metav1.Condition{Type: myappv1.ConditionDependenciesReady, ObservedGeneration: m.Generation}
+	deps := r.newDependencyReader()
+
+	previous := meta.FindStatusCondition(m.Status.Conditions, myappv1.ConditionDependenciesReady)
+	if previous == nil || previous.Reason == reasonDependencyCycle || m.Generation != m.Status.ObservedGeneration {
+		cycle, err := dependencyCycle(ctx, deps, m)
+		if err != nil {
+			return cond, err
+		}
+		if len(cycle) > 0 {
+			path := strings.Join(cycle, " -> ")
+			cond.Status = metav1.ConditionFalse
+			cond.Reason = reasonDependencyCycle
+			cond.Message = fmt.Sprintf("依赖形成环: %s", path)
+			return cond, &permanentError{msg: fmt.Sprintf("dependsOn forms a cycle: %s", path)}
+		}
+	}
+
+	var missing, forbidden, notReady []string
+	for _, dep := range m.Spec.DependsOn {
+		key := dependencyKey(m, dep)
+		found, err := deps.get(ctx, key)
+		switch {
+		case errors.IsNotFound(err):
+			missing = append(missing, key.String())
+		case errors.IsForbidden(err):
+			forbidden = append(forbidden, key.String())
+		case err != nil:
+			return cond, err
+		case !myAppAvailable(found):
+			phase := found.Status.Phase
+			switch {
+			case phase == "":
+				phase = "Pending"
+			case phase == "Running":
+				// 规格刚修改、尚未协调的依赖仍然报告旧的状态
+				phase = "Running，最新的规格尚未协调"
+			}
+			notReady = append(notReady, fmt.Sprintf("%s (%s)", key, phase))
+		}
+	}
+
+	switch {
+	case len(forbidden) > 0:
+		cond.Status = metav1.ConditionFalse
+		cond.Reason = reasonDependencyForbidden
+		cond.Message = fmt.Sprintf("控制器没有读取依赖的权限: %s", strings.Join(forbidden, ", "))
+	case len(missing) > 0:
+		cond.Status = metav1.ConditionFalse
+		cond.Reason = reasonDependencyNotFound
+		cond.Message = fmt.Sprintf("等待依赖创建: %s", strings.Join(missing, ", "))
+	case len(notReady) > 0:
+		cond.Status = metav1.ConditionFalse
+		cond.Reason = reasonDependencyNotReady
+		cond.Message = fmt.Sprintf("等待依赖就绪: %s", strings.Join(notReady, ", "))
+	default:
+		cond.Status = metav1.ConditionTrue
+		cond.Reason = reasonDependenciesAvailable
+		cond.Message = "所有依赖都处于 Running 并已协调最新的规格"
+	}
+	return cond, nil
+}
+
+// dependencyCycle 从 MyApp 出发沿 spec.dependsOn 深度优先遍历，返回回到该 MyApp 的路径；
+// 不存在或没有权限读取的依赖（由 DependenciesReady 状况报告）和不包含该 MyApp 的环都会被跳过
+func dependencyCycle(ctx context.Context, deps *dependencyReader, m *myappv1.MyApp) ([]string, error) {
+	start := client.ObjectKeyFromObject(m)
+	visited := map[types.NamespacedName]bool{start: true}
+
+	var visit func(app *myappv1.MyApp, path []string) ([]string, error)
+	visit = func(app *myappv1.MyApp, path []string) ([]string, error) {
+		for _, dep := range app.Spec.DependsOn {
+			key := dependencyKey(app, dep)
+			if key == start {
+				return append(path, key.String()), nil
+			}
+			if visited[key] {
+				continue
+			}
+			visited[key] = true
+
+			next, err := deps.get(ctx, key)
+			if err != nil {
+				if errors.IsNotFound(err) || errors.IsForbidden(err) {
+					continue
+				}
+				return nil, err
+			}
+			if cycle, err := visit(next, append(path, key.String())); err != nil || cycle != nil {
+				return cycle, err
+			}
+		}
+		return nil, nil
+	}
+	return visit(m, []string{start.String()})
+}
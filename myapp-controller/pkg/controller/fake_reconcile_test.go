@@ -0,0 +1,1070 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	uberzap "go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	appsv1 "k8s.io/api/apps/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	myappv1 "github.com/example/myapp-controller/pkg/apis/example/v1"
+	"github.com/example/myapp-controller/pkg/features"
+	"github.com/example/myapp-controller/pkg/logging"
+)
+
+// fakeHarness 使用 fake client 直接驱动 Reconcile，不需要 apiserver
+type fakeHarness struct {
+	t          *testing.T
+	client     client.Client
+	reconciler *MyAppReconciler
+}
+
+// newFakeHarness 创建包含给定对象的 fake client 和 MyAppReconciler
+func newFakeHarness(t *testing.T, objs ...client.Object) *fakeHarness {
+	t.Helper()
+	return newFakeHarnessWithInterceptor(t, interceptor.Funcs{}, objs...)
+}
+
+// newFakeHarnessWithInterceptor 与 newFakeHarness 相同，但允许拦截 client 调用以注入错误
+func newFakeHarnessWithInterceptor(t *testing.T, funcs interceptor.Funcs, objs ...client.Object) *fakeHarness {
+	t.Helper()
+	s := newTestScheme()
+	c := fake.NewClientBuilder().
+		WithScheme(s).
+		WithObjects(objs...).
+		WithStatusSubresource(&myappv1.MyApp{}, &appsv1.Deployment{}, &batchv1.Job{}).
+		WithIndex(&myappv1.MyApp{}, dependsOnIndex, indexDependsOn).
+		WithInterceptorFuncs(funcs).
+		Build()
+	return &fakeHarness{
+		t:          t,
+		client:     c,
+		reconciler: &MyAppReconciler{Client: c, Scheme: s},
+	}
+}
+
+// reconcile 对指定 MyApp 执行一次协调
+func (h *fakeHarness) reconcile(key types.NamespacedName) ctrl.Result {
+	h.t.Helper()
+	res, err := h.reconciler.Reconcile(context.Background(), ctrl.Request{NamespacedName: key})
+	if err != nil {
+		h.t.Fatalf("reconcile %s failed: %v", key, err)
+	}
+	return res
+}
+
+// reconcileN 连续执行 n 次协调，模拟 watch 事件触发的多轮协调
+func (h *fakeHarness) reconcileN(key types.NamespacedName, n int) {
+	h.t.Helper()
+	for i := 0; i < n; i++ {
+		h.reconcile(key)
+	}
+}
+
+// myApp 读取当前的 MyApp
+func (h *fakeHarness) myApp(key types.NamespacedName) *myappv1.MyApp {
+	h.t.Helper()
+	app := &myappv1.MyApp{}
+	if err := h.client.Get(context.Background(), key, app); err != nil {
+		h.t.Fatalf("failed to get MyApp %s: %v", key, err)
+	}
+	return app
+}
+
+// deployment 读取 MyApp 对应的 Deployment
+func (h *fakeHarness) deployment(key types.NamespacedName) *appsv1.Deployment {
+	h.t.Helper()
+	deploy := &appsv1.Deployment{}
+	if err := h.client.Get(context.Background(), key, deploy); err != nil {
+		h.t.Fatalf("failed to get Deployment %s: %v", key, err)
+	}
+	return deploy
+}
+
+// setDeploymentReady 模拟 Deployment 控制器上报就绪副本数
+func (h *fakeHarness) setDeploymentReady(key types.NamespacedName, ready int32) {
+	h.t.Helper()
+	deploy := h.deployment(key)
+	deploy.Status.Replicas = ready
+	deploy.Status.ReadyReplicas = ready
+	deploy.Status.AvailableReplicas = ready
+	if err := h.client.Status().Update(context.Background(), deploy); err != nil {
+		h.t.Fatalf("failed to update Deployment status: %v", err)
+	}
+}
+
+// setDeploymentRolledOut 模拟 Deployment 控制器将当前模板发布到 ready 个副本
+func (h *fakeHarness) setDeploymentRolledOut(key types.NamespacedName, ready int32) {
+	h.t.Helper()
+	deploy := h.deployment(key)
+	deploy.Status.ObservedGeneration = deploy.Generation
+	deploy.Status.Replicas = ready
+	deploy.Status.UpdatedReplicas = ready
+	deploy.Status.ReadyReplicas = ready
+	deploy.Status.AvailableReplicas = ready
+	if err := h.client.Status().Update(context.Background(), deploy); err != nil {
+		h.t.Fatalf("failed to update Deployment status: %v", err)
+	}
+}
+
+// finishJob 模拟 Job 控制器将 Job 标记为完成或失败
+func (h *fakeHarness) finishJob(namespace, name string, condition batchv1.JobConditionType) {
+	h.t.Helper()
+	job := &batchv1.Job{}
+	if err := h.client.Get(context.Background(), types.NamespacedName{Namespace: namespace, Name: name}, job); err != nil {
+		h.t.Fatalf("failed to get Job %s: %v", name, err)
+	}
+	now := metav1.Now()
+	job.Status.Conditions = append(job.Status.Conditions, batchv1.JobCondition{
+		Type: condition, Status: corev1.ConditionTrue, Reason: "Test", Message: "finished by test", LastTransitionTime: now,
+	})
+	if condition == batchv1.JobComplete {
+		job.Status.CompletionTime = &now
+	}
+	if err := h.client.Status().Update(context.Background(), job); err != nil {
+		h.t.Fatalf("failed to update Job status: %v", err)
+	}
+}
+
+// updateSpec 修改 MyApp 的规格
+func (h *fakeHarness) updateSpec(key types.NamespacedName, mutate func(*myappv1.MyAppSpec)) {
+	h.t.Helper()
+	app := h.myApp(key)
+	mutate(&app.Spec)
+	if err := h.client.Update(context.Background(), app); err != nil {
+		h.t.Fatalf("failed to update MyApp: %v", err)
+	}
+}
+
+// expectStatus 校验 MyApp 当前的阶段和就绪副本数
+func (h *fakeHarness) expectStatus(key types.NamespacedName, phase string, ready int32) {
+	h.t.Helper()
+	status := h.myApp(key).Status
+	if status.Phase != phase || status.ReadyReplicas != ready {
+		h.t.Fatalf("status is %s (%d ready), want %s (%d ready)", status.Phase, status.ReadyReplicas, phase, ready)
+	}
+}
+
+func TestFakeReconcileLifecycle(t *testing.T) {
+	app := newMyApp("default", "web", 2)
+	key := client.ObjectKeyFromObject(app)
+	h := newFakeHarness(t, app)
+
+	h.reconcile(key)
+
+	deploy := h.deployment(key)
+	if *deploy.Spec.Replicas != 2 {
+		t.Fatalf("deployment replicas = %d, want 2", *deploy.Spec.Replicas)
+	}
+	svc := &corev1.Service{}
+	if err := h.client.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "web-service"}, svc); err != nil {
+		t.Fatalf("service not created: %v", err)
+	}
+	h.expectStatus(key, "Pending", 0)
+
+	h.setDeploymentReady(key, 1)
+	h.reconcile(key)
+	h.expectStatus(key, "Pending", 1)
+
+	h.setDeploymentReady(key, 2)
+	h.reconcile(key)
+	h.expectStatus(key, "Running", 2)
+}
+
+func TestFakeReconcileSyncsDeploymentSpec(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(*myappv1.MyAppSpec)
+		check  func(*testing.T, *appsv1.Deployment)
+	}{
+		{
+			name:   "scale up",
+			mutate: func(s *myappv1.MyAppSpec) { s.Replicas = 5 },
+			check: func(t *testing.T, d *appsv1.Deployment) {
+				if *d.Spec.Replicas != 5 {
+					t.Errorf("replicas = %d, want 5", *d.Spec.Replicas)
+				}
+			},
+		},
+		{
+			name:   "image update",
+			mutate: func(s *myappv1.MyAppSpec) { s.Image = "nginx:1.27" },
+			check: func(t *testing.T, d *appsv1.Deployment) {
+				if image := d.Spec.Template.Spec.Containers[0].Image; image != "nginx:1.27" {
+					t.Errorf("image = %s, want nginx:1.27", image)
+				}
+			},
+		},
+		{
+			name: "scheduling",
+			mutate: func(s *myappv1.MyAppSpec) {
+				s.NodeSelector = map[string]string{"pool": "batch"}
+				s.Tolerations = []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "batch", Effect: corev1.TaintEffectNoSchedule}}
+				s.PriorityClassName = "batch-low"
+			},
+			check: func(t *testing.T, d *appsv1.Deployment) {
+				pod := d.Spec.Template.Spec
+				if pod.NodeSelector["pool"] != "batch" || len(pod.Tolerations) != 1 || pod.PriorityClassName != "batch-low" {
+					t.Errorf("pod spec = %+v, want the node selector, toleration and priority class", pod)
+				}
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			app := newMyApp("default", "web", 2)
+			key := client.ObjectKeyFromObject(app)
+			h := newFakeHarness(t, app)
+			h.reconcile(key)
+
+			h.setDeploymentReady(key, 2)
+			h.reconcile(key)
+			h.expectStatus(key, "Running", 2)
+
+			h.updateSpec(key, tc.mutate)
+			h.reconcile(key)
+			tc.check(t, h.deployment(key))
+		})
+	}
+}
+
+func TestFakeReconcileRevertsSchedulingDrift(t *testing.T) {
+	app := newMyApp("default", "web", 1)
+	runtimeClass := "gvisor"
+	app.Spec.NodeSelector = map[string]string{"pool": "batch"}
+	app.Spec.Affinity = &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+		RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+			MatchExpressions: []corev1.NodeSelectorRequirement{{Key: "gpu", Operator: corev1.NodeSelectorOpDoesNotExist}},
+		}}},
+	}}
+	app.Spec.RuntimeClassName = &runtimeClass
+	key := client.ObjectKeyFromObject(app)
+	h := newFakeHarness(t, app)
+	h.reconcile(key)
+
+	// 手动修改 Deployment 的调度配置后，下一次协调恢复为 MyApp 中的配置
+	deploy := h.deployment(key)
+	deploy.Spec.Template.Spec.NodeSelector = nil
+	deploy.Spec.Template.Spec.Affinity = nil
+	deploy.Spec.Template.Spec.Tolerations = []corev1.Toleration{{Operator: corev1.TolerationOpExists}}
+	if err := h.client.Update(context.Background(), deploy); err != nil {
+		t.Fatal(err)
+	}
+	h.reconcile(key)
+
+	pod := h.deployment(key).Spec.Template.Spec
+	if pod.NodeSelector["pool"] != "batch" || pod.Affinity == nil || pod.Tolerations != nil {
+		t.Fatalf("pod spec = %+v, want the scheduling configuration from MyApp", pod)
+	}
+	if pod.RuntimeClassName == nil || *pod.RuntimeClassName != "gvisor" {
+		t.Fatalf("runtimeClassName = %v, want gvisor", pod.RuntimeClassName)
+	}
+}
+
+func TestFakeReconcileSecurityCompliant(t *testing.T) {
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:   "restricted",
+		Labels: map[string]string{PodSecurityEnforceLabel: "restricted"},
+	}}
+	app := newMyApp("restricted", "web", 1)
+	key := client.ObjectKeyFromObject(app)
+	h := newFakeHarness(t, ns, app)
+
+	// 默认的 none 配置档不设置安全字段，升级时已有的 Pod 模板保持不变
+	h.reconcile(key)
+	if pod := h.deployment(key).Spec.Template.Spec; pod.SecurityContext != nil || pod.AutomountServiceAccountToken != nil {
+		t.Fatalf("pod spec = %+v, want no security fields with the none profile", pod)
+	}
+	cond := meta.FindStatusCondition(h.myApp(key).Status.Conditions, myappv1.ConditionSecurityCompliant)
+	if cond == nil || cond.Status != metav1.ConditionFalse {
+		t.Fatalf("condition = %+v, want SecurityCompliant=False", cond)
+	}
+
+	// hardened 配置档满足 restricted 级别
+	h.reconciler.Defaults = &RuntimeDefaults{}
+	h.reconciler.Defaults.SetSecurityProfile("hardened")
+	h.reconcile(key)
+	pod := h.deployment(key).Spec.Template.Spec
+	if pod.SecurityContext == nil || !ptr.Deref(pod.SecurityContext.RunAsNonRoot, false) || ptr.Deref(pod.AutomountServiceAccountToken, true) {
+		t.Fatalf("pod spec = %+v, want the hardened security defaults", pod)
+	}
+	cond = meta.FindStatusCondition(h.myApp(key).Status.Conditions, myappv1.ConditionSecurityCompliant)
+	if cond == nil || cond.Status != metav1.ConditionTrue {
+		t.Fatalf("condition = %+v, want SecurityCompliant=True", cond)
+	}
+
+	// 以 root 运行违反 restricted 级别，只报告状况，不阻止发布
+	h.updateSpec(key, func(s *myappv1.MyAppSpec) {
+		s.Security = &myappv1.SecuritySpec{RunAsNonRoot: ptr.To(false)}
+	})
+	h.reconcile(key)
+	cond = meta.FindStatusCondition(h.myApp(key).Status.Conditions, myappv1.ConditionSecurityCompliant)
+	if cond == nil || cond.Status != metav1.ConditionFalse || !strings.Contains(cond.Message, "runAsNonRoot") {
+		t.Fatalf("condition = %+v, want SecurityCompliant=False mentioning runAsNonRoot", cond)
+	}
+	if sc := h.deployment(key).Spec.Template.Spec.SecurityContext; sc == nil || ptr.Deref(sc.RunAsNonRoot, true) {
+		t.Fatalf("pod security context = %+v, want runAsNonRoot=false", sc)
+	}
+}
+
+func TestFakeReconcileHookSecurity(t *testing.T) {
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:   "restricted",
+		Labels: map[string]string{PodSecurityEnforceLabel: "restricted"},
+	}}
+	app := newMyApp("restricted", "web", 1)
+	app.Spec.Hooks = &myappv1.Hooks{PreDeploy: hookJobSpec("web-migrate:v1")}
+	key := client.ObjectKeyFromObject(app)
+	h := newFakeHarness(t, ns, app)
+	h.reconciler.Defaults = &RuntimeDefaults{}
+	h.reconciler.Defaults.SetSecurityProfile("hardened")
+
+	// 钩子 Job 的 Pod 同样使用 hardened 配置档
+	h.reconcile(key)
+	status := h.myApp(key).Status
+	job := &batchv1.Job{}
+	if err := h.client.Get(context.Background(), types.NamespacedName{Namespace: "restricted", Name: status.Hooks[0].JobName}, job); err != nil {
+		t.Fatal(err)
+	}
+	pod := job.Spec.Template.Spec
+	if pod.SecurityContext == nil || !ptr.Deref(pod.SecurityContext.RunAsNonRoot, false) || ptr.Deref(pod.AutomountServiceAccountToken, true) ||
+		!ptr.Deref(pod.Containers[0].SecurityContext.ReadOnlyRootFilesystem, false) {
+		t.Fatalf("hook pod spec = %+v, want the hardened security defaults", pod)
+	}
+	if cond := meta.FindStatusCondition(status.Conditions, myappv1.ConditionSecurityCompliant); cond == nil || cond.Status != metav1.ConditionTrue {
+		t.Fatalf("condition = %+v, want SecurityCompliant=True", cond)
+	}
+
+	// 钩子模板中显式设置的字段保持不变，违反命名空间级别时报告在状况中
+	h.updateSpec(key, func(s *myappv1.MyAppSpec) {
+		s.Hooks.PreDeploy.Template.Spec.Containers[0].SecurityContext = &corev1.SecurityContext{RunAsUser: ptr.To[int64](0)}
+	})
+	h.reconcile(key)
+	cond := meta.FindStatusCondition(h.myApp(key).Status.Conditions, myappv1.ConditionSecurityCompliant)
+	if cond == nil || cond.Status != metav1.ConditionFalse || !strings.Contains(cond.Message, `PreDeploy hook: container "hook" runAsUser is 0`) {
+		t.Fatalf("condition = %+v, want SecurityCompliant=False naming the PreDeploy hook", cond)
+	}
+}
+
+// allowAccessReviews 模拟 apiserver 处理 SelfSubjectAccessReview：控制器持有除 denied 以外所有资源的权限
+func allowAccessReviews(denied string) interceptor.Funcs {
+	return interceptor.Funcs{
+		Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+			if review, ok := obj.(*authorizationv1.SelfSubjectAccessReview); ok {
+				review.Status.Allowed = review.Spec.ResourceAttributes.Resource != denied
+				return nil
+			}
+			return c.Create(ctx, obj, opts...)
+		},
+	}
+}
+
+func TestFakeReconcileServiceAccount(t *testing.T) {
+	app := newMyApp("default", "web", 1)
+	app.Spec.ServiceAccount = &myappv1.ServiceAccountSpec{
+		Annotations: map[string]string{"iam.example.com/role": "web"},
+		Rules:       []rbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"configmaps"}, Verbs: []string{"get", "list"}}},
+	}
+	key := client.ObjectKeyFromObject(app)
+	h := newFakeHarnessWithInterceptor(t, allowAccessReviews("secrets"), app)
+	h.reconcile(key)
+
+	sa := &corev1.ServiceAccount{}
+	role := &rbacv1.Role{}
+	binding := &rbacv1.RoleBinding{}
+	for _, obj := range []client.Object{sa, role, binding} {
+		if err := h.client.Get(context.Background(), key, obj); err != nil {
+			t.Fatalf("failed to get %T: %v", obj, err)
+		}
+	}
+	if sa.Annotations["iam.example.com/role"] != "web" || len(role.Rules) != 1 || binding.Subjects[0].Name != "web" {
+		t.Fatalf("unexpected objects: %+v %+v %+v", sa, role.Rules, binding.Subjects)
+	}
+	pod := h.deployment(key).Spec.Template.Spec
+	if pod.ServiceAccountName != "web" || !ptr.Deref(pod.AutomountServiceAccountToken, false) {
+		t.Fatalf("pod spec uses service account %q with automount %v, want web with the token mounted", pod.ServiceAccountName, pod.AutomountServiceAccountToken)
+	}
+
+	// 从 spec 中删除的注解从 ServiceAccount 上移除，其他人添加的注解保持不变
+	sa.Annotations["eks.amazonaws.com/role-arn"] = "arn:aws:iam::123456789012:role/web"
+	if err := h.client.Update(context.Background(), sa); err != nil {
+		t.Fatalf("failed to annotate ServiceAccount: %v", err)
+	}
+	h.updateSpec(key, func(s *myappv1.MyAppSpec) {
+		s.ServiceAccount.Annotations = map[string]string{"iam.example.com/team": "shop"}
+	})
+	h.reconcile(key)
+	if err := h.client.Get(context.Background(), key, sa); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := sa.Annotations["iam.example.com/role"]; ok || sa.Annotations["iam.example.com/team"] != "shop" ||
+		sa.Annotations["eks.amazonaws.com/role-arn"] == "" || sa.Annotations[ManagedAnnotationsAnnotation] != "iam.example.com/team" {
+		t.Fatalf("annotations = %v, want only the removed key deleted", sa.Annotations)
+	}
+	h.updateSpec(key, func(s *myappv1.MyAppSpec) { s.ServiceAccount.Annotations = nil })
+	h.reconcile(key)
+	if err := h.client.Get(context.Background(), key, sa); err != nil {
+		t.Fatal(err)
+	}
+	if len(sa.Annotations) != 1 || sa.Annotations["eks.amazonaws.com/role-arn"] == "" {
+		t.Fatalf("annotations = %v, want only the annotation added by someone else", sa.Annotations)
+	}
+
+	// 控制器没有的权限不能授予应用，Role 保持不变
+	h.updateSpec(key, func(s *myappv1.MyAppSpec) {
+		s.ServiceAccount.Rules = append(s.ServiceAccount.Rules, rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get"}})
+	})
+	h.reconcile(key)
+	status := h.myApp(key).Status
+	if status.Phase != "Failed" || !strings.Contains(status.Message, "get secrets") {
+		t.Fatalf("status = %+v, want Failed naming the denied permission", status)
+	}
+	if err := h.client.Get(context.Background(), key, role); err != nil || len(role.Rules) != 1 {
+		t.Fatalf("role = %+v (%v), want the previous rules", role.Rules, err)
+	}
+
+	// 删除 spec.serviceAccount 后 Pod 改回 default，并删除创建的对象
+	h.updateSpec(key, func(s *myappv1.MyAppSpec) { s.ServiceAccount = nil })
+	h.reconcile(key)
+	if name := h.deployment(key).Spec.Template.Spec.ServiceAccountName; name != "" {
+		t.Fatalf("serviceAccountName = %q, want empty", name)
+	}
+	for _, obj := range []client.Object{&corev1.ServiceAccount{}, &rbacv1.Role{}, &rbacv1.RoleBinding{}} {
+		if err := h.client.Get(context.Background(), key, obj); !apierrors.IsNotFound(err) {
+			t.Errorf("%T still exists: %v", obj, err)
+		}
+	}
+}
+
+func TestFakeReconcileServiceAccountNotOwned(t *testing.T) {
+	existing := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"}}
+	app := newMyApp("default", "web", 1)
+	app.Spec.ServiceAccount = &myappv1.ServiceAccountSpec{}
+	key := client.ObjectKeyFromObject(app)
+	h := newFakeHarness(t, existing, app)
+
+	h.reconcile(key)
+	status := h.myApp(key).Status
+	if status.Phase != "Failed" || !strings.Contains(status.Message, "not owned") {
+		t.Fatalf("status = %+v, want Failed because the ServiceAccount belongs to someone else", status)
+	}
+	if err := h.client.Get(context.Background(), key, &appsv1.Deployment{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("deployment created without its ServiceAccount: %v", err)
+	}
+}
+
+func TestFakeReconcileNetworkPolicy(t *testing.T) {
+	app := newMyApp("default", "web", 1)
+	app.Spec.NetworkPolicy = &myappv1.NetworkPolicySpec{Ingress: []myappv1.NetworkPeer{{Apps: []string{"frontend"}}}}
+	key := client.ObjectKeyFromObject(app)
+	h := newFakeHarness(t, app)
+	h.reconcile(key)
+
+	policy := &networkingv1.NetworkPolicy{}
+	if err := h.client.Get(context.Background(), key, policy); err != nil {
+		t.Fatalf("failed to get NetworkPolicy: %v", err)
+	}
+	if !metav1.IsControlledBy(policy, h.myApp(key)) || policy.Spec.PodSelector.MatchLabels["app"] != "web" {
+		t.Fatalf("unexpected NetworkPolicy: %+v", policy)
+	}
+	if len(policy.Spec.PolicyTypes) != 1 || len(policy.Spec.Egress) != 0 {
+		t.Fatalf("policy types = %v, want egress unrestricted without egress rules", policy.Spec.PolicyTypes)
+	}
+
+	// 增加出站规则后同步到已有的 NetworkPolicy，手动修改会被恢复
+	h.updateSpec(key, func(s *myappv1.MyAppSpec) {
+		s.NetworkPolicy.Egress = []myappv1.NetworkEgressRule{{NetworkPeer: myappv1.NetworkPeer{CIDRs: []string{"10.0.0.0/8"}}}}
+	})
+	h.reconcile(key)
+	if err := h.client.Get(context.Background(), key, policy); err != nil {
+		t.Fatalf("failed to get NetworkPolicy: %v", err)
+	}
+	if len(policy.Spec.PolicyTypes) != 2 || len(policy.Spec.Egress) != 2 {
+		t.Fatalf("egress = %+v, want the DNS rule and the declared rule", policy.Spec.Egress)
+	}
+	policy.Spec.Ingress = nil
+	if err := h.client.Update(context.Background(), policy); err != nil {
+		t.Fatalf("failed to modify NetworkPolicy: %v", err)
+	}
+	h.reconcile(key)
+	if err := h.client.Get(context.Background(), key, policy); err != nil || len(policy.Spec.Ingress) != 1 {
+		t.Fatalf("ingress = %+v (%v), want the drift reverted", policy.Spec.Ingress, err)
+	}
+
+	h.updateSpec(key, func(s *myappv1.MyAppSpec) { s.NetworkPolicy = nil })
+	h.reconcile(key)
+	if err := h.client.Get(context.Background(), key, policy); !apierrors.IsNotFound(err) {
+		t.Fatalf("NetworkPolicy still exists after spec.networkPolicy was removed: %v", err)
+	}
+}
+
+func TestFakeReconcileDependsOn(t *testing.T) {
+	order := newMyApp("default", "order", 1)
+	order.Spec.DependsOn = []myappv1.Dependency{{Name: "payment"}}
+	orderKey := client.ObjectKeyFromObject(order)
+	h := newFakeHarness(t, order)
+
+	expectDependencies := func(status metav1.ConditionStatus, reason string) {
+		t.Helper()
+		cond := meta.FindStatusCondition(h.myApp(orderKey).Status.Conditions, myappv1.ConditionDependenciesReady)
+		if cond == nil || cond.Status != status || cond.Reason != reason {
+			t.Fatalf("DependenciesReady = %+v, want %s/%s", cond, status, reason)
+		}
+	}
+
+	// 依赖不存在时不创建 Deployment
+	h.reconcile(orderKey)
+	h.expectStatus(orderKey, "Pending", 0)
+	expectDependencies(metav1.ConditionFalse, reasonDependencyNotFound)
+	if err := h.client.Get(context.Background(), orderKey, &appsv1.Deployment{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("deployment created before its dependency exists: %v", err)
+	}
+
+	payment := newMyApp("default", "payment", 1)
+	paymentKey := client.ObjectKeyFromObject(payment)
+	if err := h.client.Create(context.Background(), payment); err != nil {
+		t.Fatalf("failed to create dependency: %v", err)
+	}
+	if got := h.reconciler.dependentsOf(context.Background(), payment); len(got) != 1 || got[0].NamespacedName != orderKey {
+		t.Fatalf("dependentsOf(payment) = %v, want order", got)
+	}
+	h.reconcile(paymentKey)
+	h.reconcile(orderKey)
+	expectDependencies(metav1.ConditionFalse, reasonDependencyNotReady)
+
+	h.setDeploymentReady(paymentKey, 1)
+	h.reconcile(paymentKey)
+	h.reconcile(orderKey)
+	expectDependencies(metav1.ConditionTrue, reasonDependenciesAvailable)
+	h.deployment(orderKey)
+
+	// 依赖不再就绪时已发布的版本继续同步副本数，新版本等待依赖
+	h.setDeploymentReady(paymentKey, 0)
+	h.reconcile(paymentKey)
+	h.updateSpec(orderKey, func(s *myappv1.MyAppSpec) { s.Replicas = 2 })
+	h.reconcile(orderKey)
+	if replicas := *h.deployment(orderKey).Spec.Replicas; replicas != 2 {
+		t.Fatalf("deployment replicas = %d, want 2", replicas)
+	}
+	h.updateSpec(orderKey, func(s *myappv1.MyAppSpec) { s.Image = "order:v2" })
+	h.reconcile(orderKey)
+	if image := h.deployment(orderKey).Spec.Template.Spec.Containers[0].Image; image == "order:v2" {
+		t.Fatalf("new revision rolled out while the dependency is not Running")
+	}
+	h.expectStatus(orderKey, "Pending", 0)
+	expectDependencies(metav1.ConditionFalse, reasonDependencyNotReady)
+
+	// 删除依赖后 DependenciesReady 状况被移除
+	h.updateSpec(orderKey, func(s *myappv1.MyAppSpec) { s.DependsOn = nil })
+	h.reconcile(orderKey)
+	if cond := meta.FindStatusCondition(h.myApp(orderKey).Status.Conditions, myappv1.ConditionDependenciesReady); cond != nil {
+		t.Fatalf("DependenciesReady = %+v, want it removed", cond)
+	}
+	if image := h.deployment(orderKey).Spec.Template.Spec.Containers[0].Image; image != "order:v2" {
+		t.Fatalf("image = %s, want order:v2 once the dependency is removed", image)
+	}
+}
+
+func TestFakeReconcileDependencyCycle(t *testing.T) {
+	a := newMyApp("default", "a", 1)
+	a.Spec.DependsOn = []myappv1.Dependency{{Name: "b"}}
+	b := newMyApp("default", "b", 1)
+	b.Spec.DependsOn = []myappv1.Dependency{{Name: "c"}}
+	c := newMyApp("default", "c", 1)
+	c.Spec.DependsOn = []myappv1.Dependency{{Name: "a"}}
+	key := client.ObjectKeyFromObject(a)
+	h := newFakeHarness(t, a, b, c)
+
+	if res := h.reconcile(key); res.RequeueAfter != 0 {
+		t.Fatalf("dependency cycle must not be retried, got %+v", res)
+	}
+	status := h.myApp(key).Status
+	if status.Phase != "Failed" || !strings.Contains(status.Message, "default/a -> default/b -> default/c -> default/a") {
+		t.Fatalf("status = %+v, want Failed naming the cycle", status)
+	}
+	if cond := meta.FindStatusCondition(status.Conditions, myappv1.ConditionDependenciesReady); cond == nil || cond.Reason != reasonDependencyCycle {
+		t.Fatalf("DependenciesReady = %+v, want %s", cond, reasonDependencyCycle)
+	}
+}
+
+func TestFakeReconcileCrossNamespaceDependency(t *testing.T) {
+	order := newMyApp("default", "order", 1)
+	order.Spec.DependsOn = []myappv1.Dependency{{Namespace: "finance", Name: "ledger"}, {Name: "payment"}}
+	ledger := newMyApp("finance", "ledger", 1)
+	ledger.Generation, ledger.Status.ObservedGeneration, ledger.Status.Phase = 1, 1, "Running"
+	payment := newMyApp("default", "payment", 1)
+	payment.Status.Phase = "Running"
+	key, ledgerKey := client.ObjectKeyFromObject(order), client.ObjectKeyFromObject(ledger)
+	h := newFakeHarness(t, order, ledger, payment)
+
+	// 模拟只 watch default 命名空间的缓存：读取其他命名空间的 MyApp 失败
+	var forbidden bool
+	apiReads := map[client.ObjectKey]int{}
+	h.reconciler.Client = interceptor.NewClient(h.client.(client.WithWatch), interceptor.Funcs{
+		Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+			if _, ok := obj.(*myappv1.MyApp); ok && key.Namespace != "default" {
+				return fmt.Errorf("unable to get: %s because of unknown namespace for the cache", key)
+			}
+			return c.Get(ctx, key, obj, opts...)
+		},
+	})
+	h.reconciler.APIReader = interceptor.NewClient(h.client.(client.WithWatch), interceptor.Funcs{
+		Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+			if _, ok := obj.(*myappv1.MyApp); ok {
+				apiReads[key]++
+			}
+			if forbidden && key.Namespace == "finance" {
+				return apierrors.NewForbidden(schema.GroupResource{Group: "example.com", Resource: "myapps"}, key.Name, fmt.Errorf("no access"))
+			}
+			return c.Get(ctx, key, obj, opts...)
+		},
+	})
+	expectDependencies := func(reason string) {
+		t.Helper()
+		if cond := meta.FindStatusCondition(h.myApp(key).Status.Conditions, myappv1.ConditionDependenciesReady); cond == nil || cond.Reason != reason {
+			t.Fatalf("DependenciesReady = %+v, want %s", cond, reason)
+		}
+	}
+
+	// 缓存中没有的依赖从 apiserver 读取，每次协调只读取一次；缓存中的依赖不读取 apiserver
+	h.reconcile(key)
+	expectDependencies(reasonDependenciesAvailable)
+	h.deployment(key)
+	if apiReads[ledgerKey] != 1 || apiReads[client.ObjectKeyFromObject(payment)] != 0 {
+		t.Fatalf("apiserver reads = %v, want one read of the dependency outside the cache", apiReads)
+	}
+
+	// 规格已修改、尚未协调的依赖不可用，即使仍然报告 Running
+	h.updateSpec(ledgerKey, func(s *myappv1.MyAppSpec) { s.Image = "ledger:v2" })
+	stale := h.myApp(ledgerKey)
+	stale.Generation = 2
+	if err := h.client.Update(context.Background(), stale); err != nil {
+		t.Fatal(err)
+	}
+	h.reconcile(key)
+	expectDependencies(reasonDependencyNotReady)
+	if msg := meta.FindStatusCondition(h.myApp(key).Status.Conditions, myappv1.ConditionDependenciesReady).Message; !strings.Contains(msg, "finance/ledger (Running，最新的规格尚未协调)") {
+		t.Fatalf("message = %q, want the stale dependency named", msg)
+	}
+
+	// 其他命名空间中的依赖环同样能被检测到，规格变化后才重新遍历
+	h.updateSpec(ledgerKey, func(s *myappv1.MyAppSpec) {
+		s.DependsOn = []myappv1.Dependency{{Namespace: "default", Name: "order"}}
+	})
+	h.reconcile(key)
+	expectDependencies(reasonDependencyNotReady)
+	bumped := h.myApp(key)
+	bumped.Generation++
+	if err := h.client.Update(context.Background(), bumped); err != nil {
+		t.Fatal(err)
+	}
+	h.reconcile(key)
+	if status := h.myApp(key).Status; status.Phase != "Failed" || !strings.Contains(status.Message, "default/order -> finance/ledger -> default/order") {
+		t.Fatalf("status = %+v, want Failed naming the cycle", status)
+	}
+
+	// 检测到依赖环之后每次协调都重新遍历，环被解开后恢复
+	h.updateSpec(ledgerKey, func(s *myappv1.MyAppSpec) { s.DependsOn = nil })
+	h.reconcile(key)
+	expectDependencies(reasonDependencyNotReady)
+
+	// 没有权限读取依赖时报告 DependencyForbidden，并定期重新检查
+	h.updateSpec(key, func(s *myappv1.MyAppSpec) { s.Image = "order:v2" })
+	forbidden = true
+	if res := h.reconcile(key); res.RequeueAfter != dependencyRecheckInterval {
+		t.Fatalf("result = %+v, want a recheck after %s", res, dependencyRecheckInterval)
+	}
+	expectDependencies(reasonDependencyForbidden)
+}
+
+func TestFakeReconcileNotFound(t *testing.T) {
+	h := newFakeHarness(t)
+	res := h.reconcile(types.NamespacedName{Namespace: "default", Name: "missing"})
+	if res.RequeueAfter != 0 {
+		t.Errorf("unexpected requeue for missing MyApp: %v", res)
+	}
+}
+
+func TestFakeReconcileSkipsUnchangedStatus(t *testing.T) {
+	app := newMyApp("default", "web", 1)
+	key := client.ObjectKeyFromObject(app)
+
+	statusWrites := 0
+	h := newFakeHarnessWithInterceptor(t, interceptor.Funcs{
+		SubResourcePatch: func(ctx context.Context, c client.Client, subResourceName string, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+			statusWrites++
+			return c.SubResource(subResourceName).Patch(ctx, obj, patch, opts...)
+		},
+	}, app)
+
+	h.reconcile(key)
+	if statusWrites != 1 {
+		t.Fatalf("status writes after first reconcile = %d, want 1", statusWrites)
+	}
+
+	// 没有任何变化时再次协调不应写入状态
+	h.reconcileN(key, 3)
+	if statusWrites != 1 {
+		t.Fatalf("status writes after idle reconciles = %d, want 1", statusWrites)
+	}
+
+	h.setDeploymentReady(key, 1)
+	h.reconcile(key)
+	if statusWrites != 2 {
+		t.Fatalf("status writes after readiness change = %d, want 2", statusWrites)
+	}
+	h.expectStatus(key, "Running", 1)
+}
+
+func TestFakeReconcileRetriesStatusConflict(t *testing.T) {
+	app := newMyApp("default", "web", 1)
+	key := client.ObjectKeyFromObject(app)
+
+	conflicts := 0
+	h := newFakeHarnessWithInterceptor(t, interceptor.Funcs{
+		SubResourcePatch: func(ctx context.Context, c client.Client, subResourceName string, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+			if conflicts < 2 {
+				conflicts++
+				return apierrors.NewConflict(myappv1.Resource("myapps").GroupResource(), obj.GetName(), fmt.Errorf("simulated conflict"))
+			}
+			return c.SubResource(subResourceName).Patch(ctx, obj, patch, opts...)
+		},
+	}, app)
+
+	h.reconcile(key)
+	if conflicts != 2 {
+		t.Fatalf("conflicts = %d, want 2", conflicts)
+	}
+	h.expectStatus(key, "Pending", 0)
+}
+
+func TestFakeReconcileAppliesImageRegistry(t *testing.T) {
+	app := newMyApp("default", "web", 1)
+	key := client.ObjectKeyFromObject(app)
+	h := newFakeHarness(t, app)
+	h.reconciler.Defaults = &RuntimeDefaults{}
+	h.reconciler.Defaults.SetImageRegistry("registry.example.com")
+
+	h.reconcile(key)
+	if image := h.deployment(key).Spec.Template.Spec.Containers[0].Image; image != "registry.example.com/nginx:1.25" {
+		t.Fatalf("image = %s, want registry.example.com/nginx:1.25", image)
+	}
+
+	// 热加载新的默认仓库后，下一次协调同步到 Deployment
+	h.reconciler.Defaults.SetImageRegistry("mirror.example.com")
+	h.reconcile(key)
+	if image := h.deployment(key).Spec.Template.Spec.Containers[0].Image; image != "mirror.example.com/nginx:1.25" {
+		t.Fatalf("image = %s, want mirror.example.com/nginx:1.25", image)
+	}
+}
+
+func TestFakeReconcileSidecars(t *testing.T) {
+	app := newMyApp("default", "web", 1)
+	key := client.ObjectKeyFromObject(app)
+	h := newFakeHarness(t, app)
+	h.reconcile(key)
+
+	h.updateSpec(key, func(s *myappv1.MyAppSpec) {
+		s.Sidecars = []myappv1.Container{{Name: "proxy", Image: "envoy:v1", Ports: []myappv1.ContainerPort{{ContainerPort: 9901, Expose: true}}}}
+		s.InitContainers = []myappv1.Container{{Name: "migrate", Image: "web:v1"}}
+	})
+	h.reconcile(key)
+	pod := h.deployment(key).Spec.Template.Spec
+	if len(pod.Containers) != 2 || pod.Containers[1].Name != "proxy" || pod.Containers[1].Ports[0].Name != "proxy-9901" {
+		t.Fatalf("containers = %+v, want app and proxy with port proxy-9901", pod.Containers)
+	}
+	if len(pod.InitContainers) != 1 || pod.InitContainers[0].Name != "migrate" {
+		t.Fatalf("init containers = %+v, want migrate", pod.InitContainers)
+	}
+	svc := &corev1.Service{}
+	svcKey := types.NamespacedName{Namespace: "default", Name: "web-service"}
+	if err := h.client.Get(context.Background(), svcKey, svc); err != nil {
+		t.Fatal(err)
+	}
+	if len(svc.Spec.Ports) != 2 || svc.Spec.Ports[0].Name != "http" || svc.Spec.Ports[1].Port != 9901 {
+		t.Fatalf("service ports = %+v, want http and the exposed proxy port", svc.Spec.Ports)
+	}
+
+	// 删除 sidecar 后同步删除容器
+	h.updateSpec(key, func(s *myappv1.MyAppSpec) { s.Sidecars = nil })
+	h.reconcile(key)
+	if containers := h.deployment(key).Spec.Template.Spec.Containers; len(containers) != 1 || containers[0].Name != "app" {
+		t.Fatalf("containers = %+v, want only app", containers)
+	}
+	if err := h.client.Get(context.Background(), svcKey, svc); err != nil {
+		t.Fatal(err)
+	}
+	if len(svc.Spec.Ports) != 1 || svc.Spec.Ports[0].Port != 80 {
+		t.Fatalf("service ports = %+v, want only port 80", svc.Spec.Ports)
+	}
+}
+
+func TestFakeReconcileInvalidSpec(t *testing.T) {
+	app := newMyApp("default", "web", 1)
+	app.Spec.Sidecars = []myappv1.Container{{Name: "app", Image: "envoy:v1"}}
+	key := client.ObjectKeyFromObject(app)
+	h := newFakeHarness(t, app)
+
+	h.reconcile(key)
+	status := h.myApp(key).Status
+	if status.Phase != "Failed" || !strings.Contains(status.Message, "reserved") {
+		t.Fatalf("status = %+v, want Failed with the validation error", status)
+	}
+	if err := h.client.Get(context.Background(), key, &appsv1.Deployment{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("deployment created for an invalid spec: %v", err)
+	}
+}
+
+// hookJobSpec 返回只包含一个容器的钩子 Job 规格
+func hookJobSpec(image string) *batchv1.JobSpec {
+	return &batchv1.JobSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+		Containers: []corev1.Container{{Name: "hook", Image: image}},
+	}}}
+}
+
+func TestFakeReconcilePreDeployHook(t *testing.T) {
+	app := newMyApp("default", "web", 1)
+	app.Spec.Hooks = &myappv1.Hooks{PreDeploy: hookJobSpec("web-migrate:v1")}
+	key := client.ObjectKeyFromObject(app)
+	h := newFakeHarness(t, app)
+
+	// 钩子完成前不创建 Deployment
+	h.reconcile(key)
+	status := h.myApp(key).Status
+	if status.Phase != "Pending" || len(status.Hooks) != 1 || status.Hooks[0].Phase != myappv1.HookRunning {
+		t.Fatalf("status = %+v, want Pending with a running PreDeploy hook", status)
+	}
+	if err := h.client.Get(context.Background(), key, &appsv1.Deployment{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("deployment created before the PreDeploy hook finished: %v", err)
+	}
+	job := &batchv1.Job{}
+	if err := h.client.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: status.Hooks[0].JobName}, job); err != nil {
+		t.Fatal(err)
+	}
+	if job.Spec.Template.Spec.RestartPolicy != corev1.RestartPolicyNever || job.Labels[ManagedByLabel] != ManagedByValue {
+		t.Errorf("job = %+v, want restartPolicy Never and the managed-by label", job.ObjectMeta)
+	}
+
+	h.finishJob("default", job.Name, batchv1.JobComplete)
+	h.reconcile(key)
+	deploy := h.deployment(key)
+	status = h.myApp(key).Status
+	if deploy.Annotations[RevisionAnnotation] != status.Revision || status.Hooks[0].Phase != myappv1.HookSucceeded {
+		t.Fatalf("revision = %q, status = %+v, want the deployment at the recorded revision and a succeeded hook", deploy.Annotations[RevisionAnnotation], status)
+	}
+
+	// 同一版本不会再次运行钩子
+	h.reconcileN(key, 2)
+	if hooks := h.myApp(key).Status.Hooks; len(hooks) != 1 {
+		t.Fatalf("hooks = %+v, want a single record", hooks)
+	}
+
+	// 钩子失败时中止新版本的发布
+	h.updateSpec(key, func(s *myappv1.MyAppSpec) { s.Image = "nginx:1.26" })
+	h.reconcile(key)
+	status = h.myApp(key).Status
+	if len(status.Hooks) != 2 {
+		t.Fatalf("hooks = %+v, want a second PreDeploy run", status.Hooks)
+	}
+	h.finishJob("default", status.Hooks[1].JobName, batchv1.JobFailed)
+	h.reconcileN(key, 2)
+	status = h.myApp(key).Status
+	if status.Phase != "Failed" || !strings.Contains(status.Message, "PreDeploy") {
+		t.Fatalf("status = %+v, want Failed because of the PreDeploy hook", status)
+	}
+	if image := h.deployment(key).Spec.Template.Spec.Containers[0].Image; image != "nginx:1.25" {
+		t.Fatalf("image = %q, want the rollout aborted at nginx:1.25", image)
+	}
+}
+
+func TestFakeReconcilePostDeployHook(t *testing.T) {
+	app := newMyApp("default", "web", 2)
+	app.Spec.Hooks = &myappv1.Hooks{PostDeploy: hookJobSpec("web-smoke:v1")}
+	key := client.ObjectKeyFromObject(app)
+	h := newFakeHarness(t, app)
+
+	// 发布完成前不运行钩子
+	h.reconcile(key)
+	h.setDeploymentReady(key, 2)
+	h.reconcile(key)
+	if hooks := h.myApp(key).Status.Hooks; len(hooks) != 0 {
+		t.Fatalf("hooks = %+v, want none before the rollout finished", hooks)
+	}
+
+	h.setDeploymentRolledOut(key, 2)
+	h.reconcile(key)
+	status := h.myApp(key).Status
+	if status.Phase != "Pending" || len(status.Hooks) != 1 || status.Hooks[0].Type != myappv1.HookPostDeploy {
+		t.Fatalf("status = %+v, want Pending with a running PostDeploy hook", status)
+	}
+
+	h.finishJob("default", status.Hooks[0].JobName, batchv1.JobFailed)
+	h.reconcile(key)
+	status = h.myApp(key).Status
+	if status.Phase != "Failed" || !strings.Contains(status.Message, "PostDeploy") {
+		t.Fatalf("status = %+v, want Failed because of the PostDeploy hook", status)
+	}
+}
+
+func TestFakeReconcileAdoptsUnlabeledObjects(t *testing.T) {
+	app := newMyApp("default", "web", 2)
+	key := client.ObjectKeyFromObject(app)
+	// 打上 ManagedByLabel 之前创建的 Deployment 和 Service
+	oldDeploy := (&MyAppReconciler{}).deploymentForMyApp(app)
+	oldSvc := (&MyAppReconciler{}).serviceForMyApp(app)
+	delete(oldDeploy.Labels, ManagedByLabel)
+	delete(oldSvc.Labels, ManagedByLabel)
+
+	s := newTestScheme()
+	apiserver := fake.NewClientBuilder().
+		WithScheme(s).
+		WithObjects(app, oldDeploy, oldSvc).
+		WithStatusSubresource(&myappv1.MyApp{}, &appsv1.Deployment{}, &batchv1.Job{}).
+		Build()
+	// 模拟按 ManagedByLabel 过滤的缓存：没有该标签的 Deployment 和 Service 读取时返回 NotFound
+	cached := interceptor.NewClient(apiserver, interceptor.Funcs{
+		Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+			if err := c.Get(ctx, key, obj, opts...); err != nil {
+				return err
+			}
+			switch obj.(type) {
+			case *appsv1.Deployment, *corev1.Service:
+				if obj.GetLabels()[ManagedByLabel] != ManagedByValue {
+					return apierrors.NewNotFound(schema.GroupResource{}, key.Name)
+				}
+			}
+			return nil
+		},
+	})
+	h := &fakeHarness{
+		t:          t,
+		client:     apiserver,
+		reconciler: &MyAppReconciler{Client: cached, Scheme: s, APIReader: apiserver},
+	}
+
+	h.reconcile(key)
+	deploy := h.deployment(key)
+	if deploy.Labels[ManagedByLabel] != ManagedByValue {
+		t.Errorf("deployment labels = %v, want %s=%s", deploy.Labels, ManagedByLabel, ManagedByValue)
+	}
+	if _, ok := deploy.Spec.Selector.MatchLabels[ManagedByLabel]; ok {
+		t.Errorf("managed-by label must not be added to the immutable selector")
+	}
+	svc := &corev1.Service{}
+	if err := h.client.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "web-service"}, svc); err != nil {
+		t.Fatal(err)
+	}
+	if svc.Labels[ManagedByLabel] != ManagedByValue {
+		t.Errorf("service labels = %v, want %s=%s", svc.Labels, ManagedByLabel, ManagedByValue)
+	}
+
+	// 补上标签后对象出现在缓存中，后续协调不再修改
+	rv := deploy.ResourceVersion
+	h.reconcile(key)
+	if h.deployment(key).ResourceVersion != rv {
+		t.Errorf("deployment updated again after adoption")
+	}
+}
+
+func TestFakeReconcileServerSideApply(t *testing.T) {
+	app := newMyApp("default", "web", 1)
+	key := client.ObjectKeyFromObject(app)
+
+	// fake client 不支持 apply patch，这里记录 apply 请求并用创建或更新模拟其效果
+	applied := map[string]int{}
+	h := newFakeHarnessWithInterceptor(t, interceptor.Funcs{
+		Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			if patch.Type() != types.ApplyPatchType {
+				return c.Patch(ctx, obj, patch, opts...)
+			}
+			kind := obj.GetObjectKind().GroupVersionKind().Kind
+			applied[kind]++
+			existing := obj.DeepCopyObject().(client.Object)
+			if err := c.Get(ctx, client.ObjectKeyFromObject(obj), existing); apierrors.IsNotFound(err) {
+				return c.Create(ctx, obj)
+			} else if err != nil {
+				return err
+			}
+			obj.SetResourceVersion(existing.GetResourceVersion())
+			return c.Update(ctx, obj)
+		},
+		Update: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.UpdateOption) error {
+			if _, ok := obj.(*appsv1.Deployment); ok && applied["Deployment"] > 0 {
+				t.Errorf("deployment updated with Update while ServerSideApply is enabled")
+			}
+			return c.Update(ctx, obj, opts...)
+		},
+	}, app)
+	h.reconciler.Features = features.NewFeatureGate()
+	if err := h.reconciler.Features.SetFromMap(map[string]bool{string(features.ServerSideApply): true}); err != nil {
+		t.Fatal(err)
+	}
+
+	h.reconcile(key)
+	if applied["Deployment"] != 1 || applied["Service"] != 1 {
+		t.Fatalf("apply requests = %v, want one Deployment and one Service", applied)
+	}
+	h.expectStatus(key, "Pending", 0)
+
+	h.updateSpec(key, func(s *myappv1.MyAppSpec) { s.Replicas = 3 })
+	h.reconcile(key)
+	if replicas := *h.deployment(key).Spec.Replicas; replicas != 3 {
+		t.Fatalf("replicas = %d, want 3", replicas)
+	}
+}
+
+func TestFakeReconcileLogVerbosityAnnotation(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		wantDebug   bool
+	}{
+		{name: "default", wantDebug: false},
+		{name: "raised", annotations: map[string]string{LogVerbosityAnnotation: "1"}, wantDebug: true},
+		{name: "invalid", annotations: map[string]string{LogVerbosityAnnotation: "loud"}, wantDebug: false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			app := newMyApp("default", "web", 1)
+			app.Annotations = tc.annotations
+			key := client.ObjectKeyFromObject(app)
+			h := newFakeHarness(t, app)
+
+			var buf bytes.Buffer
+			logger := logging.New(logging.Options{
+				Zap:   zap.Options{DestWriter: &buf},
+				Level: uberzap.NewAtomicLevelAt(zapcore.InfoLevel),
+			})
+			ctx := log.IntoContext(context.Background(), logger)
+			if _, err := h.reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+				t.Fatalf("reconcile failed: %v", err)
+			}
+
+			if got := strings.Contains(buf.String(), `"msg":"Reconciled MyApp"`); got != tc.wantDebug {
+				t.Errorf("debug log present = %v, want %v:\n%s", got, tc.wantDebug, buf.String())
+			}
+		})
+	}
+}
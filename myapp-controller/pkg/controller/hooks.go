@@ -0,0 +1,197 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	myappv1 "github.com/example/myapp-controller/pkg/apis/example/v1"
+	"github.com/example/myapp-controller/pkg/logging"
+)
+
+const (
+	// RevisionAnnotation 记录 Deployment 当前的 Pod 模板版本
+	RevisionAnnotation = "myapp.example.com/revision"
+	// HookLabel 标记钩子 Job 的类型
+	HookLabel = "myapp.example.com/hook"
+	// hookHistoryLimit 是 status.hooks 中保留的记录数
+	hookHistoryLimit = 10
+	// maxJobNameLength 是 Job 名称的最大长度，Job 名称会作为 Pod 的标签值
+	maxJobNameLength = 63
+)
+
+// podTemplateRevision 返回 Pod 模板的版本，模板的任何变化都会产生新的版本
+func podTemplateRevision(template *corev1.PodTemplateSpec) string {
+	data, _ := json.Marshal(template)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:10]
+}
+
+// deploymentRolledOut 判断 Deployment 是否已将 revision 发布到所有副本
+func deploymentRolledOut(deploy *appsv1.Deployment, replicas int32, revision string) bool {
+	return deploy.Annotations[RevisionAnnotation] == revision &&
+		deploy.Status.ObservedGeneration >= deploy.Generation &&
+		deploy.Status.UpdatedReplicas >= replicas &&
+		deploy.Status.ReadyReplicas >= replicas
+}
+
+// hookJobName 返回钩子 Job 的名称，同一版本的同一钩子只运行一次
+func hookJobName(m *myappv1.MyApp, hookType myappv1.HookType, revision string) string {
+	suffix := "-pre-" + revision
+	if hookType == myappv1.HookPostDeploy {
+		suffix = "-post-" + revision
+	}
+	prefix := m.Name
+	if len(prefix)+len(suffix) > maxJobNameLength {
+		prefix = strings.TrimRight(prefix[:maxJobNameLength-len(suffix)], "-.")
+	}
+	return prefix + suffix
+}
+
+// hookJobForMyApp 根据钩子模板构造 Job
+func (r *MyAppReconciler) hookJobForMyApp(m *myappv1.MyApp, hookType myappv1.HookType, spec *batchv1.JobSpec, revision string) *batchv1.Job {
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      hookJobName(m, hookType, revision),
+			Namespace: m.Namespace,
+			Labels: withManagedByLabel(map[string]string{
+				"app":              m.Name,
+				HookLabel:          strings.ToLower(string(hookType)),
+				RevisionAnnotation: revision,
+			}),
+		},
+		Spec: *spec.DeepCopy(),
+	}
+	pod := &job.Spec.Template.Spec
+	if pod.RestartPolicy == "" {
+		pod.RestartPolicy = corev1.RestartPolicyNever
+	}
+	for i := range pod.Containers {
+		pod.Containers[i].Image = r.Defaults.ResolveImage(pod.Containers[i].Image)
+	}
+	for i := range pod.InitContainers {
+		pod.InitContainers[i].Image = r.Defaults.ResolveImage(pod.InitContainers[i].Image)
+	}
+	applyDefaultSecurity(pod, r.podSecurity(m))
+	return job
+}
+
+// hookSpec 是 MyApp 声明的一个钩子
+type hookSpec struct {
+	hookType myappv1.HookType
+	spec     *batchv1.JobSpec
+}
+
+// hookSpecs 返回 MyApp 声明的钩子，按 PreDeploy、PostDeploy 排序
+func hookSpecs(m *myappv1.MyApp) []hookSpec {
+	if m.Spec.Hooks == nil {
+		return nil
+	}
+	var hooks []hookSpec
+	if m.Spec.Hooks.PreDeploy != nil {
+		hooks = append(hooks, hookSpec{myappv1.HookPreDeploy, m.Spec.Hooks.PreDeploy})
+	}
+	if m.Spec.Hooks.PostDeploy != nil {
+		hooks = append(hooks, hookSpec{myappv1.HookPostDeploy, m.Spec.Hooks.PostDeploy})
+	}
+	return hooks
+}
+
+// runHook 确保 revision 的钩子 Job 已创建，并返回其运行结果。
+// 已记录在 status 中的最终结果直接返回，不再读取 Job，Job 被清理后也不会重新运行。
+func (r *MyAppReconciler) runHook(ctx context.Context, m *myappv1.MyApp, hookType myappv1.HookType, spec *batchv1.JobSpec, revision string) (myappv1.HookStatus, error) {
+	if recorded := findHook(m.Status.Hooks, hookType, revision); recorded != nil && recorded.Phase != myappv1.HookRunning {
+		return *recorded, nil
+	}
+
+	logger := log.FromContext(ctx)
+	job := r.hookJobForMyApp(m, hookType, spec, revision)
+	hook := myappv1.HookStatus{Type: hookType, Revision: revision, JobName: job.Name, Phase: myappv1.HookRunning}
+
+	found := &batchv1.Job{}
+	err := r.Get(ctx, client.ObjectKeyFromObject(job), found)
+	if err != nil && !errors.IsNotFound(err) {
+		logger.Error(err, "Failed to get hook Job", logging.KeyAction, actionGet, logging.KeyResource, "Job", "hook", hookType)
+		return hook, err
+	}
+	if errors.IsNotFound(err) {
+		if err := ctrl.SetControllerReference(m, job, r.Scheme); err != nil {
+			return hook, err
+		}
+		if err := r.Create(ctx, job); err != nil && !errors.IsAlreadyExists(err) {
+			logger.Error(err, "Failed to create hook Job", logging.KeyAction, actionCreate, logging.KeyResource, "Job", "hook", hookType)
+			return hook, err
+		}
+		logger.Info("Created hook Job", logging.KeyAction, actionCreate, logging.KeyResource, "Job", "hook", hookType, "job", job.Name, "revision", revision)
+		return hook, nil
+	}
+
+	for _, c := range found.Status.Conditions {
+		if c.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch c.Type {
+		case batchv1.JobComplete:
+			hook.Phase = myappv1.HookSucceeded
+			hook.CompletionTime = found.Status.CompletionTime
+		case batchv1.JobFailed:
+			hook.Phase = myappv1.HookFailed
+			hook.Message = fmt.Sprintf("%s: %s", c.Reason, c.Message)
+			t := c.LastTransitionTime
+			hook.CompletionTime = &t
+		}
+	}
+	if hook.Phase != myappv1.HookRunning {
+		logger.Info("Hook Job finished", logging.KeyResource, "Job", "hook", hookType, "job", job.Name, "revision", revision, logging.KeyResult, hook.Phase)
+	}
+	return hook, nil
+}
+
+// findHook 返回 hooks 中指定类型和版本的记录
+func findHook(hooks []myappv1.HookStatus, hookType myappv1.HookType, revision string) *myappv1.HookStatus {
+	for i := range hooks {
+		if hooks[i].Type == hookType && hooks[i].Revision == revision {
+			return &hooks[i]
+		}
+	}
+	return nil
+}
+
+// recordHook 返回加入或更新了 hook 的记录列表，只保留最近 hookHistoryLimit 条，不修改 hooks 本身
+func recordHook(hooks []myappv1.HookStatus, hook myappv1.HookStatus) []myappv1.HookStatus {
+	out := make([]myappv1.HookStatus, 0, len(hooks)+1)
+	for _, h := range hooks {
+		if h.Type != hook.Type || h.Revision != hook.Revision {
+			out = append(out, *h.DeepCopy())
+		}
+	}
+	out = append(out, hook)
+	if len(out) > hookHistoryLimit {
+		out = out[len(out)-hookHistoryLimit:]
+	}
+	return out
+}
+
+// hookStatusMessage 返回钩子未成功时 MyApp 的阶段和状态消息
+func hookStatusMessage(hook myappv1.HookStatus) (string, string) {
+	switch {
+	case hook.Phase == myappv1.HookFailed && hook.Type == myappv1.HookPreDeploy:
+		return "Failed", fmt.Sprintf("PreDeploy 钩子 %s 失败，已中止版本 %s 的发布: %s", hook.JobName, hook.Revision, hook.Message)
+	case hook.Phase == myappv1.HookFailed:
+		return "Failed", fmt.Sprintf("PostDeploy 钩子 %s 失败，版本 %s: %s", hook.JobName, hook.Revision, hook.Message)
+	default:
+		return "Pending", fmt.Sprintf("等待 %s 钩子 %s 完成", hook.Type, hook.JobName)
+	}
+}
@@ -0,0 +1,40 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	myappv1 "github.com/example/myapp-controller/pkg/apis/example/v1"
+)
+
+func TestHookJobName(t *testing.T) {
+	app := newMyApp("default", "web", 1)
+	if got := hookJobName(app, myappv1.HookPreDeploy, "abc123"); got != "web-pre-abc123" {
+		t.Errorf("hookJobName() = %q, want web-pre-abc123", got)
+	}
+	app.Name = strings.Repeat("a", 60)
+	got := hookJobName(app, myappv1.HookPostDeploy, "0123456789")
+	if len(got) > maxJobNameLength || !strings.HasSuffix(got, "-post-0123456789") {
+		t.Errorf("hookJobName() = %q, want at most %d characters ending with the revision", got, maxJobNameLength)
+	}
+}
+
+func TestRecordHook(t *testing.T) {
+	var hooks []myappv1.HookStatus
+	for i := 0; i < hookHistoryLimit+2; i++ {
+		hooks = recordHook(hooks, myappv1.HookStatus{Type: myappv1.HookPreDeploy, Revision: fmt.Sprint(i), Phase: myappv1.HookRunning})
+	}
+	if len(hooks) != hookHistoryLimit || hooks[0].Revision != "2" {
+		t.Fatalf("hooks = %+v, want the latest %d records", hooks, hookHistoryLimit)
+	}
+
+	// 同一类型和版本的记录被替换并移到末尾
+	updated := recordHook(hooks, myappv1.HookStatus{Type: myappv1.HookPreDeploy, Revision: "5", Phase: myappv1.HookSucceeded})
+	if len(updated) != hookHistoryLimit || updated[len(updated)-1].Phase != myappv1.HookSucceeded {
+		t.Fatalf("hooks = %+v, want the record for revision 5 replaced", updated)
+	}
+	if found := findHook(hooks, myappv1.HookPreDeploy, "5"); found == nil || found.Phase != myappv1.HookRunning {
+		t.Fatalf("recordHook modified its input: %+v", found)
+	}
+}
@@ -0,0 +1,208 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/config"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+
+	myappv1 "github.com/example/myapp-controller/pkg/apis/example/v1"
+	"github.com/example/myapp-controller/pkg/health"
+)
+
+// candidate 是参与选主的一个 manager 实例
+type candidate struct {
+	mgr        manager.Manager
+	cancel     context.CancelFunc
+	done       chan struct{}
+	reconciles atomic.Int32
+}
+
+// startLeaderElectionEnv 为选主测试启动独立的 envtest 并返回其配置和客户端。
+// 共享环境中由 TestMain 启动的 manager 没有开启选主且协调所有命名空间，
+// 会替候选实例完成协调，使故障转移和只有 leader 协调的断言失去意义
+func startLeaderElectionEnv(t *testing.T) (*rest.Config, client.Client) {
+	t.Helper()
+	env := &envtest.Environment{
+		CRDDirectoryPaths:     []string{filepath.Join("..", "..", "config", "crd")},
+		ErrorIfCRDPathMissing: true,
+	}
+	envCfg, err := env.Start()
+	if err != nil {
+		t.Fatalf("failed to start envtest: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := env.Stop(); err != nil {
+			t.Errorf("failed to stop envtest: %v", err)
+		}
+	})
+	c, err := client.New(envCfg, client.Options{Scheme: newTestScheme()})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	return envCfg, c
+}
+
+// startCandidate 启动一个只 watch namespace 的、开启选主的 manager，
+// 并统计其 Reconcile 调用次数（每次 Reconcile 都以 Get MyApp 开始）
+func startCandidate(t *testing.T, envCfg *rest.Config, namespace, leaseName string) *candidate {
+	t.Helper()
+
+	cacheOpts, err := CacheOptions([]string{namespace}, "")
+	if err != nil {
+		t.Fatalf("failed to build cache options: %v", err)
+	}
+
+	mgr, err := ctrl.NewManager(envCfg, ctrl.Options{
+		Scheme:                        newTestScheme(),
+		Cache:                         cacheOpts,
+		Metrics:                       metricsserver.Options{BindAddress: "0"},
+		Controller:                    config.Controller{SkipNameValidation: ptr.To(true)},
+		LeaderElection:                true,
+		LeaderElectionID:              leaseName,
+		LeaderElectionNamespace:       namespace,
+		LeaderElectionReleaseOnCancel: true,
+		LeaseDuration:                 ptr.To(4 * time.Second),
+		RenewDeadline:                 ptr.To(2 * time.Second),
+		RetryPeriod:                   ptr.To(200 * time.Millisecond),
+	})
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+
+	c := &candidate{mgr: mgr, done: make(chan struct{})}
+	counting := &countingClient{Client: mgr.GetClient(), count: &c.reconciles}
+	if err := (&MyAppReconciler{Client: counting, Scheme: mgr.GetScheme()}).SetupWithManager(mgr); err != nil {
+		t.Fatalf("failed to set up reconciler: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	go func() {
+		defer close(c.done)
+		if err := mgr.Start(ctx); err != nil {
+			t.Errorf("manager exited with error: %v", err)
+		}
+	}()
+	return c
+}
+
+// countingClient 统计读取 MyApp 的次数
+type countingClient struct {
+	client.Client
+	count *atomic.Int32
+}
+
+func (c *countingClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	if _, ok := obj.(*myappv1.MyApp); ok {
+		c.count.Add(1)
+	}
+	return c.Client.Get(ctx, key, obj, opts...)
+}
+
+// stop 停止 manager 并等待其释放 Lease
+func (c *candidate) stop() {
+	c.cancel()
+	<-c.done
+}
+
+// isLeader 通过就绪检查判断实例是否为 leader
+func (c *candidate) isLeader() bool {
+	return health.LeaderCheck(c.mgr.Elected())(nil) == nil
+}
+
+func TestLeaderElectionFailover(t *testing.T) {
+	requireEnvtest(t)
+	ctx := context.Background()
+	envCfg, c := startLeaderElectionEnv(t)
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{GenerateName: "myapp-test-"}}
+	if err := c.Create(ctx, namespace); err != nil {
+		t.Fatalf("failed to create namespace: %v", err)
+	}
+	ns := namespace.Name
+
+	first := startCandidate(t, envCfg, ns, "myapp-failover")
+	defer first.stop()
+	eventually(t, func() error {
+		if !first.isLeader() {
+			return fmt.Errorf("first manager has not acquired the lease")
+		}
+		return nil
+	})
+
+	second := startCandidate(t, envCfg, ns, "myapp-failover")
+	defer second.stop()
+
+	app := newMyApp(ns, "failover", 1)
+	if err := c.Create(ctx, app); err != nil {
+		t.Fatalf("failed to create MyApp: %v", err)
+	}
+	key := client.ObjectKeyFromObject(app)
+	eventually(t, func() error {
+		if first.reconciles.Load() == 0 {
+			return fmt.Errorf("leader has not reconciled yet")
+		}
+		return nil
+	})
+
+	// 备用实例在 leader 存活期间既不是 leader，也不会协调任何对象
+	time.Sleep(time.Second)
+	if second.isLeader() {
+		t.Fatalf("standby manager reports itself as leader while the first one holds the lease")
+	}
+	if n := second.reconciles.Load(); n != 0 {
+		t.Fatalf("standby manager reconciled %d times before failover", n)
+	}
+
+	// 停止 leader，主动释放的 Lease 应被备用实例在租期到期前接管
+	start := time.Now()
+	first.stop()
+	reconcilesBeforeHandover := first.reconciles.Load()
+	eventually(t, func() error {
+		if !second.isLeader() {
+			return fmt.Errorf("standby manager has not taken over")
+		}
+		return nil
+	})
+	if took := time.Since(start); took >= 4*time.Second {
+		t.Errorf("handover took %s, expected the released lease to be acquired before it expires", took)
+	}
+
+	eventually(t, func() error {
+		current := &myappv1.MyApp{}
+		if err := c.Get(ctx, key, current); err != nil {
+			return err
+		}
+		current.Spec.Replicas = 2
+		return c.Update(ctx, current)
+	})
+	// 独立环境中只有候选实例在协调，Deployment 的变化只能来自新的 leader
+	eventually(t, func() error {
+		deploy := &appsv1.Deployment{}
+		if err := c.Get(ctx, key, deploy); err != nil {
+			return err
+		}
+		if *deploy.Spec.Replicas != 2 || second.reconciles.Load() == 0 {
+			return fmt.Errorf("new leader has not reconciled the update")
+		}
+		return nil
+	})
+
+	if n := first.reconciles.Load(); n != reconcilesBeforeHandover {
+		t.Errorf("old leader reconciled %d more times after stepping down", n-reconcilesBeforeHandover)
+	}
+}
@@ -0,0 +1,53 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	myappv1 "github.com/example/myapp-controller/pkg/apis/example/v1"
+	"github.com/example/myapp-controller/pkg/logging"
+)
+
+// LogVerbosityAnnotation 提高单个 MyApp 协调日志的详细程度，值为 logr 的 V 级别，
+// 例如 "1" 会输出该 MyApp 的调试日志，而不影响其他 MyApp
+const LogVerbosityAnnotation = "myapp.example.com/log-verbosity"
+
+// 日志中 action 键的取值
+const (
+	actionGet         = "get"
+	actionCreate      = "create"
+	actionUpdate      = "update"
+	actionApply       = "apply"
+	actionPatchStatus = "patchStatus"
+	actionDelete      = "delete"
+)
+
+// logConstructor 为每次协调构造带有 myapp 和 namespace 键的 logger，
+// controller-runtime 会在其上追加 reconcileID
+func logConstructor(base logr.Logger) func(*reconcile.Request) logr.Logger {
+	base = base.WithValues("controller", "myapp")
+	return func(req *reconcile.Request) logr.Logger {
+		if req == nil {
+			return base
+		}
+		return base.WithValues(logging.KeyMyApp, req.Name, logging.KeyNamespace, req.Namespace)
+	}
+}
+
+// myAppLogger 为 logger 加上 MyApp 的 generation，并按注解提高日志详细程度
+func myAppLogger(logger logr.Logger, m *myappv1.MyApp) logr.Logger {
+	logger = logger.WithValues(logging.KeyGeneration, m.Generation)
+
+	value, ok := m.Annotations[LogVerbosityAnnotation]
+	if !ok {
+		return logger
+	}
+	v, err := strconv.Atoi(value)
+	if err != nil || v < 0 {
+		logger.Info("Ignoring invalid log verbosity annotation", "annotation", LogVerbosityAnnotation, "value", value)
+		return logger
+	}
+	return logging.WithVerbosity(logger, v)
+}
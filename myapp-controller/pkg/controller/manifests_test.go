@@ -0,0 +1,191 @@
+package controller
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/yaml"
+
+	myappv1 "github.com/example/myapp-controller/pkg/apis/example/v1"
+)
+
+// update 为 true 时重新生成 testdata 下的 golden 文件：
+//
+//	go test ./pkg/controller -run TestManifestGolden -update
+var update = flag.Bool("update", false, "update golden files under testdata/")
+
+// manifestCases 是渲染 Deployment/Service（以及 NetworkPolicy）的 MyApp 规格矩阵
+var manifestCases = []struct {
+	name string
+	app  *myappv1.MyApp
+}{
+	{
+		name: "basic",
+		app: &myappv1.MyApp{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+			Spec:       myappv1.MyAppSpec{Image: "nginx:1.25", Replicas: 3, Port: 80},
+		},
+	},
+	{
+		name: "single-replica",
+		app: &myappv1.MyApp{
+			ObjectMeta: metav1.ObjectMeta{Name: "worker", Namespace: "jobs"},
+			Spec:       myappv1.MyAppSpec{Image: "registry.example.com/team/worker:v2", Replicas: 1, Port: 9090},
+		},
+	},
+	{
+		name: "max-port",
+		app: &myappv1.MyApp{
+			ObjectMeta: metav1.ObjectMeta{Name: "edge", Namespace: "default"},
+			Spec:       myappv1.MyAppSpec{Image: "envoyproxy/envoy:v1.30", Replicas: 10, Port: 65535},
+		},
+	},
+	{
+		name: "sidecars",
+		app: &myappv1.MyApp{
+			ObjectMeta: metav1.ObjectMeta{Name: "shop", Namespace: "default"},
+			Spec: myappv1.MyAppSpec{
+				Image:        "shop:v3",
+				Replicas:     2,
+				Port:         8080,
+				VolumeMounts: []corev1.VolumeMount{{Name: "logs", MountPath: "/var/log/shop"}},
+				Sidecars: []myappv1.Container{
+					{
+						Name:         "log-shipper",
+						Image:        "fluent/fluent-bit:3.0",
+						Args:         []string{"-i", "tail", "-p", "path=/logs/*.log", "-o", "stdout"},
+						Resources:    corev1.ResourceRequirements{Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("64Mi")}},
+						VolumeMounts: []corev1.VolumeMount{{Name: "logs", MountPath: "/logs", ReadOnly: true}},
+					},
+					{
+						Name:  "envoy-proxy",
+						Image: "envoyproxy/envoy:v1.30",
+						Env:   []corev1.EnvVar{{Name: "POD_NAME", ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.name"}}}},
+						Ports: []myappv1.ContainerPort{
+							// 与主容器端口重名，由控制器重新命名
+							{Name: "http", ContainerPort: 8443, Expose: true},
+							{ContainerPort: 9901},
+						},
+					},
+				},
+				InitContainers: []myappv1.Container{{
+					Name:    "migrate",
+					Image:   "shop:v3",
+					Command: []string{"/shop", "migrate"},
+				}},
+				Volumes: []myappv1.SharedVolume{{Name: "logs"}},
+			},
+		},
+	},
+	{
+		name: "scheduling",
+		app: &myappv1.MyApp{
+			ObjectMeta: metav1.ObjectMeta{Name: "report", Namespace: "batch"},
+			Spec: myappv1.MyAppSpec{
+				Image:        "report:v1",
+				Replicas:     2,
+				Port:         8080,
+				NodeSelector: map[string]string{"pool": "batch"},
+				Tolerations: []corev1.Toleration{{
+					Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "batch", Effect: corev1.TaintEffectNoSchedule,
+				}},
+				Affinity: &corev1.Affinity{PodAntiAffinity: &corev1.PodAntiAffinity{
+					PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{{
+						Weight: 100,
+						PodAffinityTerm: corev1.PodAffinityTerm{
+							LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "report"}},
+							TopologyKey:   "kubernetes.io/hostname",
+						},
+					}},
+				}},
+				PriorityClassName: "batch-low",
+			},
+		},
+	},
+	{
+		name: "network-policy",
+		app: &myappv1.MyApp{
+			ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "shop"},
+			Spec: myappv1.MyAppSpec{
+				Image:    "api:v5",
+				Replicas: 2,
+				Port:     8080,
+				Sidecars: []myappv1.Container{{
+					Name:  "metrics",
+					Image: "exporter:v1",
+					Ports: []myappv1.ContainerPort{{Name: "metrics", ContainerPort: 9100, Expose: true}},
+				}},
+				NetworkPolicy: &myappv1.NetworkPolicySpec{
+					Ingress: []myappv1.NetworkPeer{
+						{Apps: []string{"frontend", "admin"}},
+						{Namespaces: []string{"monitoring"}},
+						{Apps: []string{"gateway"}, Namespaces: []string{"ingress"}, CIDRs: []string{"10.20.0.0/16"}},
+					},
+					Egress: []myappv1.NetworkEgressRule{
+						{NetworkPeer: myappv1.NetworkPeer{Apps: []string{"postgres"}}, Ports: []networkingv1.NetworkPolicyPort{{Port: ptr.To(intstr.FromInt32(5432))}}},
+						{Ports: []networkingv1.NetworkPolicyPort{{Port: ptr.To(intstr.FromInt32(443))}}},
+					},
+				},
+			},
+		},
+	},
+}
+
+func TestManifestGolden(t *testing.T) {
+	r := &MyAppReconciler{}
+	for _, tc := range manifestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			deploy := r.deploymentForMyApp(tc.app)
+			deploy.APIVersion, deploy.Kind = "apps/v1", "Deployment"
+			assertGolden(t, filepath.Join("testdata", tc.name+".deployment.yaml"), deploy)
+
+			svc := r.serviceForMyApp(tc.app)
+			svc.APIVersion, svc.Kind = "v1", "Service"
+			assertGolden(t, filepath.Join("testdata", tc.name+".service.yaml"), svc)
+
+			if tc.app.Spec.NetworkPolicy != nil {
+				policy := r.networkPolicyForMyApp(tc.app)
+				policy.APIVersion, policy.Kind = "networking.k8s.io/v1", "NetworkPolicy"
+				assertGolden(t, filepath.Join("testdata", tc.name+".networkpolicy.yaml"), policy)
+			}
+		})
+	}
+}
+
+// assertGolden 将对象渲染为 YAML 并与 golden 文件比较，-update 时覆盖 golden 文件
+func assertGolden(t *testing.T, path string, obj runtime.Object) {
+	t.Helper()
+
+	got, err := yaml.Marshal(obj)
+	if err != nil {
+		t.Fatalf("failed to marshal %s: %v", path, err)
+	}
+
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("failed to create testdata dir: %v", err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatalf("failed to update golden file %s: %v", path, err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read golden file %s (run with -update to create it): %v", path, err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s does not match rendered output (run with -update to regenerate)\n--- want\n%s\n--- got\n%s", path, want, got)
+	}
+}
@@ -0,0 +1,201 @@
+package controller
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// 所有 MyApp 可能处于的阶段，用于输出 phase 指标
+var myAppPhases = []string{"Pending", "Running", "Failed"}
+
+var (
+	// myAppPhase 表示每个 MyApp 当前所处的阶段，当前阶段为 1，其余为 0
+	myAppPhase = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "myapp_phase",
+			Help: "MyApp 当前所处的阶段 (1 表示处于该阶段)",
+		},
+		[]string{"namespace", "name", "phase"},
+	)
+
+	// myAppDesiredReplicas 表示 MyApp 期望的副本数
+	myAppDesiredReplicas = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "myapp_replicas_desired",
+			Help: "MyApp 期望的副本数",
+		},
+		[]string{"namespace", "name"},
+	)
+
+	// myAppReadyReplicas 表示 MyApp 已就绪的副本数
+	myAppReadyReplicas = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "myapp_replicas_ready",
+			Help: "MyApp 已就绪的副本数",
+		},
+		[]string{"namespace", "name"},
+	)
+
+	// reconcileOutcomes 按原因统计协调结果
+	reconcileOutcomes = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "myapp_reconcile_outcomes_total",
+			Help: "MyApp 协调结果计数，按原因区分",
+		},
+		[]string{"reason"},
+	)
+
+	// timeToReady 记录规格变更后到所有副本就绪所用的时间
+	timeToReady = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "myapp_time_to_ready_seconds",
+			Help:    "MyApp 规格变更后到所有副本就绪所用的时间",
+			Buckets: []float64{1, 5, 10, 30, 60, 120, 300, 600, 1200},
+		},
+		[]string{"namespace"},
+	)
+
+	// watchEvents 统计经过事件过滤后被处理和被跳过的 watch 事件
+	watchEvents = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "myapp_watch_events_total",
+			Help: "MyApp 控制器收到的 watch 事件数，按资源类型、事件类型和是否被处理区分",
+		},
+		[]string{"kind", "event", "decision"},
+	)
+)
+
+// 协调结果的原因
+const (
+	reasonNotFound              = "NotFound"
+	reasonGetFailed             = "GetFailed"
+	reasonDeploymentCreated     = "DeploymentCreated"
+	reasonDeploymentUpdated     = "DeploymentUpdated"
+	reasonDeploymentFailed      = "DeploymentFailed"
+	reasonServiceFailed         = "ServiceFailed"
+	reasonStatusFailed          = "StatusUpdateFailed"
+	reasonReady                 = "Ready"
+	reasonProgressing           = "Progressing"
+	reasonInvalidSpec           = "InvalidSpec"
+	reasonHookPending           = "HookPending"
+	reasonHookFailed            = "HookFailed"
+	reasonServiceAccountFailed  = "ServiceAccountFailed"
+	reasonServiceAccountDenied  = "ServiceAccountDenied"
+	reasonNetworkPolicyFailed   = "NetworkPolicyFailed"
+	reasonNetworkPolicyConflict = "NetworkPolicyConflict"
+	reasonDependenciesPending   = "DependenciesPending"
+	reasonDependencyCycle       = "DependencyCycle"
+	reasonClassNotFound         = "ClassNotFound"
+	reasonClassLimitExceeded    = "ClassLimitExceeded"
+	reasonPolicyViolation       = "PolicyViolation"
+)
+
+func init() {
+	// 注册到 controller-runtime 的全局指标注册表，由 manager 的 metrics server 暴露
+	metrics.Registry.MustRegister(
+		myAppPhase,
+		myAppDesiredReplicas,
+		myAppReadyReplicas,
+		reconcileOutcomes,
+		timeToReady,
+		watchEvents,
+	)
+}
+
+// recordOutcome 记录一次协调结果
+func recordOutcome(reason string) {
+	reconcileOutcomes.WithLabelValues(reason).Inc()
+}
+
+// recordEvent 记录一次 watch 事件的过滤结果，并原样返回 processed
+func recordEvent(kind, eventType string, processed bool) bool {
+	decision := "skipped"
+	if processed {
+		decision = "processed"
+	}
+	watchEvents.WithLabelValues(kind, eventType, decision).Inc()
+	return processed
+}
+
+// recordMyAppStatus 更新单个 MyApp 的阶段和副本数指标
+func recordMyAppStatus(key types.NamespacedName, phase string, desired, ready int32) {
+	for _, p := range myAppPhases {
+		value := 0.0
+		if p == phase {
+			value = 1
+		}
+		myAppPhase.WithLabelValues(key.Namespace, key.Name, p).Set(value)
+	}
+	myAppDesiredReplicas.WithLabelValues(key.Namespace, key.Name).Set(float64(desired))
+	myAppReadyReplicas.WithLabelValues(key.Namespace, key.Name).Set(float64(ready))
+}
+
+// forgetMyApp 在 MyApp 删除后清理其相关指标
+func forgetMyApp(key types.NamespacedName) {
+	labels := prometheus.Labels{"namespace": key.Namespace, "name": key.Name}
+	myAppPhase.DeletePartialMatch(labels)
+	myAppDesiredReplicas.Delete(labels)
+	myAppReadyReplicas.Delete(labels)
+	readiness.forget(key)
+}
+
+// readinessTracker 跟踪每个 MyApp 的规格变更时间，用于计算就绪耗时
+type readinessTracker struct {
+	mu      sync.Mutex
+	pending map[types.NamespacedName]pendingRollout
+	seen    map[types.NamespacedName]int64
+}
+
+// pendingRollout 表示某个 generation 尚未就绪的变更
+type pendingRollout struct {
+	generation int64
+	start      time.Time
+}
+
+var readiness = &readinessTracker{
+	pending: map[types.NamespacedName]pendingRollout{},
+	seen:    map[types.NamespacedName]int64{},
+}
+
+// observeSpec 在观察到新的 generation 时开始计时。
+// 控制器首次看到一个已处于 Running 的 MyApp 时不计时，避免重启后产生接近 0 的样本。
+func (t *readinessTracker) observeSpec(key types.NamespacedName, generation int64, running bool, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	last, ok := t.seen[key]
+	t.seen[key] = generation
+	if ok && last == generation {
+		return
+	}
+	if !ok && running {
+		return
+	}
+	t.pending[key] = pendingRollout{generation: generation, start: now}
+}
+
+// observeReady 在 MyApp 就绪时记录从规格变更到就绪的耗时
+func (t *readinessTracker) observeReady(key types.NamespacedName, generation int64, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.pending[key]
+	if !ok || p.generation != generation {
+		return
+	}
+	delete(t.pending, key)
+	timeToReady.WithLabelValues(key.Namespace).Observe(now.Sub(p.start).Seconds())
+}
+
+// forget 清理已删除 MyApp 的跟踪状态
+func (t *readinessTracker) forget(key types.NamespacedName) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.pending, key)
+	delete(t.seen, key)
+}
@@ -2,35 +2,94 @@ package controller
 
 import (
 	"context"
+	stderrors "errors"
 	"fmt"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	crcontroller "sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
 	myappv1 "github.com/example/myapp-controller/pkg/apis/example/v1"
+	"github.com/example/myapp-controller/pkg/debug"
+	"github.com/example/myapp-controller/pkg/features"
+	"github.com/example/myapp-controller/pkg/logging"
+	"github.com/example/myapp-controller/pkg/tracing"
 )
 
 // MyAppReconciler 协调 MyApp 资源
 type MyAppReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+	// Options 控制并发数和限速，零值使用默认值
+	Options Options
+	// Defaults 可以热加载的 MyApp 默认值，为 nil 时不应用任何默认值
+	Defaults *RuntimeDefaults
+	// Features 功能开关，为 nil 时所有功能使用默认值
+	Features *features.FeatureGate
+	// APIReader 绕过缓存直接读取 apiserver，用于接管缓存中看不到的、没有 ManagedByLabel 的旧对象。
+	// 为 nil 时使用 Client
+	APIReader client.Reader
+	// Queue 记录工作队列中对象的入队时间，供 /debug/queue 使用，为 nil 时使用默认队列
+	Queue *debug.QueueTracker
+
+	// namespaceLabels 缓存 SecurityCompliant 状况使用的命名空间标签
+	namespaceLabels namespaceLabelCache
 }
 
+// fieldOwner 是 server-side apply 使用的字段管理者名称
+const fieldOwner = "myapp-controller"
+
 // +kubebuilder:rbac:groups=example.com,resources=myapps,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=example.com,resources=myapps/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;delete
+// +kubebuilder:rbac:groups=core,resources=namespaces,verbs=get
+// +kubebuilder:rbac:groups=core,resources=serviceaccounts,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=roles;rolebindings,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=authorization.k8s.io,resources=selfsubjectaccessreviews,verbs=create
+// +kubebuilder:rbac:groups=networking.k8s.io,resources=networkpolicies,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=example.com,resources=myappclasses,verbs=get;list;watch
+// +kubebuilder:rbac:groups=example.com,resources=myapppolicies,verbs=get;list;watch
 
-// Reconcile 是核心的协调逻辑
+// Reconcile 是核心的协调逻辑，每次调用都记录为一个 span
 func (r *MyAppReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Reconcile MyApp", trace.WithAttributes(
+		attribute.String("myapp.namespace", req.Namespace),
+		attribute.String("myapp.name", req.Name),
+	))
+	defer span.End()
+	ctx = log.IntoContext(ctx, tracing.WithTraceIDs(log.FromContext(ctx), span))
+
+	result, err := r.reconcile(ctx, req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return result, err
+}
+
+// reconcile 创建或同步 MyApp 对应的 Deployment 和 Service，并更新 MyApp 的状态
+func (r *MyAppReconciler) reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	logger := log.FromContext(ctx)
 
 	// 获取 MyApp 实例
@@ -39,112 +98,521 @@ func (r *MyAppReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl
 	if err != nil {
 		if errors.IsNotFound(err) {
 			// MyApp 资源已被删除
-			logger.Info("MyApp resource not found. Ignoring since object must be deleted")
+			logger.Info("MyApp not found, ignoring since it must have been deleted", logging.KeyResult, reasonNotFound)
+			forgetMyApp(req.NamespacedName)
+			recordOutcome(reasonNotFound)
 			return ctrl.Result{}, nil
 		}
 		// 获取失败
-		logger.Error(err, "Failed to get MyApp")
+		logger.Error(err, "Failed to get MyApp", logging.KeyAction, actionGet, logging.KeyResource, "MyApp", logging.KeyResult, reasonGetFailed)
+		recordOutcome(reasonGetFailed)
+		return ctrl.Result{}, err
+	}
+
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int64("myapp.generation", myApp.Generation))
+	logger = myAppLogger(logger, myApp)
+	ctx = log.IntoContext(ctx, logger)
+
+	// 记录规格变更时间，用于计算就绪耗时
+	readiness.observeSpec(req.NamespacedName, myApp.Generation, myApp.Status.Phase == "Running", time.Now())
+
+	// 本次协调的结果，用于指标统计
+	outcome := ""
+
+	if err := validateSpec(myApp); err != nil {
+		logger.Error(err, "Invalid MyApp spec", logging.KeyResult, reasonInvalidSpec)
+		return r.failWithoutRetry(ctx, myApp, err, reasonInvalidSpec)
+	}
+
+	// 合并 MyAppClass 的默认值，之后的步骤都使用合并后的规格
+	class, err := r.classFor(ctx, myApp)
+	switch {
+	case errors.IsNotFound(err):
+		return r.holdForClass(ctx, myApp)
+	case err != nil:
+		logger.Error(err, "Failed to get MyAppClass", logging.KeyAction, actionGet, logging.KeyResource, "MyAppClass", logging.KeyResult, reasonGetFailed)
+		recordOutcome(reasonGetFailed)
 		return ctrl.Result{}, err
+	case class != nil:
+		applyClassDefaults(&myApp.Spec, class.Spec.Defaults)
+		if errs := classViolations(&myApp.Spec, class); len(errs) > 0 {
+			err := errs.ToAggregate()
+			logger.Error(err, "MyApp exceeds MyAppClass limits", "class", class.Name, logging.KeyResult, reasonClassLimitExceeded)
+			return r.failWithoutRetry(ctx, myApp, err, reasonClassLimitExceeded)
+		}
+	}
+
+	// MyAppPolicy 检查合并 MyAppClass 默认值之后的规格
+	if r.Features.Enabled(features.MyAppPolicy) {
+		errs, err := policyViolations(ctx, r.Client, r.apiReader(), myApp, true, r.Defaults.ResolveImage)
+		if err != nil {
+			logger.Error(err, "Failed to check MyAppPolicies", logging.KeyAction, actionGet, logging.KeyResource, "MyAppPolicy", logging.KeyResult, reasonGetFailed)
+			recordOutcome(reasonGetFailed)
+			return ctrl.Result{}, err
+		}
+		if len(errs) > 0 {
+			err := errs.ToAggregate()
+			logger.Error(err, "MyApp violates MyAppPolicy", logging.KeyResult, reasonPolicyViolation)
+			return r.failWithoutRetry(ctx, myApp, err, reasonPolicyViolation)
+		}
 	}
 
-	// 更新状态为 Pending
-	if myApp.Status.Phase == "" {
-		logger.Info("Updating MyApp status to Pending", "name", myApp.Name, "namespace", myApp.Namespace)
-		// 重新获取最新的 MyApp 对象以确保 ResourceVersion 正确
-		latestMyApp := &myappv1.MyApp{}
-		if err := r.Get(ctx, req.NamespacedName, latestMyApp); err != nil {
-			logger.Error(err, "Failed to get latest MyApp for status update", "name", req.Name, "namespace", req.Namespace)
-			return ctrl.Result{RequeueAfter: time.Second * 5}, nil
+	// 依赖形成环时永远无法就绪，等待用户修改其中一个 MyApp
+	var dependencies *metav1.Condition
+	if len(myApp.Spec.DependsOn) > 0 {
+		cond, err := r.dependenciesCondition(ctx, myApp)
+		var permanent *permanentError
+		if stderrors.As(err, &permanent) {
+			logger.Error(err, "Invalid MyApp dependencies", logging.KeyResult, reasonDependencyCycle)
+			return r.failWithoutRetry(ctx, myApp, err, reasonDependencyCycle, cond)
 		}
+		if err != nil {
+			logger.Error(err, "Failed to check dependencies", logging.KeyAction, actionGet, logging.KeyResource, "MyApp", logging.KeyResult, reasonGetFailed)
+			recordOutcome(reasonGetFailed)
+			return ctrl.Result{}, err
+		}
+		dependencies = &cond
+	}
 
-		logger.Info("Got latest MyApp for status update", "resourceVersion", latestMyApp.ResourceVersion)
-		latestMyApp.Status.Phase = "Pending"
-		latestMyApp.Status.Message = "正在创建资源"
-		if err := r.Client.Status().Update(ctx, latestMyApp); err != nil {
-			logger.Error(err, "Failed to update MyApp status", "name", latestMyApp.Name, "namespace", latestMyApp.Namespace, "resourceVersion", latestMyApp.ResourceVersion)
-			// 如果状态更新失败，重新排队处理
-			return ctrl.Result{RequeueAfter: time.Second * 5}, nil
+	// Deployment 引用 ServiceAccount 之前先创建它
+	if err := r.reconcileServiceAccount(ctx, myApp); err != nil {
+		var permanent *permanentError
+		if stderrors.As(err, &permanent) {
+			logger.Error(err, "Cannot provision ServiceAccount", logging.KeyResource, "ServiceAccount", logging.KeyResult, reasonServiceAccountDenied)
+			return r.failWithoutRetry(ctx, myApp, err, reasonServiceAccountDenied)
 		}
-		logger.Info("Successfully updated MyApp status to Pending")
+		recordOutcome(reasonServiceAccountFailed)
+		return ctrl.Result{}, err
+	}
+
+	// 新 Pod 启动前先创建 NetworkPolicy，避免在允许所有流量的集群中短暂不受限制
+	if err := r.reconcileNetworkPolicy(ctx, myApp); err != nil {
+		var permanent *permanentError
+		if stderrors.As(err, &permanent) {
+			logger.Error(err, "Cannot provision NetworkPolicy", logging.KeyResource, "NetworkPolicy", logging.KeyResult, reasonNetworkPolicyConflict)
+			return r.failWithoutRetry(ctx, myApp, err, reasonNetworkPolicyConflict)
+		}
+		recordOutcome(reasonNetworkPolicyFailed)
+		return ctrl.Result{}, err
 	}
 
 	// 创建或更新 Deployment
 	deployment := r.deploymentForMyApp(myApp)
 	if err := ctrl.SetControllerReference(myApp, deployment, r.Scheme); err != nil {
+		recordOutcome(reasonDeploymentFailed)
 		return ctrl.Result{}, err
 	}
+	revision := deployment.Annotations[RevisionAnnotation]
+	hooks := myApp.Status.Hooks
+	conditions := withCondition(myApp.Status.Conditions, r.securityCondition(ctx, myApp, &deployment.Spec.Template.Spec))
+	if dependencies != nil {
+		conditions = withCondition(conditions, *dependencies)
+	} else {
+		conditions = withoutCondition(conditions, myappv1.ConditionDependenciesReady)
+	}
 
-	found := &appsv1.Deployment{}
-	err = r.Get(ctx, client.ObjectKey{Name: deployment.Name, Namespace: deployment.Namespace}, found)
-	if err != nil && errors.IsNotFound(err) {
-		logger.Info("Creating a new Deployment", "Deployment.Namespace", deployment.Namespace, "Deployment.Name", deployment.Name)
-		err = r.Create(ctx, deployment)
-		if err != nil {
-			logger.Error(err, "Failed to create new Deployment", "Deployment.Namespace", deployment.Namespace, "Deployment.Name", deployment.Name)
+	// 依赖和 PreDeploy 钩子只阻塞新版本的发布，已发布的版本照常同步副本数等其他字段
+	waitForDependencies := dependencies != nil && dependencies.Status != metav1.ConditionTrue
+	preDeploy := myApp.Spec.Hooks != nil && myApp.Spec.Hooks.PreDeploy != nil
+	if waitForDependencies || preDeploy {
+		current := &appsv1.Deployment{}
+		err := r.Get(ctx, client.ObjectKeyFromObject(deployment), current)
+		if err != nil && !errors.IsNotFound(err) {
+			logger.Error(err, "Failed to get Deployment", logging.KeyAction, actionGet, logging.KeyResource, "Deployment", logging.KeyResult, reasonDeploymentFailed)
+			recordOutcome(reasonDeploymentFailed)
 			return ctrl.Result{}, err
 		}
-		// Deployment 创建成功，重新排队
-		return ctrl.Result{RequeueAfter: time.Minute}, nil
-	} else if err != nil {
-		logger.Error(err, "Failed to get Deployment")
+		newRevision := errors.IsNotFound(err) || current.Annotations[RevisionAnnotation] != revision
+
+		// 依赖全部处于 Running 之前不发布新版本，依赖的状态变化或定期的重新检查会再次触发协调
+		if newRevision && waitForDependencies {
+			status := *myApp.Status.DeepCopy()
+			status.Phase, status.Message, status.Conditions = "Pending", dependencies.Message, conditions
+			return r.holdForDependencies(ctx, myApp, status)
+		}
+
+		// 新版本应用到 Deployment 之前运行 PreDeploy 钩子，未成功时保持 Deployment 不变
+		if newRevision && preDeploy {
+			hook, err := r.runHook(ctx, myApp, myappv1.HookPreDeploy, myApp.Spec.Hooks.PreDeploy, revision)
+			if err != nil {
+				recordOutcome(reasonHookFailed)
+				return ctrl.Result{}, err
+			}
+			hooks = recordHook(hooks, hook)
+			if hook.Phase != myappv1.HookSucceeded {
+				status := *myApp.Status.DeepCopy()
+				status.Revision, status.Hooks, status.Conditions = revision, hooks, conditions
+				return r.holdRollout(ctx, myApp, hook, status)
+			}
+		}
+	}
+
+	var found *appsv1.Deployment
+	if r.Features.Enabled(features.ServerSideApply) {
+		found, outcome, err = r.applyDeployment(ctx, deployment)
+	} else {
+		found, outcome, err = r.createOrUpdateDeployment(ctx, deployment)
+	}
+	if err != nil {
+		recordOutcome(reasonDeploymentFailed)
+		return ctrl.Result{}, err
+	}
+
+	// 创建或更新 Service
+	service := r.serviceForMyApp(myApp)
+	if err := ctrl.SetControllerReference(myApp, service, r.Scheme); err != nil {
+		recordOutcome(reasonServiceFailed)
+		return ctrl.Result{}, err
+	}
+
+	if r.Features.Enabled(features.ServerSideApply) {
+		err = r.applyService(ctx, service)
+	} else {
+		err = r.createOrUpdateService(ctx, service)
+	}
+	if err != nil {
+		recordOutcome(reasonServiceFailed)
 		return ctrl.Result{}, err
 	}
 
-	// 更新 Deployment 如果需要
-	if found.Spec.Replicas != &myApp.Spec.Replicas {
-		found.Spec.Replicas = &myApp.Spec.Replicas
-		err = r.Update(ctx, found)
+	// Deployment 不再引用 ServiceAccount 之后才删除它
+	if err := r.cleanupServiceAccount(ctx, myApp); err != nil {
+		recordOutcome(reasonServiceAccountFailed)
+		return ctrl.Result{}, err
+	}
+
+	// 每次协调只计算一次状态，未变化时不写入
+	status := computeStatus(myApp, found)
+	status.Revision = revision
+
+	// 新版本发布到所有副本后运行 PostDeploy 钩子
+	if myApp.Spec.Hooks != nil && myApp.Spec.Hooks.PostDeploy != nil && deploymentRolledOut(found, myApp.Spec.Replicas, revision) {
+		hook, err := r.runHook(ctx, myApp, myappv1.HookPostDeploy, myApp.Spec.Hooks.PostDeploy, revision)
 		if err != nil {
-			logger.Error(err, "Failed to update Deployment", "Deployment.Namespace", found.Namespace, "Deployment.Name", found.Name)
+			recordOutcome(reasonHookFailed)
 			return ctrl.Result{}, err
 		}
-		// 规格更新成功，重新排队
-		return ctrl.Result{RequeueAfter: time.Minute}, nil
+		hooks = recordHook(hooks, hook)
+		if hook.Phase != myappv1.HookSucceeded {
+			status.Phase, status.Message = hookStatusMessage(hook)
+			if outcome == "" {
+				outcome = hookOutcome(hook)
+			}
+		}
 	}
+	status.Hooks = hooks
+	status.Conditions = conditions
 
-	// 创建或更新 Service
-	service := r.serviceForMyApp(myApp)
-	if err := ctrl.SetControllerReference(myApp, service, r.Scheme); err != nil {
+	if err := r.updateStatus(ctx, myApp, status); err != nil {
+		logger.Error(err, "Failed to update MyApp status", logging.KeyAction, actionPatchStatus, logging.KeyResource, "MyApp", logging.KeyResult, reasonStatusFailed)
+		recordOutcome(reasonStatusFailed)
 		return ctrl.Result{}, err
 	}
 
+	recordMyAppStatus(req.NamespacedName, status.Phase, myApp.Spec.Replicas, status.ReadyReplicas)
+	if status.Phase == "Running" {
+		readiness.observeReady(req.NamespacedName, myApp.Generation, time.Now())
+	}
+	if outcome == "" {
+		outcome = reasonProgressing
+		if status.Phase == "Running" {
+			outcome = reasonReady
+		}
+	}
+	recordOutcome(outcome)
+	logger.V(1).Info("Reconciled MyApp", logging.KeyResult, outcome, "phase", status.Phase, "readyReplicas", status.ReadyReplicas)
+
+	return ctrl.Result{}, nil
+}
+
+// failWithoutRetry 写入 Failed 状态和 conditions 中的状况并结束本次协调，不重新排队：
+// 规格不合法或权限不足时重试没有意义，等待用户修改 MyApp
+func (r *MyAppReconciler) failWithoutRetry(ctx context.Context, m *myappv1.MyApp, cause error, reason string, conditions ...metav1.Condition) (ctrl.Result, error) {
+	status := *m.Status.DeepCopy()
+	status.Phase, status.Message = "Failed", cause.Error()
+	for _, cond := range conditions {
+		status.Conditions = withCondition(status.Conditions, cond)
+	}
+	if err := r.updateStatus(ctx, m, status); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to update MyApp status", logging.KeyAction, actionPatchStatus, logging.KeyResource, "MyApp", logging.KeyResult, reasonStatusFailed)
+		recordOutcome(reasonStatusFailed)
+		return ctrl.Result{}, err
+	}
+	recordMyAppStatus(client.ObjectKeyFromObject(m), status.Phase, m.Spec.Replicas, status.ReadyReplicas)
+	recordOutcome(reason)
+	return ctrl.Result{}, nil
+}
+
+// holdRollout 在 PreDeploy 钩子运行中或失败时写入状态，不修改 Deployment 和 Service。
+// status 中的阶段和消息由钩子的结果决定，钩子 Job 的状态变化会再次触发协调
+func (r *MyAppReconciler) holdRollout(ctx context.Context, m *myappv1.MyApp, hook myappv1.HookStatus, status myappv1.MyAppStatus) (ctrl.Result, error) {
+	status.Phase, status.Message = hookStatusMessage(hook)
+	if err := r.updateStatus(ctx, m, status); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to update MyApp status", logging.KeyAction, actionPatchStatus, logging.KeyResource, "MyApp", logging.KeyResult, reasonStatusFailed)
+		recordOutcome(reasonStatusFailed)
+		return ctrl.Result{}, err
+	}
+	recordMyAppStatus(client.ObjectKeyFromObject(m), status.Phase, m.Spec.Replicas, status.ReadyReplicas)
+	recordOutcome(hookOutcome(hook))
+	return ctrl.Result{}, nil
+}
+
+// holdForDependencies 在依赖未就绪时写入 status，不修改 Deployment 和 Service，
+// 并在 dependencyRecheckInterval 后重新检查不在缓存中、变化不会触发协调的依赖
+func (r *MyAppReconciler) holdForDependencies(ctx context.Context, m *myappv1.MyApp, status myappv1.MyAppStatus) (ctrl.Result, error) {
+	if err := r.updateStatus(ctx, m, status); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to update MyApp status", logging.KeyAction, actionPatchStatus, logging.KeyResource, "MyApp", logging.KeyResult, reasonStatusFailed)
+		recordOutcome(reasonStatusFailed)
+		return ctrl.Result{}, err
+	}
+	recordMyAppStatus(client.ObjectKeyFromObject(m), status.Phase, m.Spec.Replicas, status.ReadyReplicas)
+	recordOutcome(reasonDependenciesPending)
+	log.FromContext(ctx).V(1).Info("Waiting for dependencies", logging.KeyResult, reasonDependenciesPending, "message", status.Message)
+	return ctrl.Result{RequeueAfter: dependencyRecheckInterval}, nil
+}
+
+// classFor 返回 MyApp 使用的 MyAppClass，未开启 MyAppClass 功能或没有默认的 MyAppClass 时返回 nil
+func (r *MyAppReconciler) classFor(ctx context.Context, m *myappv1.MyApp) (*myappv1.MyAppClass, error) {
+	if !r.Features.Enabled(features.MyAppClass) {
+		return nil, nil
+	}
+	return lookupClass(ctx, r.Client, m)
+}
+
+// holdForClass 在 spec.className 引用的 MyAppClass 不存在时将 MyApp 置为 Pending，
+// MyAppClass 创建后会再次触发协调
+func (r *MyAppReconciler) holdForClass(ctx context.Context, m *myappv1.MyApp) (ctrl.Result, error) {
+	status := *m.Status.DeepCopy()
+	status.Phase, status.Message = "Pending", fmt.Sprintf("等待 MyAppClass %q 创建", m.Spec.ClassName)
+	if err := r.updateStatus(ctx, m, status); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to update MyApp status", logging.KeyAction, actionPatchStatus, logging.KeyResource, "MyApp", logging.KeyResult, reasonStatusFailed)
+		recordOutcome(reasonStatusFailed)
+		return ctrl.Result{}, err
+	}
+	recordMyAppStatus(client.ObjectKeyFromObject(m), status.Phase, m.Spec.Replicas, status.ReadyReplicas)
+	recordOutcome(reasonClassNotFound)
+	log.FromContext(ctx).V(1).Info("Waiting for MyAppClass", logging.KeyResult, reasonClassNotFound, "class", m.Spec.ClassName)
+	return ctrl.Result{}, nil
+}
+
+// hookOutcome 返回钩子未成功时的协调结果
+func hookOutcome(hook myappv1.HookStatus) string {
+	if hook.Phase == myappv1.HookFailed {
+		return reasonHookFailed
+	}
+	return reasonHookPending
+}
+
+// createOrUpdateDeployment 在 Deployment 不存在时创建，存在时同步副本数和镜像，
+// 返回集群中的 Deployment 和本次的协调结果（未修改时为空）
+func (r *MyAppReconciler) createOrUpdateDeployment(ctx context.Context, deployment *appsv1.Deployment) (*appsv1.Deployment, string, error) {
+	logger := log.FromContext(ctx)
+
+	key := client.ObjectKeyFromObject(deployment)
+	found := &appsv1.Deployment{}
+	err := r.Get(ctx, key, found)
+	if err != nil && errors.IsNotFound(err) {
+		err = r.Create(ctx, deployment)
+		switch {
+		case err == nil:
+			logger.Info("Created Deployment", logging.KeyAction, actionCreate, logging.KeyResource, "Deployment", logging.KeyResult, reasonDeploymentCreated)
+			return deployment, reasonDeploymentCreated, nil
+		case errors.IsAlreadyExists(err):
+			// 没有 ManagedByLabel 的旧 Deployment 不在缓存中，从 apiserver 读取后由 deploymentNeedsUpdate 补上标签
+			if err := r.apiReader().Get(ctx, key, found); err != nil {
+				logger.Error(err, "Failed to get Deployment", logging.KeyAction, actionGet, logging.KeyResource, "Deployment", logging.KeyResult, reasonDeploymentFailed)
+				return nil, "", err
+			}
+		default:
+			logger.Error(err, "Failed to create Deployment", logging.KeyAction, actionCreate, logging.KeyResource, "Deployment", logging.KeyResult, reasonDeploymentFailed)
+			return nil, "", err
+		}
+	} else if err != nil {
+		logger.Error(err, "Failed to get Deployment", logging.KeyAction, actionGet, logging.KeyResource, "Deployment", logging.KeyResult, reasonDeploymentFailed)
+		return nil, "", err
+	}
+
+	if !deploymentNeedsUpdate(found, deployment) {
+		logger.V(1).Info("Deployment is up to date", logging.KeyResource, "Deployment")
+		return found, "", nil
+	}
+	if err := r.Update(ctx, found); err != nil {
+		logger.Error(err, "Failed to update Deployment", logging.KeyAction, actionUpdate, logging.KeyResource, "Deployment", logging.KeyResult, reasonDeploymentFailed)
+		return nil, "", err
+	}
+	logger.Info("Updated Deployment", logging.KeyAction, actionUpdate, logging.KeyResource, "Deployment", logging.KeyResult, reasonDeploymentUpdated)
+	return found, reasonDeploymentUpdated, nil
+}
+
+// applyDeployment 通过 server-side apply 声明 Deployment 的期望状态，
+// 返回集群中的 Deployment 和本次的协调结果（未修改时为空）
+func (r *MyAppReconciler) applyDeployment(ctx context.Context, deployment *appsv1.Deployment) (*appsv1.Deployment, string, error) {
+	logger := log.FromContext(ctx)
+
+	existing := &appsv1.Deployment{}
+	err := r.Get(ctx, client.ObjectKeyFromObject(deployment), existing)
+	if err != nil && !errors.IsNotFound(err) {
+		logger.Error(err, "Failed to get Deployment", logging.KeyAction, actionGet, logging.KeyResource, "Deployment", logging.KeyResult, reasonDeploymentFailed)
+		return nil, "", err
+	}
+	created := errors.IsNotFound(err)
+
+	deployment.SetGroupVersionKind(appsv1.SchemeGroupVersion.WithKind("Deployment"))
+	if err := r.Patch(ctx, deployment, client.Apply, client.FieldOwner(fieldOwner), client.ForceOwnership); err != nil {
+		logger.Error(err, "Failed to apply Deployment", logging.KeyAction, actionApply, logging.KeyResource, "Deployment", logging.KeyResult, reasonDeploymentFailed)
+		return nil, "", err
+	}
+
+	switch {
+	case created:
+		logger.Info("Created Deployment", logging.KeyAction, actionApply, logging.KeyResource, "Deployment", logging.KeyResult, reasonDeploymentCreated)
+		return deployment, reasonDeploymentCreated, nil
+	case deployment.ResourceVersion != existing.ResourceVersion:
+		logger.Info("Updated Deployment", logging.KeyAction, actionApply, logging.KeyResource, "Deployment", logging.KeyResult, reasonDeploymentUpdated)
+		return deployment, reasonDeploymentUpdated, nil
+	default:
+		logger.V(1).Info("Deployment is up to date", logging.KeyResource, "Deployment")
+		return deployment, "", nil
+	}
+}
+
+// createOrUpdateService 在 Service 不存在时创建，已存在的 Service 只同步端口和 ManagedByLabel
+func (r *MyAppReconciler) createOrUpdateService(ctx context.Context, service *corev1.Service) error {
+	logger := log.FromContext(ctx)
+
+	key := client.ObjectKeyFromObject(service)
 	foundService := &corev1.Service{}
-	err = r.Get(ctx, client.ObjectKey{Name: service.Name, Namespace: service.Namespace}, foundService)
+	err := r.Get(ctx, key, foundService)
 	if err != nil && errors.IsNotFound(err) {
-		logger.Info("Creating a new Service", "Service.Namespace", service.Namespace, "Service.Name", service.Name)
 		err = r.Create(ctx, service)
-		if err != nil {
-			logger.Error(err, "Failed to create new Service", "Service.Namespace", service.Namespace, "Service.Name", service.Name)
-			return ctrl.Result{}, err
+		switch {
+		case err == nil:
+			logger.Info("Created Service", logging.KeyAction, actionCreate, logging.KeyResource, "Service")
+			return nil
+		case errors.IsAlreadyExists(err):
+			// 没有 ManagedByLabel 的旧 Service 不在缓存中，从 apiserver 读取后补上标签
+			if err := r.apiReader().Get(ctx, key, foundService); err != nil {
+				logger.Error(err, "Failed to get Service", logging.KeyAction, actionGet, logging.KeyResource, "Service", logging.KeyResult, reasonServiceFailed)
+				return err
+			}
+		default:
+			logger.Error(err, "Failed to create Service", logging.KeyAction, actionCreate, logging.KeyResource, "Service", logging.KeyResult, reasonServiceFailed)
+			return err
 		}
 	} else if err != nil {
-		logger.Error(err, "Failed to get Service")
-		return ctrl.Result{}, err
+		logger.Error(err, "Failed to get Service", logging.KeyAction, actionGet, logging.KeyResource, "Service", logging.KeyResult, reasonServiceFailed)
+		return err
+	}
+
+	if serviceNeedsUpdate(foundService, service) {
+		if err := r.Update(ctx, foundService); err != nil {
+			logger.Error(err, "Failed to update Service", logging.KeyAction, actionUpdate, logging.KeyResource, "Service", logging.KeyResult, reasonServiceFailed)
+			return err
+		}
+		logger.Info("Updated Service", logging.KeyAction, actionUpdate, logging.KeyResource, "Service")
 	}
+	return nil
+}
 
-	// 更新状态
-	// 重新获取最新的 MyApp 对象以确保 ResourceVersion 正确
-	finalMyApp := &myappv1.MyApp{}
-	if err := r.Get(ctx, req.NamespacedName, finalMyApp); err != nil {
-		logger.Error(err, "Failed to get latest MyApp for final status update")
-		return ctrl.Result{RequeueAfter: time.Second * 5}, nil
+// apiReader 返回绕过缓存的读取客户端
+func (r *MyAppReconciler) apiReader() client.Reader {
+	if r.APIReader != nil {
+		return r.APIReader
 	}
+	return r.Client
+}
 
-	finalMyApp.Status.ReadyReplicas = found.Status.ReadyReplicas
-	if found.Status.ReadyReplicas == myApp.Spec.Replicas {
-		finalMyApp.Status.Phase = "Running"
-		finalMyApp.Status.Message = "所有副本都已就绪"
-	} else {
-		finalMyApp.Status.Phase = "Pending"
-		finalMyApp.Status.Message = fmt.Sprintf("等待副本就绪: %d/%d", found.Status.ReadyReplicas, myApp.Spec.Replicas)
+// applyService 通过 server-side apply 声明 Service 的期望状态，
+// 与 createOrUpdateService 不同，Service 的所有字段都会被同步
+func (r *MyAppReconciler) applyService(ctx context.Context, service *corev1.Service) error {
+	service.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Service"))
+	if err := r.Patch(ctx, service, client.Apply, client.FieldOwner(fieldOwner), client.ForceOwnership); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to apply Service", logging.KeyAction, actionApply, logging.KeyResource, "Service", logging.KeyResult, reasonServiceFailed)
+		return err
+	}
+	return nil
+}
+
+// deploymentNeedsUpdate 将期望 Deployment 的副本数、容器、共享卷、调度和安全配置、ServiceAccount、版本注解和 ManagedByLabel 同步到已存在的 Deployment，
+// 有变化时返回 true
+func deploymentNeedsUpdate(found, desired *appsv1.Deployment) bool {
+	changed := false
+	if found.Labels[ManagedByLabel] != ManagedByValue {
+		if found.Labels == nil {
+			found.Labels = map[string]string{}
+		}
+		found.Labels[ManagedByLabel] = ManagedByValue
+		changed = true
+	}
+	if revision := desired.Annotations[RevisionAnnotation]; found.Annotations[RevisionAnnotation] != revision {
+		if found.Annotations == nil {
+			found.Annotations = map[string]string{}
+		}
+		found.Annotations[RevisionAnnotation] = revision
+		changed = true
+	}
+	if found.Spec.Replicas == nil || *found.Spec.Replicas != *desired.Spec.Replicas {
+		replicas := *desired.Spec.Replicas
+		found.Spec.Replicas = &replicas
+		changed = true
+	}
+	foundPod, desiredPod := &found.Spec.Template.Spec, &desired.Spec.Template.Spec
+	if syncContainers(&foundPod.Containers, desiredPod.Containers) {
+		changed = true
+	}
+	if syncContainers(&foundPod.InitContainers, desiredPod.InitContainers) {
+		changed = true
+	}
+	if !equality.Semantic.DeepEqual(foundPod.Volumes, desiredPod.Volumes) {
+		foundPod.Volumes = desiredPod.Volumes
+		changed = true
+	}
+	if syncScheduling(foundPod, desiredPod) {
+		changed = true
+	}
+	if syncPodSecurity(foundPod, desiredPod) {
+		changed = true
 	}
+	if foundPod.ServiceAccountName != desiredPod.ServiceAccountName {
+		// serviceAccountName 为空时 apiserver 会使用已废弃的 serviceAccount 字段，需要一起修改
+		foundPod.ServiceAccountName = desiredPod.ServiceAccountName
+		foundPod.DeprecatedServiceAccount = desiredPod.ServiceAccountName
+		changed = true
+	}
+	return changed
+}
 
-	if err := r.Client.Status().Update(ctx, finalMyApp); err != nil {
-		logger.Error(err, "Failed to update MyApp status")
-		return ctrl.Result{RequeueAfter: time.Second * 5}, nil
+// serviceNeedsUpdate 将期望 Service 的端口和 ManagedByLabel 同步到已存在的 Service，有变化时返回 true。
+// 端口只比较控制器设置的字段，apiserver 分配的 nodePort 等字段保持不变
+func serviceNeedsUpdate(found, desired *corev1.Service) bool {
+	changed := false
+	if found.Labels[ManagedByLabel] != ManagedByValue {
+		if found.Labels == nil {
+			found.Labels = map[string]string{}
+		}
+		found.Labels[ManagedByLabel] = ManagedByValue
+		changed = true
 	}
 
-	return ctrl.Result{RequeueAfter: time.Minute}, nil
+	portsMatch := len(found.Spec.Ports) == len(desired.Spec.Ports)
+	for i := 0; portsMatch && i < len(desired.Spec.Ports); i++ {
+		f, d := found.Spec.Ports[i], desired.Spec.Ports[i]
+		portsMatch = f.Name == d.Name && f.Port == d.Port && f.TargetPort == d.TargetPort && f.Protocol == d.Protocol
+	}
+	if !portsMatch {
+		found.Spec.Ports = desired.Spec.Ports
+		changed = true
+	}
+	return changed
+}
+
+// podSecurity 返回 MyApp 生成的 Pod（包括钩子 Job 的 Pod）使用的安全配置
+func (r *MyAppReconciler) podSecurity(m *myappv1.MyApp) myappv1.SecuritySpec {
+	security := effectiveSecurity(r.Defaults.SecurityProfile(), m.Spec.Security)
+	if needsServiceAccountToken(m) {
+		security.AutomountServiceAccountToken = ptr.To(true)
+	}
+	return security
 }
 
 // deploymentForMyApp 为 MyApp 创建 Deployment
@@ -152,33 +620,29 @@ func (r *MyAppReconciler) deploymentForMyApp(m *myappv1.MyApp) *appsv1.Deploymen
 	labels := map[string]string{
 		"app": m.Name,
 	}
+	podSpec, _ := podSpecForMyApp(m, r.Defaults.ResolveImage)
+	applySecurity(&podSpec, r.podSecurity(m))
+	podSpec.ServiceAccountName = serviceAccountName(m)
+	template := corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: labels,
+		},
+		Spec: podSpec,
+	}
 
 	return &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      m.Name,
-			Namespace: m.Namespace,
-			Labels:    labels,
+			Name:        m.Name,
+			Namespace:   m.Namespace,
+			Labels:      withManagedByLabel(labels),
+			Annotations: map[string]string{RevisionAnnotation: podTemplateRevision(&template)},
 		},
 		Spec: appsv1.DeploymentSpec{
 			Replicas: &m.Spec.Replicas,
 			Selector: &metav1.LabelSelector{
 				MatchLabels: labels,
 			},
-			Template: corev1.PodTemplateSpec{
-				ObjectMeta: metav1.ObjectMeta{
-					Labels: labels,
-				},
-				Spec: corev1.PodSpec{
-					Containers: []corev1.Container{{
-						Image: m.Spec.Image,
-						Name:  "app",
-						Ports: []corev1.ContainerPort{{
-							ContainerPort: m.Spec.Port,
-							Name:          "http",
-						}},
-					}},
-				},
-			},
+			Template: template,
 		},
 	}
 }
@@ -188,30 +652,102 @@ func (r *MyAppReconciler) serviceForMyApp(m *myappv1.MyApp) *corev1.Service {
 	labels := map[string]string{
 		"app": m.Name,
 	}
+	ports := []corev1.ServicePort{{
+		Port:       servicePort,
+		TargetPort: intstr.FromInt(int(m.Spec.Port)),
+		Protocol:   corev1.ProtocolTCP,
+	}}
+	_, exposed := podSpecForMyApp(m, r.Defaults.ResolveImage)
+	if len(exposed) > 0 {
+		// 多个端口时每个端口都必须有名称
+		ports[0].Name = appPortName
+		ports = append(ports, exposed...)
+	}
 
 	return &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      m.Name + "-service",
 			Namespace: m.Namespace,
-			Labels:    labels,
+			Labels:    withManagedByLabel(labels),
 		},
 		Spec: corev1.ServiceSpec{
 			Selector: labels,
-			Ports: []corev1.ServicePort{{
-				Port:       80,
-				TargetPort: intstr.FromInt(int(m.Spec.Port)),
-				Protocol:   corev1.ProtocolTCP,
-			}},
-			Type: corev1.ServiceTypeClusterIP,
+			Ports:    ports,
+			Type:     corev1.ServiceTypeClusterIP,
 		},
 	}
 }
 
+// withManagedByLabel 返回加上 ManagedByLabel 的标签副本。
+// 该标签只加在对象自身上，不加到选择器和 Pod 模板中，已有 Deployment 的选择器不可修改
+func withManagedByLabel(labels map[string]string) map[string]string {
+	out := make(map[string]string, len(labels)+1)
+	for k, v := range labels {
+		out[k] = v
+	}
+	out[ManagedByLabel] = ManagedByValue
+	return out
+}
+
 // SetupWithManager 设置 Controller 与 Manager
 func (r *MyAppReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&myappv1.MyApp{}).
-		Owns(&appsv1.Deployment{}).
-		Owns(&corev1.Service{}).
+	opts := r.Options.withDefaults()
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+
+	controllerOptions := crcontroller.Options{
+		MaxConcurrentReconciles: opts.MaxConcurrentReconciles,
+		RateLimiter:             opts.rateLimiter(),
+	}
+	if r.Queue != nil {
+		controllerOptions.NewQueue = r.Queue.NewQueue
+	}
+
+	// 依赖的 MyApp 变化时通过索引找到依赖它的 MyApp
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &myappv1.MyApp{}, dependsOnIndex, indexDependsOn); err != nil {
+		return err
+	}
+
+	// MyAppPolicy 要求的标签变化时也需要重新检查
+	forPredicate := myAppPredicate()
+	if r.Features.Enabled(features.MyAppPolicy) {
+		forPredicate = predicate.Or(forPredicate, predicate.LabelChangedPredicate{})
+	}
+
+	b := ctrl.NewControllerManagedBy(mgr).
+		For(&myappv1.MyApp{}, builder.WithPredicates(countingPredicate("MyApp", forPredicate))).
+		Owns(&appsv1.Deployment{}, builder.WithPredicates(countingPredicate("Deployment", deploymentPredicate()))).
+		Owns(&corev1.Service{}, builder.WithPredicates(countingPredicate("Service", predicate.Funcs{}))).
+		Owns(&batchv1.Job{}, builder.WithPredicates(countingPredicate("Job", predicate.Funcs{}))).
+		Owns(&corev1.ServiceAccount{}, builder.WithPredicates(countingPredicate("ServiceAccount", predicate.Funcs{}))).
+		Owns(&rbacv1.Role{}, builder.WithPredicates(countingPredicate("Role", predicate.Funcs{}))).
+		Owns(&rbacv1.RoleBinding{}, builder.WithPredicates(countingPredicate("RoleBinding", predicate.Funcs{}))).
+		Owns(&networkingv1.NetworkPolicy{}, builder.WithPredicates(countingPredicate("NetworkPolicy", predicate.Funcs{}))).
+		Watches(&myappv1.MyApp{}, handler.EnqueueRequestsFromMapFunc(r.dependentsOf),
+			builder.WithPredicates(countingPredicate("MyAppDependency", phaseOrSpecChangedPredicate())))
+
+	// 只有开启 MyAppClass 功能时才 watch MyAppClass，未安装 MyAppClass CRD 的集群不受影响
+	if r.Features.Enabled(features.MyAppClass) {
+		if err := mgr.GetFieldIndexer().IndexField(context.Background(), &myappv1.MyApp{}, classNameIndex, indexClassName); err != nil {
+			return err
+		}
+		b = b.Watches(&myappv1.MyAppClass{}, handler.EnqueueRequestsFromMapFunc(r.myAppsForClass),
+			builder.WithPredicates(countingPredicate("MyAppClass", predicate.Or[client.Object](
+				predicate.GenerationChangedPredicate{}, predicate.AnnotationChangedPredicate{}))))
+	}
+
+	// MyAppPolicy 变化时重新检查同一命名空间中的所有 MyApp；
+	// MyApp 的副本数变化或被删除时重新检查可能因命名空间配额进入 Failed 的其他 MyApp
+	if r.Features.Enabled(features.MyAppPolicy) {
+		b = b.Watches(&myappv1.MyAppPolicy{}, handler.EnqueueRequestsFromMapFunc(r.myAppsForPolicy),
+			builder.WithPredicates(countingPredicate("MyAppPolicy", predicate.GenerationChangedPredicate{}))).
+			Watches(&myappv1.MyApp{}, handler.EnqueueRequestsFromMapFunc(r.failedNeighborsOf),
+				builder.WithPredicates(countingPredicate("MyAppQuota", specChangedOrDeletedPredicate())))
+	}
+
+	return b.
+		WithLogConstructor(logConstructor(mgr.GetLogger())).
+		WithOptions(controllerOptions).
 		Complete(r)
 }
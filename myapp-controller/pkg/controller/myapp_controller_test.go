@@ -0,0 +1,290 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	myappv1 "github.com/example/myapp-controller/pkg/apis/example/v1"
+)
+
+// newMyApp 构造测试用的 MyApp
+func newMyApp(namespace, name string, replicas int32) *myappv1.MyApp {
+	return &myappv1.MyApp{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Spec: myappv1.MyAppSpec{
+			Image:    "nginx:1.25",
+			Replicas: replicas,
+			Port:     8080,
+		},
+	}
+}
+
+// getDeployment 读取 MyApp 对应的 Deployment
+func getDeployment(ctx context.Context, key types.NamespacedName) (*appsv1.Deployment, error) {
+	deploy := &appsv1.Deployment{}
+	err := k8sClient.Get(ctx, key, deploy)
+	return deploy, err
+}
+
+// setDeploymentReady 模拟 Deployment 控制器更新就绪副本数（envtest 中没有内置控制器）
+func setDeploymentReady(t *testing.T, ctx context.Context, key types.NamespacedName, ready int32) {
+	t.Helper()
+	eventually(t, func() error {
+		deploy, err := getDeployment(ctx, key)
+		if err != nil {
+			return err
+		}
+		deploy.Status.Replicas = ready
+		deploy.Status.ReadyReplicas = ready
+		deploy.Status.AvailableReplicas = ready
+		return k8sClient.Status().Update(ctx, deploy)
+	})
+}
+
+// updateMyApp 读取最新的 MyApp 并应用修改
+func updateMyApp(t *testing.T, ctx context.Context, key types.NamespacedName, mutate func(*myappv1.MyApp)) {
+	t.Helper()
+	eventually(t, func() error {
+		app := &myappv1.MyApp{}
+		if err := k8sClient.Get(ctx, key, app); err != nil {
+			return err
+		}
+		mutate(app)
+		return k8sClient.Update(ctx, app)
+	})
+}
+
+// expectPhase 等待 MyApp 进入指定阶段
+func expectPhase(t *testing.T, ctx context.Context, key types.NamespacedName, phase string, ready int32) {
+	t.Helper()
+	eventually(t, func() error {
+		app := &myappv1.MyApp{}
+		if err := k8sClient.Get(ctx, key, app); err != nil {
+			return err
+		}
+		if app.Status.Phase != phase || app.Status.ReadyReplicas != ready {
+			return fmt.Errorf("status is %s (%d ready), want %s (%d ready)",
+				app.Status.Phase, app.Status.ReadyReplicas, phase, ready)
+		}
+		return nil
+	})
+}
+
+func TestMyAppCreatesDeploymentAndService(t *testing.T) {
+	requireEnvtest(t)
+	ctx := context.Background()
+	ns := createNamespace(t)
+
+	app := newMyApp(ns, "web", 2)
+	if err := k8sClient.Create(ctx, app); err != nil {
+		t.Fatalf("failed to create MyApp: %v", err)
+	}
+	key := client.ObjectKeyFromObject(app)
+
+	eventually(t, func() error {
+		deploy, err := getDeployment(ctx, key)
+		if err != nil {
+			return err
+		}
+		if deploy.Spec.Replicas == nil || *deploy.Spec.Replicas != 2 {
+			return fmt.Errorf("unexpected replicas %v", deploy.Spec.Replicas)
+		}
+		c := deploy.Spec.Template.Spec.Containers[0]
+		if c.Image != "nginx:1.25" || c.Ports[0].ContainerPort != 8080 {
+			return fmt.Errorf("unexpected container %s:%d", c.Image, c.Ports[0].ContainerPort)
+		}
+		if owner := metav1.GetControllerOf(deploy); owner == nil || owner.Name != app.Name {
+			return fmt.Errorf("deployment is not controlled by MyApp")
+		}
+		return nil
+	})
+
+	eventually(t, func() error {
+		svc := &corev1.Service{}
+		if err := k8sClient.Get(ctx, types.NamespacedName{Namespace: ns, Name: "web-service"}, svc); err != nil {
+			return err
+		}
+		if svc.Spec.Ports[0].TargetPort.IntValue() != 8080 {
+			return fmt.Errorf("unexpected target port %s", svc.Spec.Ports[0].TargetPort.String())
+		}
+		if owner := metav1.GetControllerOf(svc); owner == nil || owner.Name != app.Name {
+			return fmt.Errorf("service is not controlled by MyApp")
+		}
+		return nil
+	})
+
+	expectPhase(t, ctx, key, "Pending", 0)
+}
+
+func TestMyAppScaling(t *testing.T) {
+	requireEnvtest(t)
+	ctx := context.Background()
+	ns := createNamespace(t)
+
+	app := newMyApp(ns, "scale", 1)
+	if err := k8sClient.Create(ctx, app); err != nil {
+		t.Fatalf("failed to create MyApp: %v", err)
+	}
+	key := client.ObjectKeyFromObject(app)
+	eventually(t, func() error {
+		_, err := getDeployment(ctx, key)
+		return err
+	})
+
+	updateMyApp(t, ctx, key, func(a *myappv1.MyApp) { a.Spec.Replicas = 4 })
+
+	eventually(t, func() error {
+		deploy, err := getDeployment(ctx, key)
+		if err != nil {
+			return err
+		}
+		if deploy.Spec.Replicas == nil || *deploy.Spec.Replicas != 4 {
+			return fmt.Errorf("replicas not scaled: %v", deploy.Spec.Replicas)
+		}
+		return nil
+	})
+}
+
+func TestMyAppImageUpdate(t *testing.T) {
+	requireEnvtest(t)
+	ctx := context.Background()
+	ns := createNamespace(t)
+
+	app := newMyApp(ns, "image", 1)
+	if err := k8sClient.Create(ctx, app); err != nil {
+		t.Fatalf("failed to create MyApp: %v", err)
+	}
+	key := client.ObjectKeyFromObject(app)
+	eventually(t, func() error {
+		_, err := getDeployment(ctx, key)
+		return err
+	})
+
+	updateMyApp(t, ctx, key, func(a *myappv1.MyApp) { a.Spec.Image = "nginx:1.27" })
+
+	eventually(t, func() error {
+		deploy, err := getDeployment(ctx, key)
+		if err != nil {
+			return err
+		}
+		if image := deploy.Spec.Template.Spec.Containers[0].Image; image != "nginx:1.27" {
+			return fmt.Errorf("image not updated: %s", image)
+		}
+		return nil
+	})
+}
+
+func TestMyAppRecreatesDeletedService(t *testing.T) {
+	requireEnvtest(t)
+	ctx := context.Background()
+	ns := createNamespace(t)
+
+	app := newMyApp(ns, "svc", 1)
+	if err := k8sClient.Create(ctx, app); err != nil {
+		t.Fatalf("failed to create MyApp: %v", err)
+	}
+	svcKey := types.NamespacedName{Namespace: ns, Name: "svc-service"}
+
+	svc := &corev1.Service{}
+	eventually(t, func() error { return k8sClient.Get(ctx, svcKey, svc) })
+	oldUID := svc.UID
+
+	if err := k8sClient.Delete(ctx, svc); err != nil {
+		t.Fatalf("failed to delete Service: %v", err)
+	}
+
+	eventually(t, func() error {
+		recreated := &corev1.Service{}
+		if err := k8sClient.Get(ctx, svcKey, recreated); err != nil {
+			return err
+		}
+		if recreated.UID == oldUID {
+			return fmt.Errorf("service has not been recreated yet")
+		}
+		return nil
+	})
+}
+
+func TestMyAppStatusTransitions(t *testing.T) {
+	requireEnvtest(t)
+	ctx := context.Background()
+	ns := createNamespace(t)
+
+	app := newMyApp(ns, "status", 2)
+	if err := k8sClient.Create(ctx, app); err != nil {
+		t.Fatalf("failed to create MyApp: %v", err)
+	}
+	key := client.ObjectKeyFromObject(app)
+	expectPhase(t, ctx, key, "Pending", 0)
+
+	setDeploymentReady(t, ctx, key, 2)
+	expectPhase(t, ctx, key, "Running", 2)
+
+	// 扩容后副本尚未就绪，应回到 Pending
+	updateMyApp(t, ctx, key, func(a *myappv1.MyApp) { a.Spec.Replicas = 3 })
+	expectPhase(t, ctx, key, "Pending", 2)
+
+	setDeploymentReady(t, ctx, key, 3)
+	expectPhase(t, ctx, key, "Running", 3)
+}
+
+func TestMyAppDeletion(t *testing.T) {
+	requireEnvtest(t)
+	ctx := context.Background()
+	ns := createNamespace(t)
+
+	app := newMyApp(ns, "gone", 1)
+	if err := k8sClient.Create(ctx, app); err != nil {
+		t.Fatalf("failed to create MyApp: %v", err)
+	}
+	key := client.ObjectKeyFromObject(app)
+	expectPhase(t, ctx, key, "Pending", 0)
+
+	if err := k8sClient.Delete(ctx, app); err != nil {
+		t.Fatalf("failed to delete MyApp: %v", err)
+	}
+
+	eventually(t, func() error {
+		err := k8sClient.Get(ctx, key, &myappv1.MyApp{})
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("MyApp still exists: %v", err)
+	})
+
+	// envtest 中没有垃圾回收器，Deployment 依靠 OwnerReference 由集群清理；
+	// 这里校验控制器在 MyApp 删除后清理了该对象的指标
+	eventually(t, func() error {
+		families, err := metrics.Registry.Gather()
+		if err != nil {
+			return err
+		}
+		for _, mf := range families {
+			if mf.GetName() != "myapp_phase" {
+				continue
+			}
+			for _, m := range mf.GetMetric() {
+				labels := map[string]string{}
+				for _, l := range m.GetLabel() {
+					labels[l.GetName()] = l.GetValue()
+				}
+				if labels["namespace"] == ns && labels["name"] == "gone" {
+					return fmt.Errorf("phase metric still present for deleted MyApp")
+				}
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,141 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	myappv1 "github.com/example/myapp-controller/pkg/apis/example/v1"
+	"github.com/example/myapp-controller/pkg/features"
+)
+
+// MyAppValidator 是 MyApp 的准入 webhook，拒绝控制器无法协调的规格、超出 MyAppClass 限制的规格
+// 以及违反 MyAppPolicy 的 MyApp，使错误在 kubectl apply 时就能被发现，而不是在 MyApp 进入 Failed 之后
+type MyAppValidator struct {
+	// Client 读取 MyAppClass 和 MyAppPolicy，通常为 manager 的缓存
+	Client client.Reader
+	// APIReader 绕过缓存读取同一命名空间中的 MyApp，分片时缓存中只有本分片的 MyApp。为 nil 时使用 Client
+	APIReader client.Reader
+	// Defaults 可以热加载的 MyApp 默认值，镜像规则检查补全默认镜像仓库后的镜像，为 nil 时不应用任何默认值
+	Defaults *RuntimeDefaults
+	// Features 功能开关，开启 MyAppClass 或 MyAppPolicy 时才检查对应的规则
+	Features *features.FeatureGate
+}
+
+// apiReader 返回绕过缓存的读取客户端
+func (v *MyAppValidator) apiReader() client.Reader {
+	if v.APIReader != nil {
+		return v.APIReader
+	}
+	return v.Client
+}
+
+// +kubebuilder:webhook:path=/validate-example-com-v1-myapp,mutating=false,failurePolicy=fail,sideEffects=None,groups=example.com,resources=myapps,verbs=create;update,versions=v1,name=vmyapp.example.com,admissionReviewVersions=v1
+
+var _ admission.CustomValidator = &MyAppValidator{}
+
+// SetupWebhookWithManager 在 manager 的 webhook server 上注册 /validate-example-com-v1-myapp
+func (v *MyAppValidator) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&myappv1.MyApp{}).
+		WithValidator(v).
+		Complete()
+}
+
+// ValidateCreate 校验新建的 MyApp
+func (v *MyAppValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	m, ok := obj.(*myappv1.MyApp)
+	if !ok {
+		return nil, fmt.Errorf("expected a MyApp but got %T", obj)
+	}
+	return v.validate(ctx, m)
+}
+
+// ValidateUpdate 校验规格发生变化的 MyApp。只修改元数据时只检查 MyAppPolicy 要求的标签，
+// 使 MyAppClass 或 MyAppPolicy 收紧限制之后已存在的 MyApp 仍然可以修改标签和注解
+func (v *MyAppValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	oldApp, ok := oldObj.(*myappv1.MyApp)
+	if !ok {
+		return nil, fmt.Errorf("expected a MyApp but got %T", oldObj)
+	}
+	m, ok := newObj.(*myappv1.MyApp)
+	if !ok {
+		return nil, fmt.Errorf("expected a MyApp but got %T", newObj)
+	}
+	if equality.Semantic.DeepEqual(oldApp.Spec, m.Spec) {
+		return nil, v.validateLabels(ctx, m)
+	}
+	return v.validate(ctx, m)
+}
+
+// ValidateDelete 不限制删除
+func (v *MyAppValidator) ValidateDelete(context.Context, runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// validate 依次执行与 Reconcile 相同的规格校验、MyAppClass 限制检查和 MyAppPolicy 检查
+func (v *MyAppValidator) validate(ctx context.Context, m *myappv1.MyApp) (admission.Warnings, error) {
+	gk := myappv1.Kind("MyApp").GroupKind()
+	if err := validateSpec(m); err != nil {
+		return nil, errors.NewInvalid(gk, m.Name, field.ErrorList{
+			field.Invalid(field.NewPath("spec"), field.OmitValueType{}, err.Error()),
+		})
+	}
+
+	var warnings admission.Warnings
+	var errs field.ErrorList
+	effective := m.DeepCopy()
+	if v.Features.Enabled(features.MyAppClass) {
+		class, err := lookupClass(ctx, v.Client, m)
+		switch {
+		case errors.IsNotFound(err):
+			// 允许先创建 MyApp 再创建 MyAppClass，MyApp 在此之前保持 Pending
+			warnings = append(warnings, fmt.Sprintf("MyAppClass %q not found, the MyApp stays Pending until it is created", m.Spec.ClassName))
+		case err != nil:
+			return nil, err
+		case class != nil:
+			applyClassDefaults(&effective.Spec, class.Spec.Defaults)
+			errs = append(errs, classViolations(&effective.Spec, class)...)
+		}
+	}
+
+	if v.Features.Enabled(features.MyAppPolicy) {
+		// 准入时统计命名空间中所有其他 MyApp 的副本数，已存在的 MyApp 扩容也不能超出配额
+		policyErrs, err := policyViolations(ctx, v.Client, v.apiReader(), effective, false, v.Defaults.ResolveImage)
+		if err != nil {
+			return nil, err
+		}
+		errs = append(errs, policyErrs...)
+	}
+
+	if len(errs) > 0 {
+		return warnings, errors.NewInvalid(gk, m.Name, errs)
+	}
+	return warnings, nil
+}
+
+// validateLabels 检查 MyApp 是否带有 MyAppPolicy 要求的标签
+func (v *MyAppValidator) validateLabels(ctx context.Context, m *myappv1.MyApp) error {
+	if !v.Features.Enabled(features.MyAppPolicy) {
+		return nil
+	}
+	policies, err := listPolicies(ctx, v.Client, m.Namespace)
+	if err != nil {
+		return err
+	}
+	var errs field.ErrorList
+	for i := range policies {
+		errs = append(errs, labelViolations(m, &policies[i])...)
+	}
+	if len(errs) > 0 {
+		return errors.NewInvalid(myappv1.Kind("MyApp").GroupKind(), m.Name, errs)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	myappv1 "github.com/example/myapp-controller/pkg/apis/example/v1"
+	"github.com/example/myapp-controller/pkg/logging"
+)
+
+// DefaultClassAnnotation 值为 "true" 的 MyAppClass 是未设置 spec.className 的 MyApp 使用的默认 MyAppClass
+const DefaultClassAnnotation = "myapp.example.com/is-default-class"
+
+// classNameIndex 是 MyApp 按 spec.className 建立的缓存索引，未设置时为空字符串
+const classNameIndex = "spec.className"
+
+// indexClassName 为 classNameIndex 提取 MyApp 的 spec.className
+func indexClassName(obj client.Object) []string {
+	m, ok := obj.(*myappv1.MyApp)
+	if !ok {
+		return nil
+	}
+	return []string{m.Spec.ClassName}
+}
+
+// lookupClass 返回 MyApp 使用的 MyAppClass：设置了 spec.className 时读取该 MyAppClass，
+// 不存在时返回 NotFound 错误；未设置时返回默认的 MyAppClass，没有默认的 MyAppClass 时返回 nil
+func lookupClass(ctx context.Context, c client.Reader, m *myappv1.MyApp) (*myappv1.MyAppClass, error) {
+	if m.Spec.ClassName != "" {
+		class := &myappv1.MyAppClass{}
+		if err := c.Get(ctx, types.NamespacedName{Name: m.Spec.ClassName}, class); err != nil {
+			return nil, err
+		}
+		return class, nil
+	}
+
+	classes := &myappv1.MyAppClassList{}
+	if err := c.List(ctx, classes); err != nil {
+		return nil, err
+	}
+	// 与 StorageClass 相同，存在多个默认的 MyAppClass 时使用最新创建的
+	var found *myappv1.MyAppClass
+	for i := range classes.Items {
+		class := &classes.Items[i]
+		if class.Annotations[DefaultClassAnnotation] != "true" {
+			continue
+		}
+		if found == nil || found.CreationTimestamp.Before(&class.CreationTimestamp) ||
+			(found.CreationTimestamp.Equal(&class.CreationTimestamp) && class.Name < found.Name) {
+			found = class
+		}
+	}
+	return found, nil
+}
+
+// applyClassDefaults 将 MyAppClass 的默认值写入 MyApp 中未设置的字段
+func applyClassDefaults(spec *myappv1.MyAppSpec, d myappv1.MyAppClassDefaults) {
+	d = *d.DeepCopy()
+	if d.Resources != nil && len(spec.Resources.Requests) == 0 && len(spec.Resources.Limits) == 0 {
+		spec.Resources = *d.Resources
+	}
+	if spec.ReadinessProbe == nil {
+		spec.ReadinessProbe = d.ReadinessProbe
+	}
+	if spec.LivenessProbe == nil {
+		spec.LivenessProbe = d.LivenessProbe
+	}
+	if d.Security != nil {
+		// spec.security 中设置的字段优先，未设置的字段使用 MyAppClass 的值
+		overlaySecurity(d.Security, spec.Security)
+		spec.Security = d.Security
+	}
+	if len(spec.NodeSelector) == 0 {
+		spec.NodeSelector = d.NodeSelector
+	}
+	if len(spec.Tolerations) == 0 {
+		spec.Tolerations = d.Tolerations
+	}
+	if spec.PriorityClassName == "" {
+		spec.PriorityClassName = d.PriorityClassName
+	}
+}
+
+// classViolations 返回应用默认值后的 MyApp 规格超出 MyAppClass 限制的字段。
+// 资源上限只检查容器设置了的请求和限制
+func classViolations(spec *myappv1.MyAppSpec, class *myappv1.MyAppClass) field.ErrorList {
+	var errs field.ErrorList
+	limits := class.Spec.Limits
+	path := field.NewPath("spec")
+
+	if limits.MaxReplicas != nil && spec.Replicas > *limits.MaxReplicas {
+		errs = append(errs, field.Invalid(path.Child("replicas"), spec.Replicas,
+			fmt.Sprintf("exceeds the maximum of %d allowed by MyAppClass %q", *limits.MaxReplicas, class.Name)))
+	}
+
+	names := make([]string, 0, len(limits.MaxResources))
+	for name := range limits.MaxResources {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+	checkResources := func(p *field.Path, res corev1.ResourceRequirements) {
+		for _, kind := range []struct {
+			name string
+			list corev1.ResourceList
+		}{{"requests", res.Requests}, {"limits", res.Limits}} {
+			for _, name := range names {
+				max := limits.MaxResources[corev1.ResourceName(name)]
+				if q, ok := kind.list[corev1.ResourceName(name)]; ok && q.Cmp(max) > 0 {
+					errs = append(errs, field.Invalid(p.Child(kind.name).Key(name), q.String(),
+						fmt.Sprintf("exceeds the maximum of %s allowed by MyAppClass %q", max.String(), class.Name)))
+				}
+			}
+		}
+	}
+	checkResources(path.Child("resources"), spec.Resources)
+	for i, c := range spec.Sidecars {
+		checkResources(path.Child("sidecars").Index(i).Child("resources"), c.Resources)
+	}
+	for i, c := range spec.InitContainers {
+		checkResources(path.Child("initContainers").Index(i).Child("resources"), c.Resources)
+	}
+	return errs
+}
+
+// myAppsForClass 在 MyAppClass 变化时返回引用它的 MyApp。
+// 默认的 MyAppClass 可能随任意 MyAppClass 的注解变化而改变，因此同时返回所有未设置 spec.className 的 MyApp
+func (r *MyAppReconciler) myAppsForClass(ctx context.Context, obj client.Object) []reconcile.Request {
+	var requests []reconcile.Request
+	for _, name := range []string{obj.GetName(), ""} {
+		var apps myappv1.MyAppList
+		if err := r.List(ctx, &apps, client.MatchingFields{classNameIndex: name}); err != nil {
+			log.FromContext(ctx).Error(err, "Failed to list MyApps for MyAppClass", logging.KeyAction, actionGet, logging.KeyResource, "MyApp", "class", obj.GetName())
+			return nil
+		}
+		for _, m := range apps.Items {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&m)})
+		}
+	}
+	return requests
+}
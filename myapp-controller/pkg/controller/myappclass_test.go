@@ -0,0 +1,229 @@
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	myappv1 "github.com/example/myapp-controller/pkg/apis/example/v1"
+	"github.com/example/myapp-controller/pkg/features"
+)
+
+// newMyAppClass 返回带有资源和探针默认值、最多 3 个副本和每个容器最多 1 CPU 的 MyAppClass
+func newMyAppClass(name string) *myappv1.MyAppClass {
+	return &myappv1.MyAppClass{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: myappv1.MyAppClassSpec{
+			Defaults: myappv1.MyAppClassDefaults{
+				Resources: &corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")},
+					Limits:   corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("500m")},
+				},
+				ReadinessProbe: &corev1.Probe{ProbeHandler: corev1.ProbeHandler{
+					HTTPGet: &corev1.HTTPGetAction{Path: "/healthz", Port: intstr.FromInt32(8080)},
+				}},
+				Security: &myappv1.SecuritySpec{RunAsUser: ptr.To[int64](1000), RunAsGroup: ptr.To[int64](1000)},
+			},
+			Limits: myappv1.MyAppClassLimits{
+				MaxReplicas:  ptr.To[int32](3),
+				MaxResources: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")},
+			},
+		},
+	}
+}
+
+// classFeatures 返回开启了 MyAppClass 的功能开关
+func classFeatures(t *testing.T) *features.FeatureGate {
+	t.Helper()
+	gate := features.NewFeatureGate()
+	if err := gate.SetFromMap(map[string]bool{string(features.MyAppClass): true}); err != nil {
+		t.Fatalf("failed to enable MyAppClass: %v", err)
+	}
+	return gate
+}
+
+func TestApplyClassDefaults(t *testing.T) {
+	class := newMyAppClass("standard")
+	class.Spec.Defaults.NodeSelector = map[string]string{"pool": "general"}
+
+	spec := newMyApp("default", "web", 1).Spec
+	spec.NodeSelector = map[string]string{"pool": "gpu"}
+	spec.Security = &myappv1.SecuritySpec{RunAsUser: ptr.To[int64](2000)}
+	applyClassDefaults(&spec, class.Spec.Defaults)
+
+	if spec.Resources.Limits.Cpu().String() != "500m" || spec.ReadinessProbe == nil {
+		t.Errorf("class defaults were not applied: resources=%v probe=%v", spec.Resources, spec.ReadinessProbe)
+	}
+	if spec.NodeSelector["pool"] != "gpu" {
+		t.Errorf("nodeSelector = %v, want the MyApp's own value", spec.NodeSelector)
+	}
+	// spec.security 逐个字段覆盖 MyAppClass 的值
+	if ptr.Deref(spec.Security.RunAsUser, 0) != 2000 || ptr.Deref(spec.Security.RunAsGroup, 0) != 1000 {
+		t.Errorf("security = %+v, want runAsUser from the MyApp and runAsGroup from the class", spec.Security)
+	}
+	if ptr.Deref(class.Spec.Defaults.Security.RunAsUser, 0) != 1000 {
+		t.Errorf("applyClassDefaults modified the MyAppClass")
+	}
+
+	// 设置了资源的 MyApp 不使用 MyAppClass 的资源
+	spec = newMyApp("default", "web", 1).Spec
+	spec.Resources.Requests = corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("64Mi")}
+	applyClassDefaults(&spec, class.Spec.Defaults)
+	if len(spec.Resources.Limits) != 0 {
+		t.Errorf("resources = %v, want the MyApp's own resources", spec.Resources)
+	}
+}
+
+func TestClassViolations(t *testing.T) {
+	class := newMyAppClass("standard")
+	spec := newMyApp("default", "web", 5).Spec
+	spec.Resources.Limits = corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("2")}
+	spec.Sidecars = []myappv1.Container{{
+		Name: "proxy", Image: "envoy:v1",
+		Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1500m")}},
+	}}
+
+	var fields []string
+	for _, err := range classViolations(&spec, class) {
+		fields = append(fields, err.Field)
+	}
+	want := "spec.replicas,spec.resources.limits[cpu],spec.sidecars[0].resources.requests[cpu]"
+	if strings.Join(fields, ",") != want {
+		t.Errorf("violations = %v, want %s", fields, want)
+	}
+
+	spec = newMyApp("default", "web", 3).Spec
+	spec.Resources.Limits = corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")}
+	if errs := classViolations(&spec, class); len(errs) > 0 {
+		t.Errorf("spec at the limits was rejected: %v", errs)
+	}
+}
+
+func TestLookupClass(t *testing.T) {
+	older, newer, other := newMyAppClass("older"), newMyAppClass("newer"), newMyAppClass("other")
+	older.Annotations = map[string]string{DefaultClassAnnotation: "true"}
+	older.CreationTimestamp = metav1.NewTime(time.Now().Add(-time.Hour))
+	newer.Annotations = map[string]string{DefaultClassAnnotation: "true"}
+	newer.CreationTimestamp = metav1.NewTime(time.Now())
+	c := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(older, newer, other).Build()
+	ctx := context.Background()
+
+	m := newMyApp("default", "web", 1)
+	if class, err := lookupClass(ctx, c, m); err != nil || class == nil || class.Name != "newer" {
+		t.Errorf("default class = %v (%v), want the newest default class", class, err)
+	}
+	m.Spec.ClassName = "other"
+	if class, err := lookupClass(ctx, c, m); err != nil || class.Name != "other" {
+		t.Errorf("class = %v (%v), want other", class, err)
+	}
+	m.Spec.ClassName = "missing"
+	if _, err := lookupClass(ctx, c, m); !apierrors.IsNotFound(err) {
+		t.Errorf("err = %v, want NotFound", err)
+	}
+
+	empty := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(other).Build()
+	if class, err := lookupClass(ctx, empty, newMyApp("default", "web", 1)); err != nil || class != nil {
+		t.Errorf("class = %v (%v), want none without a default class", class, err)
+	}
+}
+
+func TestFakeReconcileMyAppClass(t *testing.T) {
+	class := newMyAppClass("standard")
+	class.Annotations = map[string]string{DefaultClassAnnotation: "true"}
+	app := newMyApp("default", "web", 2)
+	key := client.ObjectKeyFromObject(app)
+	h := newFakeHarness(t, app, class)
+	h.reconciler.Features = classFeatures(t)
+
+	h.reconcile(key)
+	container := h.deployment(key).Spec.Template.Spec.Containers[0]
+	if container.Resources.Limits.Cpu().String() != "500m" {
+		t.Errorf("resources = %v, want the class defaults", container.Resources)
+	}
+	if container.ReadinessProbe == nil || container.ReadinessProbe.PeriodSeconds != 10 || container.ReadinessProbe.HTTPGet.Scheme != corev1.URISchemeHTTP {
+		t.Errorf("readinessProbe = %+v, want the class default with apiserver defaults filled in", container.ReadinessProbe)
+	}
+	if h.myApp(key).Spec.Resources.Limits != nil {
+		t.Errorf("class defaults were written back to the MyApp spec")
+	}
+
+	// 超出 MyAppClass 限制时进入 Failed，Deployment 保持不变
+	h.updateSpec(key, func(spec *myappv1.MyAppSpec) { spec.Replicas = 5 })
+	h.reconcile(key)
+	status := h.myApp(key).Status
+	if status.Phase != "Failed" || !strings.Contains(status.Message, "spec.replicas") {
+		t.Fatalf("status = %+v, want Failed because of the replica limit", status)
+	}
+	if replicas := ptr.Deref(h.deployment(key).Spec.Replicas, 0); replicas != 2 {
+		t.Errorf("Deployment replicas = %d, want 2", replicas)
+	}
+
+	// 引用不存在的 MyAppClass 时等待它被创建
+	h.updateSpec(key, func(spec *myappv1.MyAppSpec) { spec.Replicas = 2; spec.ClassName = "premium" })
+	h.reconcile(key)
+	if status := h.myApp(key).Status; status.Phase != "Pending" || !strings.Contains(status.Message, "premium") {
+		t.Fatalf("status = %+v, want Pending until the class exists", status)
+	}
+	if err := h.client.Create(context.Background(), newMyAppClass("premium")); err != nil {
+		t.Fatalf("failed to create MyAppClass: %v", err)
+	}
+	h.reconcile(key)
+	if status := h.myApp(key).Status; status.Phase == "Pending" && strings.Contains(status.Message, "premium") {
+		t.Errorf("MyApp is still waiting for the class: %+v", status)
+	}
+}
+
+func TestMyAppValidator(t *testing.T) {
+	class := newMyAppClass("standard")
+	class.Annotations = map[string]string{DefaultClassAnnotation: "true"}
+	v := &MyAppValidator{
+		Client:   fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(class).Build(),
+		Features: classFeatures(t),
+	}
+	ctx := context.Background()
+
+	if _, err := v.ValidateCreate(ctx, newMyApp("default", "web", 2)); err != nil {
+		t.Errorf("valid MyApp was rejected: %v", err)
+	}
+
+	tooLarge := newMyApp("default", "web", 5)
+	_, err := v.ValidateCreate(ctx, tooLarge)
+	if !apierrors.IsInvalid(err) || !strings.Contains(err.Error(), "spec.replicas") {
+		t.Errorf("err = %v, want the replica limit to be enforced", err)
+	}
+
+	invalid := newMyApp("default", "web", 1)
+	invalid.Spec.VolumeMounts = []corev1.VolumeMount{{Name: "cache", MountPath: "/cache"}}
+	if _, err := v.ValidateCreate(ctx, invalid); !apierrors.IsInvalid(err) || !strings.Contains(err.Error(), "undefined volume") {
+		t.Errorf("err = %v, want the spec validation to run", err)
+	}
+
+	missing := newMyApp("default", "web", 1)
+	missing.Spec.ClassName = "premium"
+	if warnings, err := v.ValidateCreate(ctx, missing); err != nil || len(warnings) != 1 {
+		t.Errorf("warnings = %v, err = %v, want a warning for the missing class", warnings, err)
+	}
+
+	// 规格未变化的更新不受收紧后的限制影响
+	relabeled := tooLarge.DeepCopy()
+	relabeled.Labels = map[string]string{"team": "shop"}
+	if _, err := v.ValidateUpdate(ctx, tooLarge, relabeled); err != nil {
+		t.Errorf("metadata-only update was rejected: %v", err)
+	}
+
+	// 未开启 MyAppClass 时不检查限制
+	v.Features = features.NewFeatureGate()
+	if _, err := v.ValidateCreate(ctx, tooLarge); err != nil {
+		t.Errorf("class limits were enforced with the feature disabled: %v", err)
+	}
+}
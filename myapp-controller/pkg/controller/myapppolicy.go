@@ -0,0 +1,241 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	myappv1 "github.com/example/myapp-controller/pkg/apis/example/v1"
+	"github.com/example/myapp-controller/pkg/logging"
+)
+
+// listPolicies 返回命名空间中按名称排序的 MyAppPolicy
+func listPolicies(ctx context.Context, c client.Reader, namespace string) ([]myappv1.MyAppPolicy, error) {
+	policies := &myappv1.MyAppPolicyList{}
+	if err := c.List(ctx, policies, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+	sort.Slice(policies.Items, func(i, j int) bool { return policies.Items[i].Name < policies.Items[j].Name })
+	return policies.Items, nil
+}
+
+// policyViolations 返回 MyApp 违反的其命名空间中 MyAppPolicy 的规则。
+// MyAppPolicy 从 c 读取，命名空间中的其他 MyApp 从 apps 读取：分片时缓存只包含本分片的 MyApp，apps 需要绕过缓存。
+// olderOnly 的含义与 namespaceReplicas 相同，resolve 返回实际使用的镜像，与 podSpecForMyApp 相同
+func policyViolations(ctx context.Context, c, apps client.Reader, m *myappv1.MyApp, olderOnly bool, resolve func(string) string) (field.ErrorList, error) {
+	policies, err := listPolicies(ctx, c, m.Namespace)
+	if err != nil || len(policies) == 0 {
+		return nil, err
+	}
+
+	var others int32
+	for _, p := range policies {
+		if p.Spec.MaxReplicasPerNamespace != nil {
+			if others, err = namespaceReplicas(ctx, apps, m, olderOnly); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+
+	var errs field.ErrorList
+	for i := range policies {
+		errs = append(errs, checkPolicy(m, &policies[i], others, resolve)...)
+	}
+	return errs, nil
+}
+
+// namespaceReplicas 返回命名空间中其他未被删除的 MyApp 的副本数之和。
+// olderOnly 为 true 时只统计比 m 先创建的 MyApp，使超出配额时只有后创建的 MyApp 进入 Failed，
+// 已经在运行的 MyApp 不受影响
+func namespaceReplicas(ctx context.Context, c client.Reader, m *myappv1.MyApp, olderOnly bool) (int32, error) {
+	apps := &myappv1.MyAppList{}
+	if err := c.List(ctx, apps, client.InNamespace(m.Namespace)); err != nil {
+		return 0, err
+	}
+	var total int32
+	for i := range apps.Items {
+		other := &apps.Items[i]
+		if other.Name == m.Name || other.DeletionTimestamp != nil {
+			continue
+		}
+		if olderOnly && !createdBefore(other, m) {
+			continue
+		}
+		total += other.Spec.Replicas
+	}
+	return total, nil
+}
+
+// createdBefore 报告 a 是否比 b 先创建，创建时间相同时按名称排序
+func createdBefore(a, b *myappv1.MyApp) bool {
+	if a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+		return a.Name < b.Name
+	}
+	return a.CreationTimestamp.Before(&b.CreationTimestamp)
+}
+
+// checkPolicy 返回 MyApp 违反 policy 的字段，otherReplicas 是命名空间中计入配额的其他 MyApp 的副本数之和。
+// 镜像规则检查 resolve 补全默认镜像仓库后的镜像，即 Pod 实际拉取的镜像
+func checkPolicy(m *myappv1.MyApp, policy *myappv1.MyAppPolicy, otherReplicas int32, resolve func(string) string) field.ErrorList {
+	errs := labelViolations(m, policy)
+	spec := &policy.Spec
+
+	for _, img := range myAppImages(m) {
+		image := resolve(img.image)
+		if msg := imageViolation(image, spec.Images); msg != "" {
+			errs = append(errs, field.Forbidden(img.path, fmt.Sprintf("image %q %s by MyAppPolicy %q", image, msg, policy.Name)))
+		}
+	}
+
+	replicas := field.NewPath("spec", "replicas")
+	if spec.MaxReplicasPerApp != nil && m.Spec.Replicas > *spec.MaxReplicasPerApp {
+		errs = append(errs, field.Invalid(replicas, m.Spec.Replicas,
+			fmt.Sprintf("exceeds the maximum of %d allowed by MyAppPolicy %q", *spec.MaxReplicasPerApp, policy.Name)))
+	}
+	if spec.MaxReplicasPerNamespace != nil && otherReplicas+m.Spec.Replicas > *spec.MaxReplicasPerNamespace {
+		errs = append(errs, field.Invalid(replicas, m.Spec.Replicas,
+			fmt.Sprintf("brings the namespace total to %d, above the maximum of %d allowed by MyAppPolicy %q",
+				otherReplicas+m.Spec.Replicas, *spec.MaxReplicasPerNamespace, policy.Name)))
+	}
+	return errs
+}
+
+// labelViolations 返回 MyApp 缺少的 policy 要求的标签
+func labelViolations(m *myappv1.MyApp, policy *myappv1.MyAppPolicy) field.ErrorList {
+	var errs field.ErrorList
+	for _, key := range policy.Spec.RequiredLabels {
+		if _, ok := m.Labels[key]; !ok {
+			errs = append(errs, field.Required(field.NewPath("metadata", "labels").Key(key),
+				fmt.Sprintf("required by MyAppPolicy %q", policy.Name)))
+		}
+	}
+	return errs
+}
+
+// podImage 是 MyApp 中的一个容器镜像及其字段路径
+type podImage struct {
+	path  *field.Path
+	image string
+}
+
+// myAppImages 返回 MyApp 中所有容器的镜像，包括 sidecar、init 容器和钩子 Job 的容器
+func myAppImages(m *myappv1.MyApp) []podImage {
+	spec := field.NewPath("spec")
+	images := []podImage{{spec.Child("image"), m.Spec.Image}}
+	for i, c := range m.Spec.Sidecars {
+		images = append(images, podImage{spec.Child("sidecars").Index(i).Child("image"), c.Image})
+	}
+	for i, c := range m.Spec.InitContainers {
+		images = append(images, podImage{spec.Child("initContainers").Index(i).Child("image"), c.Image})
+	}
+	if m.Spec.Hooks == nil {
+		return images
+	}
+	hookImages := func(p *field.Path, containers []corev1.Container) {
+		for i, c := range containers {
+			images = append(images, podImage{p.Index(i).Child("image"), c.Image})
+		}
+	}
+	if job := m.Spec.Hooks.PreDeploy; job != nil {
+		p := spec.Child("hooks", "preDeploy", "template", "spec")
+		hookImages(p.Child("initContainers"), job.Template.Spec.InitContainers)
+		hookImages(p.Child("containers"), job.Template.Spec.Containers)
+	}
+	if job := m.Spec.Hooks.PostDeploy; job != nil {
+		p := spec.Child("hooks", "postDeploy", "template", "spec")
+		hookImages(p.Child("initContainers"), job.Template.Spec.InitContainers)
+		hookImages(p.Child("containers"), job.Template.Spec.Containers)
+	}
+	return images
+}
+
+// imageViolation 返回镜像违反 ImagePolicy 的原因，满足时返回空字符串
+func imageViolation(image string, p myappv1.ImagePolicy) string {
+	repo := imageRepository(image)
+	for _, pattern := range p.DeniedRegistries {
+		if matchRegistry(pattern, repo) {
+			return "is from a registry denied"
+		}
+	}
+	if len(p.AllowedRegistries) == 0 {
+		return ""
+	}
+	for _, pattern := range p.AllowedRegistries {
+		if matchRegistry(pattern, repo) {
+			return ""
+		}
+	}
+	return "is not from a registry allowed"
+}
+
+// imageRepository 返回镜像不含标签和摘要的完整仓库路径，没有仓库地址的镜像补全为 docker.io 的镜像，
+// 例如 nginx:1.25 返回 docker.io/library/nginx
+func imageRepository(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+	first, _, found := strings.Cut(image, "/")
+	switch {
+	case !found:
+		return "docker.io/library/" + image
+	case !strings.ContainsAny(first, ".:") && first != "localhost":
+		return "docker.io/" + image
+	default:
+		return image
+	}
+}
+
+// matchRegistry 报告 pattern 是否匹配仓库路径 repo 的某个以 / 分隔的前缀
+func matchRegistry(pattern, repo string) bool {
+	pattern = strings.TrimSuffix(pattern, "/")
+	parts := strings.Split(repo, "/")
+	for i := 1; i <= len(parts); i++ {
+		if ok, _ := path.Match(pattern, strings.Join(parts[:i], "/")); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// myAppsForPolicy 在 MyAppPolicy 变化时返回同一命名空间中的所有 MyApp
+func (r *MyAppReconciler) myAppsForPolicy(ctx context.Context, obj client.Object) []reconcile.Request {
+	var apps myappv1.MyAppList
+	if err := r.List(ctx, &apps, client.InNamespace(obj.GetNamespace())); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list MyApps for MyAppPolicy", logging.KeyAction, actionGet, logging.KeyResource, "MyApp", "policy", obj.GetName())
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(apps.Items))
+	for _, m := range apps.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&m)})
+	}
+	return requests
+}
+
+// failedNeighborsOf 在 MyApp 的规格变化或被删除时返回同一命名空间中处于 Failed 的其他 MyApp，
+// 使因命名空间副本数配额进入 Failed 的 MyApp 在配额释放后重新检查
+func (r *MyAppReconciler) failedNeighborsOf(ctx context.Context, obj client.Object) []reconcile.Request {
+	var apps myappv1.MyAppList
+	if err := r.List(ctx, &apps, client.InNamespace(obj.GetNamespace())); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list MyApps in namespace", logging.KeyAction, actionGet, logging.KeyResource, "MyApp", "namespace", obj.GetNamespace())
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, m := range apps.Items {
+		if m.Name != obj.GetName() && m.Status.Phase == "Failed" {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&m)})
+		}
+	}
+	return requests
+}
@@ -0,0 +1,270 @@
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	myappv1 "github.com/example/myapp-controller/pkg/apis/example/v1"
+	"github.com/example/myapp-controller/pkg/features"
+)
+
+// newMyAppPolicy 返回只允许 registry.example.com 镜像、单个 MyApp 最多 3 个副本、命名空间最多 4 个副本的 MyAppPolicy
+func newMyAppPolicy(namespace, name string) *myappv1.MyAppPolicy {
+	return &myappv1.MyAppPolicy{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec: myappv1.MyAppPolicySpec{
+			Images:                  myappv1.ImagePolicy{AllowedRegistries: []string{"registry.example.com"}},
+			MaxReplicasPerApp:       ptr.To[int32](3),
+			MaxReplicasPerNamespace: ptr.To[int32](4),
+		},
+	}
+}
+
+// policyFeatures 返回开启了 MyAppPolicy 的功能开关
+func policyFeatures(t *testing.T) *features.FeatureGate {
+	t.Helper()
+	gate := features.NewFeatureGate()
+	if err := gate.SetFromMap(map[string]bool{string(features.MyAppPolicy): true}); err != nil {
+		t.Fatalf("failed to enable MyAppPolicy: %v", err)
+	}
+	return gate
+}
+
+// internalApp 返回使用 registry.example.com 镜像、创建时间为 created 的 MyApp
+func internalApp(name string, replicas int32, created time.Time) *myappv1.MyApp {
+	m := newMyApp("default", name, replicas)
+	m.Spec.Image = "registry.example.com/shop/" + name + ":v1"
+	m.CreationTimestamp = metav1.NewTime(created)
+	return m
+}
+
+func TestImageRepository(t *testing.T) {
+	tests := map[string]string{
+		"nginx":                                    "docker.io/library/nginx",
+		"nginx:1.25":                               "docker.io/library/nginx",
+		"bitnami/redis:7":                          "docker.io/bitnami/redis",
+		"registry.example.com/shop/web:v1":         "registry.example.com/shop/web",
+		"localhost:5000/web":                       "localhost:5000/web",
+		"localhost/web@sha256:0123456789abcdef":    "localhost/web",
+		"registry.example.com:443/web:v1@sha256:0": "registry.example.com:443/web",
+	}
+	for image, want := range tests {
+		if got := imageRepository(image); got != want {
+			t.Errorf("imageRepository(%q) = %q, want %q", image, got, want)
+		}
+	}
+}
+
+func TestImageViolation(t *testing.T) {
+	policy := myappv1.ImagePolicy{
+		AllowedRegistries: []string{"registry.example.com", "*.corp.example.com"},
+		DeniedRegistries:  []string{"registry.example.com/legacy"},
+	}
+	tests := []struct {
+		image   string
+		allowed bool
+	}{
+		{image: "registry.example.com/shop/web:v1", allowed: true},
+		{image: "mirror.corp.example.com/envoy:v1", allowed: true},
+		{image: "registry.example.com/legacy/web:v1", allowed: false},
+		{image: "registry.example.com.evil.io/web:v1", allowed: false},
+		{image: "nginx:1.25", allowed: false},
+	}
+	for _, tc := range tests {
+		if got := imageViolation(tc.image, policy) == ""; got != tc.allowed {
+			t.Errorf("image %q allowed = %v, want %v", tc.image, got, tc.allowed)
+		}
+	}
+	if msg := imageViolation("nginx:1.25", myappv1.ImagePolicy{}); msg != "" {
+		t.Errorf("empty policy rejected an image: %s", msg)
+	}
+}
+
+func TestCheckPolicy(t *testing.T) {
+	policy := newMyAppPolicy("default", "guardrails")
+	policy.Spec.RequiredLabels = []string{"team"}
+
+	m := internalApp("web", 4, time.Now())
+	m.Spec.Sidecars = []myappv1.Container{{Name: "proxy", Image: "envoy:v1"}}
+	m.Spec.Hooks = &myappv1.Hooks{PreDeploy: &batchv1.JobSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+		Containers: []corev1.Container{{Name: "migrate", Image: "registry.example.com/shop/migrate:v1"}},
+	}}}}
+
+	var fields []string
+	for _, err := range checkPolicy(m, policy, 1, (*RuntimeDefaults)(nil).ResolveImage) {
+		fields = append(fields, err.Field)
+	}
+	want := "metadata.labels[team],spec.sidecars[0].image,spec.replicas,spec.replicas"
+	if strings.Join(fields, ",") != want {
+		t.Errorf("violations = %v, want %s", fields, want)
+	}
+
+	m = internalApp("web", 3, time.Now())
+	m.Labels = map[string]string{"team": "shop"}
+	if errs := checkPolicy(m, policy, 1, (*RuntimeDefaults)(nil).ResolveImage); len(errs) > 0 {
+		t.Errorf("MyApp within the policy was rejected: %v", errs)
+	}
+}
+
+func TestCheckPolicyDefaultRegistry(t *testing.T) {
+	policy := newMyAppPolicy("default", "guardrails")
+	defaults := &RuntimeDefaults{}
+	defaults.SetImageRegistry("registry.example.com")
+
+	// 补全默认镜像仓库后 web:v1 拉取的是 registry.example.com/web:v1
+	m := newMyApp("default", "web", 1)
+	m.Spec.Image = "web:v1"
+	m.Spec.Sidecars = []myappv1.Container{{Name: "proxy", Image: "docker.io/envoyproxy/envoy:v1"}}
+	errs := checkPolicy(m, policy, 0, defaults.ResolveImage)
+	if len(errs) != 1 || errs[0].Field != "spec.sidecars[0].image" {
+		t.Fatalf("violations = %v, want only the sidecar from docker.io", errs)
+	}
+
+	// 默认镜像仓库被拒绝时，没有仓库地址的镜像同样被拒绝
+	policy.Spec.Images = myappv1.ImagePolicy{DeniedRegistries: []string{"registry.example.com"}}
+	errs = checkPolicy(m, policy, 0, defaults.ResolveImage)
+	if len(errs) != 1 || errs[0].Field != "spec.image" || !strings.Contains(errs[0].Detail, "registry.example.com/web:v1") {
+		t.Fatalf("violations = %v, want spec.image to be denied", errs)
+	}
+}
+
+func TestFakeReconcileMyAppPolicy(t *testing.T) {
+	now := time.Now()
+	older, newer := internalApp("api", 3, now.Add(-time.Hour)), internalApp("web", 2, now)
+	olderKey, newerKey := client.ObjectKeyFromObject(older), client.ObjectKeyFromObject(newer)
+	h := newFakeHarness(t, older, newer, newMyAppPolicy("default", "guardrails"))
+	h.reconciler.Features = policyFeatures(t)
+
+	// 超出命名空间配额时只有后创建的 MyApp 进入 Failed
+	h.reconcile(olderKey)
+	h.reconcile(newerKey)
+	if phase := h.myApp(olderKey).Status.Phase; phase == "Failed" {
+		t.Errorf("older MyApp is Failed, want it to keep running")
+	}
+	status := h.myApp(newerKey).Status
+	if status.Phase != "Failed" || !strings.Contains(status.Message, "namespace total to 5") {
+		t.Fatalf("status = %+v, want Failed because of the namespace quota", status)
+	}
+	if err := h.client.Get(context.Background(), newerKey, &appsv1.Deployment{}); !apierrors.IsNotFound(err) {
+		t.Errorf("Deployment of the Failed MyApp was created: %v", err)
+	}
+
+	// 释放配额后重新协调即可继续
+	h.updateSpec(olderKey, func(spec *myappv1.MyAppSpec) { spec.Replicas = 2 })
+	h.reconcile(newerKey)
+	if phase := h.myApp(newerKey).Status.Phase; phase == "Failed" {
+		t.Fatalf("MyApp is still Failed after the quota was released: %+v", h.myApp(newerKey).Status)
+	}
+
+	// 不允许的镜像
+	h.updateSpec(newerKey, func(spec *myappv1.MyAppSpec) { spec.Image = "nginx:1.25" })
+	h.reconcile(newerKey)
+	status = h.myApp(newerKey).Status
+	if status.Phase != "Failed" || !strings.Contains(status.Message, "spec.image") {
+		t.Fatalf("status = %+v, want Failed because of the image policy", status)
+	}
+	if image := h.deployment(newerKey).Spec.Template.Spec.Containers[0].Image; image != newer.Spec.Image {
+		t.Errorf("Deployment image = %s, want it unchanged", image)
+	}
+}
+
+func TestFakeReconcileMyAppPolicySharded(t *testing.T) {
+	now := time.Now()
+	older, newer := internalApp("api", 3, now.Add(-time.Hour)), internalApp("web", 2, now)
+	older.Labels = map[string]string{"shard": "1"}
+	newerKey := client.ObjectKeyFromObject(newer)
+	h := newFakeHarness(t, older, newer, newMyAppPolicy("default", "guardrails"))
+	h.reconciler.Features = policyFeatures(t)
+	h.reconciler.APIReader = h.client
+	// 模拟分片的缓存：其他分片的 MyApp 不在缓存中
+	h.reconciler.Client = interceptor.NewClient(h.client.(client.WithWatch), interceptor.Funcs{
+		List: func(ctx context.Context, c client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+			if err := c.List(ctx, list, opts...); err != nil {
+				return err
+			}
+			if apps, ok := list.(*myappv1.MyAppList); ok {
+				var own []myappv1.MyApp
+				for _, m := range apps.Items {
+					if m.Labels["shard"] == "" {
+						own = append(own, m)
+					}
+				}
+				apps.Items = own
+			}
+			return nil
+		},
+	})
+
+	h.reconcile(newerKey)
+	if status := h.myApp(newerKey).Status; status.Phase != "Failed" || !strings.Contains(status.Message, "namespace total to 5") {
+		t.Fatalf("status = %+v, want the MyApp of the other shard to count towards the quota", status)
+	}
+}
+
+func TestMyAppValidatorPolicy(t *testing.T) {
+	policy := newMyAppPolicy("default", "guardrails")
+	policy.Spec.RequiredLabels = []string{"team"}
+	existing := internalApp("api", 3, time.Now().Add(-time.Hour))
+	existing.Labels = map[string]string{"team": "shop"}
+	v := &MyAppValidator{
+		Client:   fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(policy, existing).Build(),
+		Features: policyFeatures(t),
+	}
+	ctx := context.Background()
+
+	valid := internalApp("web", 1, time.Time{})
+	valid.Labels = map[string]string{"team": "shop"}
+	if _, err := v.ValidateCreate(ctx, valid); err != nil {
+		t.Errorf("valid MyApp was rejected: %v", err)
+	}
+
+	// 已存在的 MyApp 扩容同样受命名空间配额限制
+	scaled := existing.DeepCopy()
+	scaled.Spec.Replicas = 5
+	_, err := v.ValidateUpdate(ctx, existing, scaled)
+	if !apierrors.IsInvalid(err) || !strings.Contains(err.Error(), "MyAppPolicy") {
+		t.Errorf("err = %v, want the policy to be enforced", err)
+	}
+
+	invalid := internalApp("web", 2, time.Time{})
+	invalid.Spec.InitContainers = []myappv1.Container{{Name: "init", Image: "busybox"}}
+	_, err = v.ValidateCreate(ctx, invalid)
+	for _, want := range []string{"metadata.labels[team]", "spec.initContainers[0].image", "namespace total to 5"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("err = %v, want it to mention %s", err, want)
+		}
+	}
+
+	// 只修改元数据时只检查要求的标签
+	unlabeled := existing.DeepCopy()
+	unlabeled.Labels = nil
+	if _, err := v.ValidateUpdate(ctx, existing, unlabeled); !apierrors.IsInvalid(err) {
+		t.Errorf("err = %v, want removing a required label to be rejected", err)
+	}
+	relabeled := existing.DeepCopy()
+	relabeled.Labels["tier"] = "backend"
+	if _, err := v.ValidateUpdate(ctx, existing, relabeled); err != nil {
+		t.Errorf("metadata-only update was rejected: %v", err)
+	}
+
+	// 镜像规则检查补全默认镜像仓库后的镜像
+	v.Defaults = &RuntimeDefaults{}
+	v.Defaults.SetImageRegistry("registry.example.com")
+	bare := valid.DeepCopy()
+	bare.Spec.Image = "web:v1"
+	if _, err := v.ValidateCreate(ctx, bare); err != nil {
+		t.Errorf("image from the default registry was rejected: %v", err)
+	}
+}
@@ -0,0 +1,249 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	myappv1 "github.com/example/myapp-controller/pkg/apis/example/v1"
+)
+
+const (
+	// MyAppSetLabel 标记由 MyAppSet 生成的 MyApp，值为 MyAppSet 的名称
+	MyAppSetLabel = "myapp.example.com/myappset"
+	// MyAppSetRevisionAnnotation 记录生成 MyApp 时使用的模板版本
+	MyAppSetRevisionAnnotation = "myapp.example.com/myappset-revision"
+)
+
+// placeholderPattern 匹配模板中的 {{key}}，key 两侧允许空白
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([^{}\s]+)\s*\}\}`)
+
+// generateParams 返回 MyAppSet 所有生成器产生的参数，按生成器的顺序排列
+func (r *MyAppSetReconciler) generateParams(ctx context.Context, set *myappv1.MyAppSet) ([]map[string]string, error) {
+	var params []map[string]string
+	for i, g := range set.Spec.Generators {
+		kinds := 0
+		for _, ok := range []bool{len(g.List) > 0, g.Namespaces != nil, len(g.Matrix) > 0} {
+			if ok {
+				kinds++
+			}
+		}
+		if kinds != 1 {
+			return nil, &permanentError{msg: fmt.Sprintf("generator %d must set exactly one of list, namespaces and matrix", i)}
+		}
+
+		if len(g.Matrix) == 0 {
+			generated, err := r.parameters(ctx, i, g.ParameterGenerator)
+			if err != nil {
+				return nil, err
+			}
+			params = append(params, generated...)
+			continue
+		}
+
+		// 逐个子生成器计算笛卡尔积
+		product := []map[string]string{{}}
+		for _, child := range g.Matrix {
+			generated, err := r.parameters(ctx, i, child)
+			if err != nil {
+				return nil, err
+			}
+			var next []map[string]string
+			for _, left := range product {
+				for _, right := range generated {
+					merged, err := mergeParams(left, right)
+					if err != nil {
+						return nil, &permanentError{msg: fmt.Sprintf("generator %d: %v", i, err)}
+					}
+					next = append(next, merged)
+				}
+			}
+			product = next
+		}
+		params = append(params, product...)
+	}
+	return params, nil
+}
+
+// parameters 返回 list 或 namespaces 生成器产生的参数
+func (r *MyAppSetReconciler) parameters(ctx context.Context, index int, g myappv1.ParameterGenerator) ([]map[string]string, error) {
+	if (len(g.List) > 0) == (g.Namespaces != nil) {
+		return nil, &permanentError{msg: fmt.Sprintf("generator %d: matrix entries must set exactly one of list and namespaces", index)}
+	}
+	if g.Namespaces == nil {
+		return g.List, nil
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(&g.Namespaces.Selector)
+	if err != nil {
+		return nil, &permanentError{msg: fmt.Sprintf("generator %d has an invalid namespace selector: %v", index, err)}
+	}
+	namespaces := &corev1.NamespaceList{}
+	if err := r.List(ctx, namespaces, client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return nil, err
+	}
+	sort.Slice(namespaces.Items, func(i, j int) bool { return namespaces.Items[i].Name < namespaces.Items[j].Name })
+
+	params := make([]map[string]string, 0, len(namespaces.Items))
+	for _, ns := range namespaces.Items {
+		// 正在删除的命名空间中不能再创建对象
+		if ns.DeletionTimestamp != nil {
+			continue
+		}
+		p := map[string]string{"namespace": ns.Name}
+		for k, v := range ns.Labels {
+			p["label."+k] = v
+		}
+		params = append(params, p)
+	}
+	return params, nil
+}
+
+// mergeParams 合并两组参数，同名参数的值不同时返回错误
+func mergeParams(left, right map[string]string) (map[string]string, error) {
+	merged := make(map[string]string, len(left)+len(right))
+	for k, v := range left {
+		merged[k] = v
+	}
+	for k, v := range right {
+		if existing, ok := merged[k]; ok && existing != v {
+			return nil, fmt.Errorf("matrix generators set parameter %q to both %q and %q", k, existing, v)
+		}
+		merged[k] = v
+	}
+	return merged, nil
+}
+
+// renderMyApp 用一组参数渲染模板，返回生成的 MyApp（不含 OwnerReference）。
+// 模板引用了不存在的参数或者渲染出的名称不合法时返回 permanentError
+func renderMyApp(set *myappv1.MyAppSet, params map[string]string) (*myappv1.MyApp, error) {
+	data, err := json.Marshal(set.Spec.Template)
+	if err != nil {
+		return nil, err
+	}
+	var tree any
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return nil, err
+	}
+	tree, err = substitute(tree, params)
+	if err != nil {
+		return nil, &permanentError{msg: err.Error()}
+	}
+	if data, err = json.Marshal(tree); err != nil {
+		return nil, err
+	}
+	tmpl := myappv1.MyAppTemplate{}
+	if err := json.Unmarshal(data, &tmpl); err != nil {
+		return nil, &permanentError{msg: fmt.Sprintf("rendered template is invalid: %v", err)}
+	}
+
+	meta := tmpl.Metadata
+	if errs := validation.IsDNS1123Subdomain(meta.Name); len(errs) > 0 {
+		return nil, &permanentError{msg: fmt.Sprintf("rendered MyApp name %q is invalid: %s", meta.Name, strings.Join(errs, "; "))}
+	}
+	if errs := validation.IsDNS1123Label(meta.Namespace); len(errs) > 0 {
+		return nil, &permanentError{msg: fmt.Sprintf("rendered MyApp namespace %q is invalid: %s", meta.Namespace, strings.Join(errs, "; "))}
+	}
+
+	app := &myappv1.MyApp{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        meta.Name,
+			Namespace:   meta.Namespace,
+			Labels:      map[string]string{},
+			Annotations: map[string]string{},
+		},
+		Spec: tmpl.Spec,
+	}
+	for k, v := range meta.Labels {
+		app.Labels[k] = v
+	}
+	for k, v := range meta.Annotations {
+		app.Annotations[k] = v
+	}
+	app.Labels[MyAppSetLabel] = set.Name
+	sum := sha256.Sum256(data)
+	app.Annotations[MyAppSetRevisionAnnotation] = hex.EncodeToString(sum[:])[:10]
+	return app, nil
+}
+
+// substitute 将 JSON 树中所有字符串值里的 {{key}} 替换为参数的值
+func substitute(node any, params map[string]string) (any, error) {
+	switch v := node.(type) {
+	case string:
+		var missing string
+		out := placeholderPattern.ReplaceAllStringFunc(v, func(match string) string {
+			key := placeholderPattern.FindStringSubmatch(match)[1]
+			value, ok := params[key]
+			if !ok && missing == "" {
+				missing = key
+			}
+			return value
+		})
+		if missing != "" {
+			return nil, fmt.Errorf("template references unknown parameter %q", missing)
+		}
+		return out, nil
+	case map[string]any:
+		for k, child := range v {
+			replaced, err := substitute(child, params)
+			if err != nil {
+				return nil, err
+			}
+			v[k] = replaced
+		}
+		return v, nil
+	case []any:
+		for i, child := range v {
+			replaced, err := substitute(child, params)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = replaced
+		}
+		return v, nil
+	default:
+		return v, nil
+	}
+}
+
+// desiredApps 展开 MyAppSet，返回按命名空间和名称排序的 MyApp。
+// 不同的参数渲染出同一个 MyApp 时返回 permanentError
+func (r *MyAppSetReconciler) desiredApps(ctx context.Context, set *myappv1.MyAppSet) ([]*myappv1.MyApp, error) {
+	// 生成的 MyApp 通过 MyAppSetLabel 标签找回
+	if errs := validation.IsValidLabelValue(set.Name); len(errs) > 0 {
+		return nil, &permanentError{msg: fmt.Sprintf("MyAppSet name %q cannot be used as a label value: %s", set.Name, strings.Join(errs, "; "))}
+	}
+	params, err := r.generateParams(ctx, set)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[types.NamespacedName]bool{}
+	apps := make([]*myappv1.MyApp, 0, len(params))
+	for _, p := range params {
+		app, err := renderMyApp(set, p)
+		if err != nil {
+			return nil, err
+		}
+		key := client.ObjectKeyFromObject(app)
+		if seen[key] {
+			return nil, &permanentError{msg: fmt.Sprintf("generators produce MyApp %s more than once, the template name must reference a parameter that differs between them", key)}
+		}
+		seen[key] = true
+		apps = append(apps, app)
+	}
+	sort.Slice(apps, func(i, j int) bool {
+		return client.ObjectKeyFromObject(apps[i]).String() < client.ObjectKeyFromObject(apps[j]).String()
+	})
+	return apps, nil
+}
@@ -0,0 +1,303 @@
+package controller
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	myappv1 "github.com/example/myapp-controller/pkg/apis/example/v1"
+	"github.com/example/myapp-controller/pkg/logging"
+)
+
+// maxListedApps 是 MyAppSet 状态消息中最多列出的 MyApp 数量
+const maxListedApps = 5
+
+// MyAppSetReconciler 将 MyAppSet 展开为 MyApp：创建新的参数对应的 MyApp，
+// 按 strategy 逐步更新模板变化的 MyApp，并删除不再生成的 MyApp
+type MyAppSetReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+// +kubebuilder:rbac:groups=example.com,resources=myappsets,verbs=get;list;watch
+// +kubebuilder:rbac:groups=example.com,resources=myappsets/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=core,resources=namespaces,verbs=list;watch
+
+// Reconcile 使 MyAppSet 生成的 MyApp 与生成器和模板一致，并汇总它们的状态
+func (r *MyAppSetReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx).WithValues("myappset", req.Name)
+	ctx = log.IntoContext(ctx, logger)
+
+	set := &myappv1.MyAppSet{}
+	if err := r.Get(ctx, req.NamespacedName, set); err != nil {
+		// MyAppSet 被删除后，生成的 MyApp 由垃圾回收器通过 OwnerReference 删除
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	desired, err := r.desiredApps(ctx, set)
+	if err != nil {
+		var permanent *permanentError
+		if stderrors.As(err, &permanent) {
+			// 生成器或模板有误时不修改已生成的 MyApp，等待用户修改 MyAppSet
+			logger.Error(err, "Invalid MyAppSet")
+			status := set.Status
+			status.Phase, status.Message = "Failed", err.Error()
+			return ctrl.Result{}, r.updateStatus(ctx, set, status)
+		}
+		return ctrl.Result{}, err
+	}
+
+	owned := &myappv1.MyAppList{}
+	if err := r.List(ctx, owned, client.MatchingLabels{MyAppSetLabel: set.Name}); err != nil {
+		logger.Error(err, "Failed to list MyApps", logging.KeyAction, actionGet, logging.KeyResource, "MyApp")
+		return ctrl.Result{}, err
+	}
+	existing := map[types.NamespacedName]*myappv1.MyApp{}
+	for i := range owned.Items {
+		if metav1.IsControlledBy(&owned.Items[i], set) {
+			existing[client.ObjectKeyFromObject(&owned.Items[i])] = &owned.Items[i]
+		}
+	}
+
+	maxUnavailable := set.Spec.Strategy.MaxUnavailable
+	if maxUnavailable <= 0 {
+		maxUnavailable = 1
+	}
+	var unavailable int32
+	for _, want := range desired {
+		if have, ok := existing[client.ObjectKeyFromObject(want)]; ok && !myAppAvailable(have) {
+			unavailable++
+		}
+	}
+
+	var conflicts []string
+	var updated int32
+	for _, want := range desired {
+		key := client.ObjectKeyFromObject(want)
+		revision := want.Annotations[MyAppSetRevisionAnnotation]
+		have, ok := existing[key]
+		if !ok {
+			created, err := r.createApp(ctx, set, want)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+			if !created {
+				conflicts = append(conflicts, key.String())
+				continue
+			}
+			updated++
+			continue
+		}
+		if have.Annotations[MyAppSetRevisionAnnotation] == revision {
+			updated++
+			continue
+		}
+		// 已经不可用的 MyApp 直接更新，其余的 MyApp 在不可用数量达到上限时等待下一次协调
+		if myAppAvailable(have) {
+			if unavailable >= maxUnavailable {
+				continue
+			}
+			unavailable++
+		}
+		if err := r.updateApp(ctx, have, want); err != nil {
+			return ctrl.Result{}, err
+		}
+		updated++
+	}
+
+	// 删除不再生成的 MyApp
+	wanted := map[types.NamespacedName]bool{}
+	for _, want := range desired {
+		wanted[client.ObjectKeyFromObject(want)] = true
+	}
+	for key, have := range existing {
+		if wanted[key] {
+			continue
+		}
+		if err := r.Delete(ctx, have); err != nil && !errors.IsNotFound(err) {
+			logger.Error(err, "Failed to delete MyApp", logging.KeyAction, actionDelete, logging.KeyResource, "MyApp", "myapp", key.String())
+			return ctrl.Result{}, err
+		}
+		logger.Info("Deleted MyApp", logging.KeyAction, actionDelete, logging.KeyResource, "MyApp", "myapp", key.String())
+	}
+
+	return ctrl.Result{}, r.updateStatus(ctx, set, aggregateStatus(desired, existing, updated, conflicts))
+}
+
+// myAppAvailable 判断 MyApp 是否处于 Running 且状态对应当前的规格
+func myAppAvailable(m *myappv1.MyApp) bool {
+	return m.Status.Phase == "Running" && m.Status.ObservedGeneration >= m.Generation
+}
+
+// createApp 创建生成的 MyApp，同名的 MyApp 已存在且不属于该 MyAppSet 时返回 false，不接管它
+func (r *MyAppSetReconciler) createApp(ctx context.Context, set *myappv1.MyAppSet, app *myappv1.MyApp) (bool, error) {
+	logger := log.FromContext(ctx).WithValues("myapp", client.ObjectKeyFromObject(app).String())
+	if err := ctrl.SetControllerReference(set, app, r.Scheme); err != nil {
+		return false, err
+	}
+	if err := r.Create(ctx, app); err != nil {
+		if errors.IsAlreadyExists(err) {
+			logger.Info("MyApp already exists and is not owned by the MyAppSet", logging.KeyAction, actionCreate, logging.KeyResource, "MyApp")
+			return false, nil
+		}
+		logger.Error(err, "Failed to create MyApp", logging.KeyAction, actionCreate, logging.KeyResource, "MyApp")
+		return false, err
+	}
+	logger.Info("Created MyApp", logging.KeyAction, actionCreate, logging.KeyResource, "MyApp")
+	return true, nil
+}
+
+// updateApp 将模板渲染出的规格、标签和注解写入已生成的 MyApp，用户添加的其他标签和注解保持不变
+func (r *MyAppSetReconciler) updateApp(ctx context.Context, have, want *myappv1.MyApp) error {
+	logger := log.FromContext(ctx).WithValues("myapp", client.ObjectKeyFromObject(have).String())
+	syncLabels(&have.ObjectMeta, want.Labels)
+	if have.Annotations == nil {
+		have.Annotations = map[string]string{}
+	}
+	for k, v := range want.Annotations {
+		have.Annotations[k] = v
+	}
+	have.Spec = want.Spec
+	if err := r.Update(ctx, have); err != nil {
+		logger.Error(err, "Failed to update MyApp", logging.KeyAction, actionUpdate, logging.KeyResource, "MyApp")
+		return err
+	}
+	logger.Info("Updated MyApp", logging.KeyAction, actionUpdate, logging.KeyResource, "MyApp", "revision", want.Annotations[MyAppSetRevisionAnnotation])
+	return nil
+}
+
+// aggregateStatus 汇总生成的 MyApp 的状态：所有 MyApp 都已更新并处于 Running 时为 Running，
+// 有 MyApp 处于 Failed 或与已有的 MyApp 冲突时为 Failed，其余情况为 Pending
+func aggregateStatus(desired []*myappv1.MyApp, existing map[types.NamespacedName]*myappv1.MyApp, updated int32, conflicts []string) myappv1.MyAppSetStatus {
+	status := myappv1.MyAppSetStatus{Apps: int32(len(desired)), UpdatedApps: updated}
+	var failed []string
+	for _, want := range desired {
+		have, ok := existing[client.ObjectKeyFromObject(want)]
+		if !ok {
+			continue
+		}
+		switch {
+		case have.Status.Phase == "Failed":
+			status.FailedApps++
+			failed = append(failed, client.ObjectKeyFromObject(have).String())
+		case myAppAvailable(have):
+			status.ReadyApps++
+		}
+	}
+
+	switch {
+	case len(conflicts) > 0:
+		status.Phase = "Failed"
+		status.Message = fmt.Sprintf("MyApps already exist and are not owned by this MyAppSet: %s", listApps(conflicts))
+	case len(failed) > 0:
+		status.Phase = "Failed"
+		status.Message = fmt.Sprintf("MyApp 处于 Failed: %s", listApps(failed))
+	case status.ReadyApps == status.Apps && status.UpdatedApps == status.Apps:
+		status.Phase = "Running"
+		status.Message = "所有 MyApp 都已更新并处于 Running"
+	default:
+		status.Phase = "Pending"
+		status.Message = fmt.Sprintf("已更新 %d/%d，就绪 %d/%d", status.UpdatedApps, status.Apps, status.ReadyApps, status.Apps)
+	}
+	return status
+}
+
+// listApps 返回逗号分隔的前 maxListedApps 个名称，超出的部分只显示数量
+func listApps(names []string) string {
+	if len(names) <= maxListedApps {
+		return strings.Join(names, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(names[:maxListedApps], ", "), len(names)-maxListedApps)
+}
+
+// updateStatus 与 MyAppReconciler.updateStatus 相同，通过带乐观锁的 merge patch 写入 status，
+// 冲突时重新获取最新对象并重试，状态未变化时不发起请求
+func (r *MyAppSetReconciler) updateStatus(ctx context.Context, set *myappv1.MyAppSet, status myappv1.MyAppSetStatus) error {
+	status.ObservedGeneration = set.Generation
+	latest := set
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if latest == nil {
+			latest = &myappv1.MyAppSet{}
+			if err := r.Get(ctx, client.ObjectKeyFromObject(set), latest); err != nil {
+				return err
+			}
+		}
+		if equality.Semantic.DeepEqual(latest.Status, status) {
+			return nil
+		}
+
+		patch := client.MergeFromWithOptions(latest.DeepCopy(), client.MergeFromWithOptimisticLock{})
+		latest.Status = status
+		err := r.Status().Patch(ctx, latest, patch)
+		// 下次重试时重新读取最新对象
+		latest = nil
+		return err
+	})
+	if err != nil {
+		log.FromContext(ctx).Error(err, "Failed to update MyAppSet status", logging.KeyAction, actionPatchStatus, logging.KeyResource, "MyAppSet")
+	}
+	return err
+}
+
+// setsForNamespace 在命名空间创建、删除或标签变化时返回使用 namespaces 生成器的 MyAppSet
+func (r *MyAppSetReconciler) setsForNamespace(ctx context.Context, _ client.Object) []reconcile.Request {
+	sets := &myappv1.MyAppSetList{}
+	if err := r.List(ctx, sets); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list MyAppSets", logging.KeyAction, actionGet, logging.KeyResource, "MyAppSet")
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, set := range sets.Items {
+		if usesNamespaces(&set) {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: set.Name}})
+		}
+	}
+	return requests
+}
+
+// usesNamespaces 判断 MyAppSet 是否有 namespaces 生成器，包括 matrix 中的
+func usesNamespaces(set *myappv1.MyAppSet) bool {
+	for _, g := range set.Spec.Generators {
+		if g.Namespaces != nil {
+			return true
+		}
+		for _, child := range g.Matrix {
+			if child.Namespaces != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// generatedMyAppPredicate 过滤生成的 MyApp 的事件。滚动更新等待 MyApp 协调最新的规格（myAppAvailable），
+// 因此 status.observedGeneration 的变化也必须触发 MyAppSet 的协调
+func generatedMyAppPredicate() predicate.Predicate {
+	return countingPredicate("GeneratedMyApp", phaseOrSpecChangedPredicate())
+}
+
+// SetupWithManager 设置 MyAppSet 控制器
+func (r *MyAppSetReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&myappv1.MyAppSet{}, builder.WithPredicates(countingPredicate("MyAppSet", predicate.GenerationChangedPredicate{}))).
+		Owns(&myappv1.MyApp{}, builder.WithPredicates(generatedMyAppPredicate())).
+		Watches(&corev1.Namespace{}, handler.EnqueueRequestsFromMapFunc(r.setsForNamespace),
+			builder.WithPredicates(countingPredicate("Namespace", predicate.LabelChangedPredicate{}))).
+		Complete(r)
+}
@@ -0,0 +1,423 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	toolscache "k8s.io/client-go/tools/cache"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache/informertest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllertest"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	myappv1 "github.com/example/myapp-controller/pkg/apis/example/v1"
+)
+
+// newMyAppSet 返回为 list 中的每个租户在 default 命名空间生成一个 MyApp 的 MyAppSet
+func newMyAppSet(name string, tenants ...string) *myappv1.MyAppSet {
+	var list []map[string]string
+	for _, t := range tenants {
+		list = append(list, map[string]string{"tenant": t})
+	}
+	return &myappv1.MyAppSet{
+		ObjectMeta: metav1.ObjectMeta{Name: name, UID: types.UID(name + "-uid"), Generation: 1},
+		Spec: myappv1.MyAppSetSpec{
+			Generators: []myappv1.MyAppSetGenerator{{ParameterGenerator: myappv1.ParameterGenerator{List: list}}},
+			Template: myappv1.MyAppTemplate{
+				Metadata: myappv1.MyAppTemplateMeta{Name: "shop-{{tenant}}", Namespace: "default"},
+				Spec: myappv1.MyAppSpec{
+					Image:        "nginx:1.25",
+					Replicas:     1,
+					Port:         8080,
+					NodeSelector: map[string]string{"tenant": "{{ tenant }}"},
+				},
+			},
+		},
+	}
+}
+
+func TestRenderMyApp(t *testing.T) {
+	set := newMyAppSet("shop")
+	set.Spec.Template.Metadata.Labels = map[string]string{"tenant": "{{tenant}}"}
+
+	app, err := renderMyApp(set, map[string]string{"tenant": "acme"})
+	if err != nil {
+		t.Fatalf("renderMyApp failed: %v", err)
+	}
+	if app.Name != "shop-acme" || app.Namespace != "default" {
+		t.Errorf("rendered MyApp is %s/%s, want default/shop-acme", app.Namespace, app.Name)
+	}
+	if app.Spec.NodeSelector["tenant"] != "acme" || app.Labels["tenant"] != "acme" || app.Labels[MyAppSetLabel] != "shop" {
+		t.Errorf("placeholders were not substituted: nodeSelector=%v labels=%v", app.Spec.NodeSelector, app.Labels)
+	}
+
+	// 模板不变时版本不变，参数不同的 MyApp 有不同的版本
+	again, _ := renderMyApp(set, map[string]string{"tenant": "acme"})
+	other, _ := renderMyApp(set, map[string]string{"tenant": "globex"})
+	revision := app.Annotations[MyAppSetRevisionAnnotation]
+	if revision == "" || again.Annotations[MyAppSetRevisionAnnotation] != revision || other.Annotations[MyAppSetRevisionAnnotation] == revision {
+		t.Errorf("unexpected revisions %q, %q, %q", revision, again.Annotations[MyAppSetRevisionAnnotation], other.Annotations[MyAppSetRevisionAnnotation])
+	}
+
+	tests := []struct {
+		name    string
+		params  map[string]string
+		wantErr string
+	}{
+		{name: "unknown parameter", params: map[string]string{"team": "acme"}, wantErr: `unknown parameter "tenant"`},
+		{name: "invalid name", params: map[string]string{"tenant": "Acme_Corp"}, wantErr: "rendered MyApp name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := renderMyApp(set, tt.params)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want it to contain %q", err, tt.wantErr)
+			}
+			if _, ok := err.(*permanentError); !ok {
+				t.Errorf("err = %T, want *permanentError", err)
+			}
+		})
+	}
+}
+
+func TestMyAppSetGenerateParams(t *testing.T) {
+	ns := func(name, env string) *corev1.Namespace {
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{"env": env}}}
+	}
+	c := fake.NewClientBuilder().WithScheme(newTestScheme()).
+		WithObjects(ns("team-b", "prod"), ns("team-a", "prod"), ns("team-c", "dev")).
+		Build()
+	r := &MyAppSetReconciler{Client: c, Scheme: c.Scheme()}
+
+	namespaces := myappv1.ParameterGenerator{Namespaces: &myappv1.NamespaceGenerator{
+		Selector: metav1.LabelSelector{MatchLabels: map[string]string{"env": "prod"}},
+	}}
+	set := newMyAppSet("shop")
+	set.Spec.Generators = []myappv1.MyAppSetGenerator{{Matrix: []myappv1.ParameterGenerator{
+		namespaces,
+		{List: []map[string]string{{"tier": "web"}, {"tier": "worker"}}},
+	}}}
+	params, err := r.generateParams(context.Background(), set)
+	if err != nil {
+		t.Fatalf("generateParams failed: %v", err)
+	}
+	var got []string
+	for _, p := range params {
+		got = append(got, p["namespace"]+"/"+p["tier"]+"/"+p["label.env"])
+	}
+	want := "team-a/web/prod,team-a/worker/prod,team-b/web/prod,team-b/worker/prod"
+	if strings.Join(got, ",") != want {
+		t.Errorf("params = %v, want %s", got, want)
+	}
+
+	set.Spec.Generators = []myappv1.MyAppSetGenerator{{Matrix: []myappv1.ParameterGenerator{
+		namespaces,
+		{List: []map[string]string{{"namespace": "other"}}},
+	}}}
+	if _, err := r.generateParams(context.Background(), set); err == nil || !strings.Contains(err.Error(), `parameter "namespace"`) {
+		t.Errorf("err = %v, want a conflict on parameter namespace", err)
+	}
+
+	set.Spec.Generators = []myappv1.MyAppSetGenerator{{ParameterGenerator: namespaces, Matrix: []myappv1.ParameterGenerator{namespaces}}}
+	if _, err := r.generateParams(context.Background(), set); err == nil || !strings.Contains(err.Error(), "exactly one") {
+		t.Errorf("err = %v, want a generator with two kinds to be rejected", err)
+	}
+}
+
+// myAppSetHarness 使用 fake client 驱动 MyAppSetReconciler
+type myAppSetHarness struct {
+	t          *testing.T
+	client     client.Client
+	reconciler *MyAppSetReconciler
+}
+
+func newMyAppSetHarness(t *testing.T, objs ...client.Object) *myAppSetHarness {
+	t.Helper()
+	s := newTestScheme()
+	c := fake.NewClientBuilder().
+		WithScheme(s).
+		WithObjects(objs...).
+		WithStatusSubresource(&myappv1.MyApp{}, &myappv1.MyAppSet{}).
+		Build()
+	return &myAppSetHarness{t: t, client: c, reconciler: &MyAppSetReconciler{Client: c, Scheme: s}}
+}
+
+// reconcile 协调 MyAppSet 并返回最新的 MyAppSet
+func (h *myAppSetHarness) reconcile(name string) *myappv1.MyAppSet {
+	h.t.Helper()
+	key := types.NamespacedName{Name: name}
+	if _, err := h.reconciler.Reconcile(context.Background(), ctrl.Request{NamespacedName: key}); err != nil {
+		h.t.Fatalf("reconcile %s failed: %v", name, err)
+	}
+	set := &myappv1.MyAppSet{}
+	if err := h.client.Get(context.Background(), key, set); err != nil {
+		h.t.Fatalf("failed to get MyAppSet %s: %v", name, err)
+	}
+	return set
+}
+
+// apps 返回 default 命名空间中按名称排序的 MyApp
+func (h *myAppSetHarness) apps() []myappv1.MyApp {
+	h.t.Helper()
+	list := &myappv1.MyAppList{}
+	if err := h.client.List(context.Background(), list, client.InNamespace("default")); err != nil {
+		h.t.Fatalf("failed to list MyApps: %v", err)
+	}
+	return list.Items
+}
+
+// setRunning 模拟 MyApp 控制器将所有 MyApp 的当前规格部署完成
+func (h *myAppSetHarness) setRunning() {
+	h.t.Helper()
+	for _, app := range h.apps() {
+		app.Status.Phase = "Running"
+		app.Status.ObservedGeneration = app.Generation
+		if err := h.client.Status().Update(context.Background(), &app); err != nil {
+			h.t.Fatalf("failed to update MyApp status: %v", err)
+		}
+	}
+}
+
+// startRollout 模拟 MyApp 控制器开始发布新的规格：模板版本与 before 不同的 MyApp 变为 Pending，
+// fake client 不会在规格变化时增加 generation。返回这些 MyApp 的数量
+func (h *myAppSetHarness) startRollout(before map[string]string) int {
+	h.t.Helper()
+	changed := 0
+	for _, app := range h.apps() {
+		if app.Annotations[MyAppSetRevisionAnnotation] == before[app.Name] {
+			continue
+		}
+		changed++
+		app.Status.Phase = "Pending"
+		if err := h.client.Status().Update(context.Background(), &app); err != nil {
+			h.t.Fatalf("failed to update MyApp status: %v", err)
+		}
+	}
+	return changed
+}
+
+// revisions 返回每个 MyApp 的模板版本
+func (h *myAppSetHarness) revisions() map[string]string {
+	revisions := map[string]string{}
+	for _, app := range h.apps() {
+		revisions[app.Name] = app.Annotations[MyAppSetRevisionAnnotation]
+	}
+	return revisions
+}
+
+func TestFakeReconcileMyAppSet(t *testing.T) {
+	set := newMyAppSet("shop", "acme", "globex", "initech")
+	h := newMyAppSetHarness(t, set)
+
+	got := h.reconcile("shop")
+	apps := h.apps()
+	if len(apps) != 3 {
+		t.Fatalf("got %d MyApps, want 3", len(apps))
+	}
+	for _, app := range apps {
+		if !metav1.IsControlledBy(&app, got) || app.Labels[MyAppSetLabel] != "shop" {
+			t.Errorf("MyApp %s is not owned and labeled by the MyAppSet", app.Name)
+		}
+	}
+	if got.Status.Phase != "Pending" || got.Status.Apps != 3 || got.Status.UpdatedApps != 3 || got.Status.ReadyApps != 0 {
+		t.Errorf("status = %+v, want 3 updated Pending apps", got.Status)
+	}
+
+	h.setRunning()
+	if got = h.reconcile("shop"); got.Status.Phase != "Running" || got.Status.ReadyApps != 3 {
+		t.Fatalf("status = %+v, want Running", got.Status)
+	}
+
+	// 模板变化后每次只更新 maxUnavailable 个处于 Running 的 MyApp
+	before := h.revisions()
+	got.Spec.Template.Spec.Image = "nginx:1.26"
+	got.Generation++
+	if err := h.client.Update(context.Background(), got); err != nil {
+		t.Fatalf("failed to update MyAppSet: %v", err)
+	}
+	got = h.reconcile("shop")
+	if changed := h.startRollout(before); changed != 1 || got.Status.UpdatedApps != 1 || got.Status.Phase != "Pending" {
+		t.Fatalf("%d MyApps changed with status %+v, want exactly 1 updated with maxUnavailable 1", changed, got.Status)
+	}
+	if got = h.reconcile("shop"); got.Status.UpdatedApps != 1 {
+		t.Fatalf("updated %d MyApps while one is unavailable, want 1", got.Status.UpdatedApps)
+	}
+	for i := 0; i < 2; i++ {
+		h.setRunning()
+		before = h.revisions()
+		h.reconcile("shop")
+		if changed := h.startRollout(before); changed != 1 {
+			t.Fatalf("round %d updated %d MyApps, want 1", i, changed)
+		}
+	}
+	h.setRunning()
+	if got = h.reconcile("shop"); got.Status.Phase != "Running" || got.Status.UpdatedApps != 3 {
+		t.Fatalf("status = %+v, want all MyApps updated and Running", got.Status)
+	}
+	for _, app := range h.apps() {
+		if app.Spec.Image != "nginx:1.26" {
+			t.Errorf("MyApp %s image = %s, want nginx:1.26", app.Name, app.Spec.Image)
+		}
+	}
+
+	// 从列表中移除的租户对应的 MyApp 被删除
+	got.Spec.Generators[0].List = got.Spec.Generators[0].List[:2]
+	if err := h.client.Update(context.Background(), got); err != nil {
+		t.Fatalf("failed to update MyAppSet: %v", err)
+	}
+	if got = h.reconcile("shop"); got.Status.Apps != 2 || len(h.apps()) != 2 {
+		t.Fatalf("status = %+v with %d MyApps, want the removed tenant to be pruned", got.Status, len(h.apps()))
+	}
+}
+
+func TestFakeReconcileMyAppSetConflict(t *testing.T) {
+	existing := newMyApp("default", "shop-acme", 1)
+	h := newMyAppSetHarness(t, newMyAppSet("shop", "acme", "globex"), existing)
+
+	got := h.reconcile("shop")
+	if got.Status.Phase != "Failed" || !strings.Contains(got.Status.Message, "default/shop-acme") {
+		t.Fatalf("status = %+v, want Failed because of the existing MyApp", got.Status)
+	}
+	for _, app := range h.apps() {
+		if app.Name == "shop-acme" && (app.Spec.NodeSelector != nil || len(app.OwnerReferences) > 0) {
+			t.Errorf("existing MyApp was taken over: %+v", app)
+		}
+	}
+	if len(h.apps()) != 2 {
+		t.Errorf("got %d MyApps, want the other tenant to be created", len(h.apps()))
+	}
+
+	// 模板引用了不存在的参数时不修改已生成的 MyApp
+	got.Spec.Template.Metadata.Name = "shop-{{team}}"
+	if err := h.client.Update(context.Background(), got); err != nil {
+		t.Fatalf("failed to update MyAppSet: %v", err)
+	}
+	if got = h.reconcile("shop"); got.Status.Phase != "Failed" || !strings.Contains(got.Status.Message, `"team"`) {
+		t.Fatalf("status = %+v, want Failed because of the unknown parameter", got.Status)
+	}
+	if len(h.apps()) != 2 {
+		t.Errorf("got %d MyApps, want the generated MyApps to be kept", len(h.apps()))
+	}
+}
+
+func TestMyAppSetRolloutContinuesOnObservedGeneration(t *testing.T) {
+	set := newMyAppSet("shop", "acme", "globex")
+	h := newMyAppSetHarness(t, set)
+	got := h.reconcile("shop")
+	h.setRunning()
+
+	// 通过与 SetupWithManager 相同的 handler 和 predicate 把生成的 MyApp 的事件交给控制器
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := h.reconciler.Scheme
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(myappv1.SchemeGroupVersion.WithKind("MyAppSet"), meta.RESTScopeRoot)
+	informer := &controllertest.FakeInformer{Synced: true}
+	informers := &informertest.FakeInformers{Scheme: s, InformersByGVK: map[schema.GroupVersionKind]toolscache.SharedIndexInformer{
+		myappv1.SchemeGroupVersion.WithKind("MyApp"): informer,
+	}}
+	reconciled := make(chan struct{}, 10)
+	c, err := controller.NewUnmanaged("myappset-watch-test", controller.Options{
+		SkipNameValidation: ptr.To(true),
+		Reconciler: reconcile.Func(func(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+			res, err := h.reconciler.Reconcile(ctx, req)
+			reconciled <- struct{}{}
+			return res, err
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Watch(source.Kind[client.Object](informers, &myappv1.MyApp{},
+		handler.EnqueueRequestForOwner(s, mapper, &myappv1.MyAppSet{}, handler.OnlyControllerOwner()),
+		generatedMyAppPredicate())); err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = c.Start(ctx) }()
+
+	// 模板变化后先更新一个 MyApp；apiserver 增加它的 generation，另一个 MyApp 等待
+	before := h.revisions()
+	got.Spec.Template.Spec.Image = "nginx:1.26"
+	got.Generation++
+	if err := h.client.Update(context.Background(), got); err != nil {
+		t.Fatalf("failed to update MyAppSet: %v", err)
+	}
+	h.reconcile("shop")
+	var rolling myappv1.MyApp
+	for _, app := range h.apps() {
+		if app.Annotations[MyAppSetRevisionAnnotation] != before[app.Name] {
+			rolling = app
+		}
+	}
+	rolling.Generation++
+	if err := h.client.Update(context.Background(), &rolling); err != nil {
+		t.Fatal(err)
+	}
+	if got = h.reconcile("shop"); got.Status.UpdatedApps != 1 {
+		t.Fatalf("updated %d MyApps while one has not observed its spec, want 1", got.Status.UpdatedApps)
+	}
+
+	// MyApp 控制器协调新的规格后阶段保持 Running，只有 observedGeneration 变化
+	old := rolling.DeepCopy()
+	rolling.Status.ObservedGeneration = rolling.Generation
+	if err := h.client.Status().Update(context.Background(), &rolling); err != nil {
+		t.Fatal(err)
+	}
+	// 控制器异步注册事件处理函数，重复发送事件直到它被处理
+	deadline := time.After(5 * time.Second)
+	for done := false; !done; {
+		informer.Update(old, &rolling)
+		select {
+		case <-reconciled:
+			done = true
+		case <-time.After(100 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("MyAppSet was not reconciled after the MyApp observed its new spec")
+		}
+	}
+	for _, app := range h.apps() {
+		if app.Spec.Image != "nginx:1.26" {
+			t.Errorf("MyApp %s image = %s, want the rollout to continue", app.Name, app.Spec.Image)
+		}
+	}
+}
+
+func TestMyAppSetStatusRetriesConflict(t *testing.T) {
+	s := newTestScheme()
+	conflicts := 0
+	c := fake.NewClientBuilder().
+		WithScheme(s).
+		WithObjects(newMyAppSet("shop", "acme")).
+		WithStatusSubresource(&myappv1.MyApp{}, &myappv1.MyAppSet{}).
+		WithInterceptorFuncs(interceptor.Funcs{
+			SubResourcePatch: func(ctx context.Context, c client.Client, subResourceName string, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+				if conflicts < 2 {
+					conflicts++
+					return apierrors.NewConflict(myappv1.Resource("myappsets").GroupResource(), obj.GetName(), fmt.Errorf("simulated conflict"))
+				}
+				return c.SubResource(subResourceName).Patch(ctx, obj, patch, opts...)
+			},
+		}).
+		Build()
+	h := &myAppSetHarness{t: t, client: c, reconciler: &MyAppSetReconciler{Client: c, Scheme: s}}
+
+	if got := h.reconcile("shop"); conflicts != 2 || got.Status.Apps != 1 {
+		t.Fatalf("conflicts = %d, status = %+v, want the status written after 2 conflicts", conflicts, got.Status)
+	}
+}
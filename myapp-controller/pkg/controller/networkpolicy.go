@@ -0,0 +1,122 @@
+package controller
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+
+	myappv1 "github.com/example/myapp-controller/pkg/apis/example/v1"
+)
+
+// namespaceNameLabel 是 apiserver 自动加在每个命名空间上的名称标签
+const namespaceNameLabel = "kubernetes.io/metadata.name"
+
+// reconcileNetworkPolicy 创建或同步 MyApp 的 NetworkPolicy，未设置 spec.networkPolicy 时删除之前创建的 NetworkPolicy
+func (r *MyAppReconciler) reconcileNetworkPolicy(ctx context.Context, m *myappv1.MyApp) error {
+	if m.Spec.NetworkPolicy == nil {
+		return r.deleteOwned(ctx, m, &networkingv1.NetworkPolicy{})
+	}
+
+	desired := r.networkPolicyForMyApp(m)
+	found := &networkingv1.NetworkPolicy{}
+	return r.ensureOwned(ctx, m, "NetworkPolicy", desired, found, func() bool {
+		changed := syncLabels(&found.ObjectMeta, desired.Labels)
+		if !equality.Semantic.DeepEqual(found.Spec, desired.Spec) {
+			found.Spec = desired.Spec
+			changed = true
+		}
+		return changed
+	})
+}
+
+// networkPolicyForMyApp 将 spec.networkPolicy 转换为通过 app 标签选中 MyApp 的 Pod 的 NetworkPolicy。
+// 入站只放行 Service 暴露的容器端口；声明了出站规则时额外放行 DNS，否则 Pod 无法解析其他服务的名称
+func (r *MyAppReconciler) networkPolicyForMyApp(m *myappv1.MyApp) *networkingv1.NetworkPolicy {
+	labels := map[string]string{
+		"app": m.Name,
+	}
+	spec := m.Spec.NetworkPolicy
+
+	ports := []networkingv1.NetworkPolicyPort{{
+		Protocol: ptr.To(corev1.ProtocolTCP),
+		Port:     ptr.To(intstr.FromInt32(m.Spec.Port)),
+	}}
+	_, exposed := podSpecForMyApp(m, r.Defaults.ResolveImage)
+	for _, p := range exposed {
+		ports = append(ports, networkingv1.NetworkPolicyPort{
+			Protocol: ptr.To(p.Protocol),
+			Port:     ptr.To(intstr.FromInt32(p.Port)),
+		})
+	}
+
+	policy := networkingv1.NetworkPolicySpec{
+		PodSelector: metav1.LabelSelector{MatchLabels: labels},
+		PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+	}
+	for _, peer := range spec.Ingress {
+		policy.Ingress = append(policy.Ingress, networkingv1.NetworkPolicyIngressRule{
+			Ports: ports,
+			From:  networkPolicyPeers(peer),
+		})
+	}
+
+	if len(spec.Egress) > 0 {
+		policy.PolicyTypes = append(policy.PolicyTypes, networkingv1.PolicyTypeEgress)
+		policy.Egress = append(policy.Egress, networkingv1.NetworkPolicyEgressRule{
+			Ports: []networkingv1.NetworkPolicyPort{
+				{Protocol: ptr.To(corev1.ProtocolUDP), Port: ptr.To(intstr.FromInt32(53))},
+				{Protocol: ptr.To(corev1.ProtocolTCP), Port: ptr.To(intstr.FromInt32(53))},
+			},
+		})
+		for _, rule := range spec.Egress {
+			egress := networkingv1.NetworkPolicyEgressRule{To: networkPolicyPeers(rule.NetworkPeer)}
+			for _, p := range rule.Ports {
+				// 显式填写 apiserver 补上的默认协议，避免每次协调都认为规则发生了变化
+				p = *p.DeepCopy()
+				if p.Protocol == nil {
+					p.Protocol = ptr.To(corev1.ProtocolTCP)
+				}
+				egress.Ports = append(egress.Ports, p)
+			}
+			policy.Egress = append(policy.Egress, egress)
+		}
+	}
+
+	return &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      m.Name,
+			Namespace: m.Namespace,
+			Labels:    withManagedByLabel(labels),
+		},
+		Spec: policy,
+	}
+}
+
+// networkPolicyPeers 将 MyApp 的对端转换为 NetworkPolicy 的对端：
+// Apps 和 Namespaces 合并为一个同时匹配 Pod 和命名空间的对端，每个 CIDR 单独作为一个对端
+func networkPolicyPeers(peer myappv1.NetworkPeer) []networkingv1.NetworkPolicyPeer {
+	var peers []networkingv1.NetworkPolicyPeer
+	if len(peer.Apps) > 0 || len(peer.Namespaces) > 0 {
+		var selected networkingv1.NetworkPolicyPeer
+		if len(peer.Apps) > 0 {
+			selected.PodSelector = &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{
+				Key: "app", Operator: metav1.LabelSelectorOpIn, Values: peer.Apps,
+			}}}
+		}
+		if len(peer.Namespaces) > 0 {
+			selected.NamespaceSelector = &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{
+				Key: namespaceNameLabel, Operator: metav1.LabelSelectorOpIn, Values: peer.Namespaces,
+			}}}
+		}
+		peers = append(peers, selected)
+	}
+	for _, cidr := range peer.CIDRs {
+		peers = append(peers, networkingv1.NetworkPolicyPeer{IPBlock: &networkingv1.IPBlock{CIDR: cidr}})
+	}
+	return peers
+}
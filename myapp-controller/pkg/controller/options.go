@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/time/rate"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// Options 控制 MyApp 控制器的并发数和工作队列限速，零值字段使用默认值
+type Options struct {
+	// MaxConcurrentReconciles 同时运行的 Reconcile 数量
+	MaxConcurrentReconciles int
+	// BaseDelay 单个对象失败重试的初始退避时间
+	BaseDelay time.Duration
+	// MaxDelay 单个对象失败重试的最大退避时间
+	MaxDelay time.Duration
+	// QPS 全局令牌桶每秒放行的重试次数
+	QPS float64
+	// Burst 全局令牌桶的容量
+	Burst int
+}
+
+// DefaultOptions 返回与 controller-runtime 默认行为一致的选项
+func DefaultOptions() Options {
+	return Options{
+		MaxConcurrentReconciles: 1,
+		BaseDelay:               5 * time.Millisecond,
+		MaxDelay:                1000 * time.Second,
+		QPS:                     10,
+		Burst:                   100,
+	}
+}
+
+// withDefaults 用默认值填充未设置的字段
+func (o Options) withDefaults() Options {
+	d := DefaultOptions()
+	if o.MaxConcurrentReconciles == 0 {
+		o.MaxConcurrentReconciles = d.MaxConcurrentReconciles
+	}
+	if o.BaseDelay == 0 {
+		o.BaseDelay = d.BaseDelay
+	}
+	if o.MaxDelay == 0 {
+		o.MaxDelay = d.MaxDelay
+	}
+	if o.QPS == 0 {
+		o.QPS = d.QPS
+	}
+	if o.Burst == 0 {
+		o.Burst = d.Burst
+	}
+	return o
+}
+
+// Validate 检查选项是否合法
+func (o Options) Validate() error {
+	o = o.withDefaults()
+	if o.MaxConcurrentReconciles < 0 {
+		return fmt.Errorf("max concurrent reconciles must be positive, got %d", o.MaxConcurrentReconciles)
+	}
+	if o.BaseDelay < 0 || o.MaxDelay < 0 {
+		return fmt.Errorf("rate limiter delays must be positive")
+	}
+	if o.BaseDelay > o.MaxDelay {
+		return fmt.Errorf("rate limiter base delay %s exceeds max delay %s", o.BaseDelay, o.MaxDelay)
+	}
+	if o.QPS < 0 || o.Burst < 0 {
+		return fmt.Errorf("rate limiter qps and burst must be positive")
+	}
+	return nil
+}
+
+// rateLimiter 构造工作队列限速器：单对象指数退避与全局令牌桶取较大值
+func (o Options) rateLimiter() workqueue.TypedRateLimiter[reconcile.Request] {
+	return workqueue.NewTypedMaxOfRateLimiter(
+		workqueue.NewTypedItemExponentialFailureRateLimiter[reconcile.Request](o.BaseDelay, o.MaxDelay),
+		&workqueue.TypedBucketRateLimiter[reconcile.Request]{Limiter: rate.NewLimiter(rate.Limit(o.QPS), o.Burst)},
+	)
+}
@@ -0,0 +1,37 @@
+package controller
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOptionsWithDefaults(t *testing.T) {
+	got := Options{MaxConcurrentReconciles: 8}.withDefaults()
+	want := DefaultOptions()
+	want.MaxConcurrentReconciles = 8
+	if got != want {
+		t.Errorf("withDefaults() = %+v, want %+v", got, want)
+	}
+}
+
+func TestOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		wantErr bool
+	}{
+		{name: "zero value", opts: Options{}},
+		{name: "defaults", opts: DefaultOptions()},
+		{name: "negative workers", opts: Options{MaxConcurrentReconciles: -1}, wantErr: true},
+		{name: "base delay above max", opts: Options{BaseDelay: time.Minute, MaxDelay: time.Second}, wantErr: true},
+		{name: "negative qps", opts: Options{QPS: -1}, wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.opts.Validate()
+			if (err != nil) != tc.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package controller
+
+import (
+	appsv1 "k8s.io/api/apps/v1"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	myappv1 "github.com/example/myapp-controller/pkg/apis/example/v1"
+)
+
+// myAppPredicate 只在 MyApp 的规格（generation）或注解变化时触发协调，
+// 忽略控制器自己写入 status 引起的更新事件
+func myAppPredicate() predicate.Predicate {
+	return predicate.Or(
+		predicate.GenerationChangedPredicate{},
+		predicate.AnnotationChangedPredicate{},
+	)
+}
+
+// deploymentPredicate 只在 Deployment 的规格、发布进度或就绪情况变化时触发协调，
+// 忽略 Deployment 控制器周期性更新的其他状态字段。
+// observedGeneration 和 updatedReplicas 决定发布是否完成（deploymentRolledOut），PostDeploy 钩子依赖它们触发
+func deploymentPredicate() predicate.Predicate {
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldDeploy, ok := e.ObjectOld.(*appsv1.Deployment)
+			if !ok {
+				return true
+			}
+			newDeploy, ok := e.ObjectNew.(*appsv1.Deployment)
+			if !ok {
+				return true
+			}
+			if oldDeploy.Generation != newDeploy.Generation {
+				return true
+			}
+			return oldDeploy.Status.ObservedGeneration != newDeploy.Status.ObservedGeneration ||
+				oldDeploy.Status.UpdatedReplicas != newDeploy.Status.UpdatedReplicas ||
+				oldDeploy.Status.ReadyReplicas != newDeploy.Status.ReadyReplicas ||
+				oldDeploy.Status.AvailableReplicas != newDeploy.Status.AvailableReplicas
+		},
+	}
+}
+
+// phaseOrSpecChangedPredicate 在 MyApp 的阶段、规格或 status.observedGeneration 变化、创建和删除时触发，
+// 用于依赖该 MyApp 的其他 MyApp 以及生成它的 MyAppSet。两者都要求 MyApp 已协调最新的规格（myAppAvailable），
+// 阶段保持 Running 的滚动更新完成时只有 observedGeneration 变化
+func phaseOrSpecChangedPredicate() predicate.Predicate {
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldApp, ok := e.ObjectOld.(*myappv1.MyApp)
+			if !ok {
+				return true
+			}
+			newApp, ok := e.ObjectNew.(*myappv1.MyApp)
+			if !ok {
+				return true
+			}
+			return oldApp.Status.Phase != newApp.Status.Phase || oldApp.Generation != newApp.Generation ||
+				oldApp.Status.ObservedGeneration != newApp.Status.ObservedGeneration
+		},
+	}
+}
+
+// specChangedOrDeletedPredicate 只在 MyApp 的规格变化或被删除时触发，创建时不触发
+func specChangedOrDeletedPredicate() predicate.Predicate {
+	return predicate.Funcs{
+		CreateFunc: func(event.CreateEvent) bool { return false },
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return e.ObjectOld.GetGeneration() != e.ObjectNew.GetGeneration()
+		},
+	}
+}
+
+// countingPredicate 包装 p，并按资源类型和事件类型统计被处理和被跳过的事件数
+func countingPredicate(kind string, p predicate.Predicate) predicate.Predicate {
+	return predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			return recordEvent(kind, "create", p.Create(e))
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return recordEvent(kind, "update", p.Update(e))
+		},
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			return recordEvent(kind, "delete", p.Delete(e))
+		},
+		GenericFunc: func(e event.GenericEvent) bool {
+			return recordEvent(kind, "generic", p.Generic(e))
+		},
+	}
+}
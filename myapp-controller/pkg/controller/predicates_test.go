@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	myappv1 "github.com/example/myapp-controller/pkg/apis/example/v1"
+)
+
+func TestMyAppPredicate(t *testing.T) {
+	base := newMyApp("default", "web", 1)
+	base.Generation = 1
+
+	tests := []struct {
+		name   string
+		mutate func(*myappv1.MyApp)
+		want   bool
+	}{
+		{name: "status only", mutate: func(a *myappv1.MyApp) { a.Status.Phase = "Running" }, want: false},
+		{name: "spec change", mutate: func(a *myappv1.MyApp) { a.Generation = 2 }, want: true},
+		{name: "annotation change", mutate: func(a *myappv1.MyApp) { a.Annotations = map[string]string{"k": "v"} }, want: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			updated := base.DeepCopy()
+			tc.mutate(updated)
+			got := myAppPredicate().Update(event.UpdateEvent{ObjectOld: base, ObjectNew: updated})
+			if got != tc.want {
+				t.Errorf("Update() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDeploymentPredicate(t *testing.T) {
+	base := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", Generation: 1},
+		Status:     appsv1.DeploymentStatus{ObservedGeneration: 1, Replicas: 2, ReadyReplicas: 1},
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(*appsv1.Deployment)
+		want   bool
+	}{
+		{name: "observed generation", mutate: func(d *appsv1.Deployment) { d.Status.ObservedGeneration = 2 }, want: true},
+		{name: "updated replicas", mutate: func(d *appsv1.Deployment) { d.Status.UpdatedReplicas = 2 }, want: true},
+		{name: "unavailable replicas only", mutate: func(d *appsv1.Deployment) { d.Status.UnavailableReplicas = 1 }, want: false},
+		{name: "conditions only", mutate: func(d *appsv1.Deployment) {
+			d.Status.Conditions = []appsv1.DeploymentCondition{{Type: appsv1.DeploymentProgressing, Status: "True"}}
+		}, want: false},
+		{name: "ready replicas", mutate: func(d *appsv1.Deployment) { d.Status.ReadyReplicas = 2 }, want: true},
+		{name: "available replicas", mutate: func(d *appsv1.Deployment) { d.Status.AvailableReplicas = 1 }, want: true},
+		{name: "spec change", mutate: func(d *appsv1.Deployment) { d.Generation = 2 }, want: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			updated := base.DeepCopy()
+			tc.mutate(updated)
+			got := deploymentPredicate().Update(event.UpdateEvent{ObjectOld: base, ObjectNew: updated})
+			if got != tc.want {
+				t.Errorf("Update() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestPhaseOrSpecChangedPredicate(t *testing.T) {
+	base := newMyApp("default", "payment", 1)
+	base.Generation = 1
+
+	tests := []struct {
+		name   string
+		mutate func(*myappv1.MyApp)
+		want   bool
+	}{
+		{name: "phase change", mutate: func(a *myappv1.MyApp) { a.Status.Phase = "Running" }, want: true},
+		{name: "spec change", mutate: func(a *myappv1.MyApp) { a.Generation = 2 }, want: true},
+		{name: "observed generation", mutate: func(a *myappv1.MyApp) { a.Status.ObservedGeneration = 1 }, want: true},
+		{name: "ready replicas only", mutate: func(a *myappv1.MyApp) { a.Status.ReadyReplicas = 1 }, want: false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			updated := base.DeepCopy()
+			tc.mutate(updated)
+			got := phaseOrSpecChangedPredicate().Update(event.UpdateEvent{ObjectOld: base, ObjectNew: updated})
+			if got != tc.want {
+				t.Errorf("Update() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSpecChangedOrDeletedPredicate(t *testing.T) {
+	base := newMyApp("default", "web", 2)
+	base.Generation = 1
+	p := specChangedOrDeletedPredicate()
+
+	if p.Create(event.CreateEvent{Object: base}) {
+		t.Errorf("Create() = true, want false")
+	}
+	if !p.Delete(event.DeleteEvent{Object: base}) {
+		t.Errorf("Delete() = false, want true")
+	}
+	updated := base.DeepCopy()
+	updated.Status.Phase = "Failed"
+	if p.Update(event.UpdateEvent{ObjectOld: base, ObjectNew: updated}) {
+		t.Errorf("Update() = true for a status change, want false")
+	}
+	updated.Generation = 2
+	if !p.Update(event.UpdateEvent{ObjectOld: base, ObjectNew: updated}) {
+		t.Errorf("Update() = false for a spec change, want true")
+	}
+}
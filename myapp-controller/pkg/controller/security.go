@@ -0,0 +1,381 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	myappv1 "github.com/example/myapp-controller/pkg/apis/example/v1"
+	"github.com/example/myapp-controller/pkg/logging"
+)
+
+// SecurityProfile 是 MyApp 未设置 spec.security 中的字段时使用的默认安全配置档
+type SecurityProfile string
+
+const (
+	// SecurityProfileHardened 以非 root 用户运行、只读根文件系统、去掉所有 capabilities、
+	// 使用 RuntimeDefault seccomp 配置并且不挂载 ServiceAccount 令牌，满足 restricted 级别
+	SecurityProfileHardened SecurityProfile = "hardened"
+	// SecurityProfileNone 不设置任何安全字段，与之前的版本行为一致，是默认的配置档
+	SecurityProfileNone SecurityProfile = "none"
+)
+
+const (
+	// PodSecurityEnforceLabel 是命名空间上声明 Pod Security Standard 强制级别的标签
+	PodSecurityEnforceLabel = "pod-security.kubernetes.io/enforce"
+
+	podSecurityPrivileged = "privileged"
+	podSecurityBaseline   = "baseline"
+	podSecurityRestricted = "restricted"
+)
+
+// baselineCapabilities 是 baseline 级别允许容器额外增加的 capabilities
+var baselineCapabilities = []corev1.Capability{
+	"AUDIT_WRITE", "CHOWN", "DAC_OVERRIDE", "FOWNER", "FSETID", "KILL", "MKNOD",
+	"NET_BIND_SERVICE", "SETFCAP", "SETGID", "SETPCAP", "SETUID", "SYS_CHROOT",
+}
+
+// effectiveSecurity 返回 profile 的默认值被 MyApp 的 spec.security 覆盖后的安全配置
+func effectiveSecurity(profile SecurityProfile, s *myappv1.SecuritySpec) myappv1.SecuritySpec {
+	var out myappv1.SecuritySpec
+	if profile != SecurityProfileNone {
+		out = myappv1.SecuritySpec{
+			RunAsNonRoot:                 ptr.To(true),
+			ReadOnlyRootFilesystem:       ptr.To(true),
+			AllowPrivilegeEscalation:     ptr.To(false),
+			Capabilities:                 &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+			SeccompProfile:               &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+			AutomountServiceAccountToken: ptr.To(false),
+		}
+	}
+	overlaySecurity(&out, s)
+	return out
+}
+
+// overlaySecurity 用 s 中设置的字段覆盖 out 中的对应字段
+func overlaySecurity(out *myappv1.SecuritySpec, s *myappv1.SecuritySpec) {
+	if s == nil {
+		return
+	}
+	s = s.DeepCopy()
+	if s.RunAsNonRoot != nil {
+		out.RunAsNonRoot = s.RunAsNonRoot
+	}
+	if s.RunAsUser != nil {
+		out.RunAsUser = s.RunAsUser
+	}
+	if s.RunAsGroup != nil {
+		out.RunAsGroup = s.RunAsGroup
+	}
+	if s.FSGroup != nil {
+		out.FSGroup = s.FSGroup
+	}
+	if s.ReadOnlyRootFilesystem != nil {
+		out.ReadOnlyRootFilesystem = s.ReadOnlyRootFilesystem
+	}
+	if s.AllowPrivilegeEscalation != nil {
+		out.AllowPrivilegeEscalation = s.AllowPrivilegeEscalation
+	}
+	if s.Capabilities != nil {
+		out.Capabilities = s.Capabilities
+	}
+	if s.SeccompProfile != nil {
+		out.SeccompProfile = s.SeccompProfile
+	}
+	if s.AutomountServiceAccountToken != nil {
+		out.AutomountServiceAccountToken = s.AutomountServiceAccountToken
+	}
+}
+
+// applySecurity 将安全配置写入 Pod 规格：用户、组和 seccomp 设置在 Pod 上，
+// 其余字段设置在每个容器和 init 容器上
+func applySecurity(pod *corev1.PodSpec, sec myappv1.SecuritySpec) {
+	podContext := corev1.PodSecurityContext{
+		RunAsNonRoot:   sec.RunAsNonRoot,
+		RunAsUser:      sec.RunAsUser,
+		RunAsGroup:     sec.RunAsGroup,
+		FSGroup:        sec.FSGroup,
+		SeccompProfile: sec.SeccompProfile,
+	}
+	if !equality.Semantic.DeepEqual(podContext, corev1.PodSecurityContext{}) {
+		pod.SecurityContext = &podContext
+	}
+	pod.AutomountServiceAccountToken = sec.AutomountServiceAccountToken
+
+	containerContext := corev1.SecurityContext{
+		ReadOnlyRootFilesystem:   sec.ReadOnlyRootFilesystem,
+		AllowPrivilegeEscalation: sec.AllowPrivilegeEscalation,
+		Capabilities:             sec.Capabilities,
+	}
+	if containerContext == (corev1.SecurityContext{}) {
+		return
+	}
+	for i := range pod.Containers {
+		pod.Containers[i].SecurityContext = containerContext.DeepCopy()
+	}
+	for i := range pod.InitContainers {
+		pod.InitContainers[i].SecurityContext = containerContext.DeepCopy()
+	}
+}
+
+// applyDefaultSecurity 与 applySecurity 相同，但只设置 Pod 规格中未设置的字段，
+// 用于钩子 Job 这类由用户提供 Pod 模板的 Pod，模板中显式设置的字段保持不变
+func applyDefaultSecurity(pod *corev1.PodSpec, sec myappv1.SecuritySpec) {
+	podContext := pod.SecurityContext.DeepCopy()
+	if podContext == nil {
+		podContext = &corev1.PodSecurityContext{}
+	}
+	if podContext.RunAsNonRoot == nil {
+		podContext.RunAsNonRoot = sec.RunAsNonRoot
+	}
+	if podContext.RunAsUser == nil {
+		podContext.RunAsUser = sec.RunAsUser
+	}
+	if podContext.RunAsGroup == nil {
+		podContext.RunAsGroup = sec.RunAsGroup
+	}
+	if podContext.FSGroup == nil {
+		podContext.FSGroup = sec.FSGroup
+	}
+	if podContext.SeccompProfile == nil {
+		podContext.SeccompProfile = sec.SeccompProfile
+	}
+	if !equality.Semantic.DeepEqual(*podContext, corev1.PodSecurityContext{}) {
+		pod.SecurityContext = podContext.DeepCopy()
+	}
+	if pod.AutomountServiceAccountToken == nil {
+		pod.AutomountServiceAccountToken = sec.AutomountServiceAccountToken
+	}
+
+	fill := func(c *corev1.Container) {
+		sc := c.SecurityContext
+		if sc == nil {
+			sc = &corev1.SecurityContext{}
+		}
+		if sc.ReadOnlyRootFilesystem == nil {
+			sc.ReadOnlyRootFilesystem = sec.ReadOnlyRootFilesystem
+		}
+		if sc.AllowPrivilegeEscalation == nil {
+			sc.AllowPrivilegeEscalation = sec.AllowPrivilegeEscalation
+		}
+		if sc.Capabilities == nil {
+			sc.Capabilities = sec.Capabilities
+		}
+		if !equality.Semantic.DeepEqual(*sc, corev1.SecurityContext{}) {
+			c.SecurityContext = sc.DeepCopy()
+		}
+	}
+	for i := range pod.Containers {
+		fill(&pod.Containers[i])
+	}
+	for i := range pod.InitContainers {
+		fill(&pod.InitContainers[i])
+	}
+}
+
+// syncPodSecurity 将期望 Pod 的安全配置同步到已存在的 Pod 模板，有变化时返回 true。
+// apiserver 会把未设置的 securityContext 补成空对象，两者视为相同
+func syncPodSecurity(found, desired *corev1.PodSpec) bool {
+	changed := false
+	foundContext, desiredContext := found.SecurityContext, desired.SecurityContext
+	if foundContext == nil {
+		foundContext = &corev1.PodSecurityContext{}
+	}
+	if desiredContext == nil {
+		desiredContext = &corev1.PodSecurityContext{}
+	}
+	if !equality.Semantic.DeepEqual(foundContext, desiredContext) {
+		found.SecurityContext = desired.SecurityContext
+		changed = true
+	}
+	if !equality.Semantic.DeepEqual(found.AutomountServiceAccountToken, desired.AutomountServiceAccountToken) {
+		found.AutomountServiceAccountToken = desired.AutomountServiceAccountToken
+		changed = true
+	}
+	return changed
+}
+
+// namespaceLabelsTTL 是命名空间标签的缓存时间
+const namespaceLabelsTTL = 30 * time.Second
+
+// namespaceLabelCache 缓存从 apiserver 读取的命名空间标签，避免每次协调都请求 apiserver。
+// 命名空间级别安装时控制器只能按名称读取命名空间，无法使用 informer。零值可以直接使用
+type namespaceLabelCache struct {
+	mu      sync.Mutex
+	entries map[string]namespaceLabels
+}
+
+// namespaceLabels 是缓存中一个命名空间的标签
+type namespaceLabels struct {
+	labels  map[string]string
+	expires time.Time
+}
+
+// get 返回命名空间的标签，缓存过期或不存在时通过 reader 读取。
+// 不存在的命名空间视为没有标签，读取失败时不缓存
+func (c *namespaceLabelCache) get(ctx context.Context, reader client.Reader, name string, now time.Time) (map[string]string, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[name]
+	c.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.labels, nil
+	}
+
+	ns := &corev1.Namespace{}
+	if err := reader.Get(ctx, client.ObjectKey{Name: name}, ns); err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = map[string]namespaceLabels{}
+	}
+	// 顺带清理过期条目，已删除的命名空间不会一直留在缓存中
+	for k, e := range c.entries {
+		if !now.Before(e.expires) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[name] = namespaceLabels{labels: ns.Labels, expires: now.Add(namespaceLabelsTTL)}
+	return ns.Labels, nil
+}
+
+// securityCondition 检查 Pod 规格和钩子 Job 的 Pod 规格是否符合 MyApp 所在命名空间强制执行的 Pod Security Standard 级别。
+// 命名空间从 apiserver 读取并缓存 namespaceLabelsTTL，无法读取时返回 Unknown，不影响协调
+func (r *MyAppReconciler) securityCondition(ctx context.Context, m *myappv1.MyApp, pod *corev1.PodSpec) metav1.Condition {
+	cond := metav1.Condition{Type: myappv1.ConditionSecurityCompliant, ObservedGeneration: m.Generation}
+
+	nsLabels, err := r.namespaceLabels.get(ctx, r.apiReader(), m.Namespace, time.Now())
+	if err != nil {
+		log.FromContext(ctx).V(1).Info("Failed to get Namespace", logging.KeyAction, actionGet, logging.KeyResource, "Namespace", "error", err.Error())
+		cond.Status = metav1.ConditionUnknown
+		cond.Reason = "NamespaceUnavailable"
+		cond.Message = fmt.Sprintf("无法读取命名空间 %s 的 Pod Security Standard 级别: %v", m.Namespace, err)
+		return cond
+	}
+
+	level := podSecurityLevel(nsLabels[PodSecurityEnforceLabel])
+	violations := podSecurityViolations(level, pod)
+	// 钩子 Job 的 Pod 同样会被 Pod Security Admission 拒绝，PreDeploy 钩子无法运行时发布会一直等待
+	for _, hook := range hookSpecs(m) {
+		job := r.hookJobForMyApp(m, hook.hookType, hook.spec, "")
+		for _, v := range podSecurityViolations(level, &job.Spec.Template.Spec) {
+			violations = append(violations, fmt.Sprintf("%s hook: %s", hook.hookType, v))
+		}
+	}
+	if len(violations) > 0 {
+		cond.Status = metav1.ConditionFalse
+		cond.Reason = "PodSecurityViolation"
+		cond.Message = fmt.Sprintf("Pod 规格不符合命名空间 %s 的 %s 级别: %s", m.Namespace, level, strings.Join(violations, "; "))
+		return cond
+	}
+	cond.Status = metav1.ConditionTrue
+	cond.Reason = "Compliant"
+	cond.Message = fmt.Sprintf("Pod 规格符合命名空间 %s 的 %s 级别", m.Namespace, level)
+	return cond
+}
+
+// podSecurityLevel 与 Pod Security Admission 一致：未设置时为 privileged，无法识别的值按 restricted 处理
+func podSecurityLevel(label string) string {
+	switch label {
+	case "", podSecurityPrivileged:
+		return podSecurityPrivileged
+	case podSecurityBaseline:
+		return podSecurityBaseline
+	default:
+		return podSecurityRestricted
+	}
+}
+
+// podSecurityViolations 返回 Pod 规格违反 level 级别的检查项。
+// 只检查控制器生成的 Pod 可能出现的字段，主机命名空间、hostPath 等控制器不会设置的字段不在检查范围内
+func podSecurityViolations(level string, pod *corev1.PodSpec) []string {
+	if level == podSecurityPrivileged {
+		return nil
+	}
+
+	var violations []string
+	podContext := pod.SecurityContext
+	if podContext == nil {
+		podContext = &corev1.PodSecurityContext{}
+	}
+	containers := append(append([]corev1.Container{}, pod.InitContainers...), pod.Containers...)
+
+	// baseline
+	if podContext.SeccompProfile != nil && podContext.SeccompProfile.Type == corev1.SeccompProfileTypeUnconfined {
+		violations = append(violations, "pod seccompProfile is Unconfined")
+	}
+	for _, c := range containers {
+		sc := c.SecurityContext
+		if sc == nil {
+			continue
+		}
+		if ptr.Deref(sc.Privileged, false) {
+			violations = append(violations, fmt.Sprintf("container %q is privileged", c.Name))
+		}
+		if sc.SeccompProfile != nil && sc.SeccompProfile.Type == corev1.SeccompProfileTypeUnconfined {
+			violations = append(violations, fmt.Sprintf("container %q seccompProfile is Unconfined", c.Name))
+		}
+		if sc.Capabilities != nil {
+			for _, capability := range sc.Capabilities.Add {
+				if !slices.Contains(baselineCapabilities, capability) {
+					violations = append(violations, fmt.Sprintf("container %q adds capability %s", c.Name, capability))
+				}
+			}
+		}
+	}
+	if level == podSecurityBaseline {
+		return violations
+	}
+
+	// restricted
+	if ptr.Deref(podContext.RunAsUser, -1) == 0 {
+		violations = append(violations, "pod runAsUser is 0")
+	}
+	for _, c := range containers {
+		sc := c.SecurityContext
+		if sc == nil {
+			sc = &corev1.SecurityContext{}
+		}
+		if !ptr.Deref(sc.RunAsNonRoot, ptr.Deref(podContext.RunAsNonRoot, false)) {
+			violations = append(violations, fmt.Sprintf("container %q must set runAsNonRoot=true", c.Name))
+		}
+		if ptr.Deref(sc.RunAsUser, -1) == 0 {
+			violations = append(violations, fmt.Sprintf("container %q runAsUser is 0", c.Name))
+		}
+		if ptr.Deref(sc.AllowPrivilegeEscalation, true) {
+			violations = append(violations, fmt.Sprintf("container %q must set allowPrivilegeEscalation=false", c.Name))
+		}
+		seccomp := sc.SeccompProfile
+		if seccomp == nil {
+			seccomp = podContext.SeccompProfile
+		}
+		if seccomp == nil || (seccomp.Type != corev1.SeccompProfileTypeRuntimeDefault && seccomp.Type != corev1.SeccompProfileTypeLocalhost) {
+			violations = append(violations, fmt.Sprintf("container %q must use the RuntimeDefault or Localhost seccomp profile", c.Name))
+		}
+		if sc.Capabilities == nil || !slices.Contains(sc.Capabilities.Drop, "ALL") {
+			violations = append(violations, fmt.Sprintf("container %q must drop ALL capabilities", c.Name))
+		}
+		if sc.Capabilities != nil {
+			for _, capability := range sc.Capabilities.Add {
+				// 不在 baseline 允许列表中的已在上面报告
+				if capability != "NET_BIND_SERVICE" && slices.Contains(baselineCapabilities, capability) {
+					violations = append(violations, fmt.Sprintf("container %q may only add NET_BIND_SERVICE, not %s", c.Name, capability))
+				}
+			}
+		}
+	}
+	return violations
+}
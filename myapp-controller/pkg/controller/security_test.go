@@ -0,0 +1,168 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	myappv1 "github.com/example/myapp-controller/pkg/apis/example/v1"
+)
+
+func TestEffectiveSecurity(t *testing.T) {
+	if sec := effectiveSecurity(SecurityProfileNone, nil); sec.RunAsNonRoot != nil || sec.Capabilities != nil {
+		t.Errorf("none profile = %+v, want no security fields", sec)
+	}
+
+	sec := effectiveSecurity(SecurityProfileHardened, &myappv1.SecuritySpec{
+		ReadOnlyRootFilesystem: ptr.To(false),
+		RunAsUser:              ptr.To[int64](1000),
+	})
+	if !ptr.Deref(sec.RunAsNonRoot, false) || ptr.Deref(sec.AutomountServiceAccountToken, true) {
+		t.Errorf("hardened defaults were not kept: %+v", sec)
+	}
+	if ptr.Deref(sec.ReadOnlyRootFilesystem, true) || ptr.Deref(sec.RunAsUser, 0) != 1000 {
+		t.Errorf("spec.security did not override the profile: %+v", sec)
+	}
+}
+
+func TestApplyDefaultSecurity(t *testing.T) {
+	pod := &corev1.PodSpec{
+		SecurityContext: &corev1.PodSecurityContext{RunAsUser: ptr.To[int64](1000)},
+		Containers: []corev1.Container{
+			{Name: "migrate", SecurityContext: &corev1.SecurityContext{ReadOnlyRootFilesystem: ptr.To(false)}},
+			{Name: "check"},
+		},
+	}
+	applyDefaultSecurity(pod, effectiveSecurity(SecurityProfileHardened, nil))
+
+	if ptr.Deref(pod.SecurityContext.RunAsUser, 0) != 1000 || !ptr.Deref(pod.SecurityContext.RunAsNonRoot, false) ||
+		pod.SecurityContext.SeccompProfile == nil || ptr.Deref(pod.AutomountServiceAccountToken, true) {
+		t.Errorf("pod security context = %+v, want the profile to fill only unset fields", pod.SecurityContext)
+	}
+	if sc := pod.Containers[0].SecurityContext; ptr.Deref(sc.ReadOnlyRootFilesystem, true) || ptr.Deref(sc.AllowPrivilegeEscalation, true) {
+		t.Errorf("container security context = %+v, want readOnlyRootFilesystem=false kept", sc)
+	}
+	if sc := pod.Containers[1].SecurityContext; sc == nil || !ptr.Deref(sc.ReadOnlyRootFilesystem, false) || sc.Capabilities == nil {
+		t.Errorf("container security context = %+v, want the hardened defaults", sc)
+	}
+
+	// none 配置档不添加任何字段
+	pod = &corev1.PodSpec{Containers: []corev1.Container{{Name: "migrate"}}}
+	applyDefaultSecurity(pod, effectiveSecurity(SecurityProfileNone, nil))
+	if pod.SecurityContext != nil || pod.AutomountServiceAccountToken != nil || pod.Containers[0].SecurityContext != nil {
+		t.Errorf("pod spec = %+v, want no security fields", pod)
+	}
+}
+
+func TestPodSecurityViolations(t *testing.T) {
+	pod := func(sec myappv1.SecuritySpec) *corev1.PodSpec {
+		spec := &corev1.PodSpec{
+			Containers:     []corev1.Container{{Name: "app"}, {Name: "proxy"}},
+			InitContainers: []corev1.Container{{Name: "migrate"}},
+		}
+		applySecurity(spec, sec)
+		return spec
+	}
+	hardened := effectiveSecurity(SecurityProfileHardened, nil)
+	withCaps := effectiveSecurity(SecurityProfileHardened, &myappv1.SecuritySpec{
+		Capabilities: &corev1.Capabilities{Add: []corev1.Capability{"NET_ADMIN"}, Drop: []corev1.Capability{"ALL"}},
+	})
+	asRoot := effectiveSecurity(SecurityProfileHardened, &myappv1.SecuritySpec{RunAsNonRoot: ptr.To(false)})
+
+	tests := []struct {
+		name  string
+		level string
+		pod   *corev1.PodSpec
+		want  []string
+	}{
+		{name: "privileged allows everything", level: podSecurityPrivileged, pod: pod(withCaps)},
+		{name: "hardened is restricted", level: podSecurityRestricted, pod: pod(hardened)},
+		{name: "no security fields are baseline", level: podSecurityBaseline, pod: pod(myappv1.SecuritySpec{})},
+		{name: "no security fields are not restricted", level: podSecurityRestricted, pod: pod(myappv1.SecuritySpec{}),
+			want: []string{`container "migrate" must set runAsNonRoot=true`, `container "app" must drop ALL capabilities`}},
+		{name: "extra capability violates baseline", level: podSecurityBaseline, pod: pod(withCaps),
+			want: []string{`container "app" adds capability NET_ADMIN`}},
+		{name: "root violates restricted", level: podSecurityRestricted, pod: pod(asRoot),
+			want: []string{`container "proxy" must set runAsNonRoot=true`}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := strings.Join(podSecurityViolations(tc.level, tc.pod), "; ")
+			if len(tc.want) == 0 && got != "" {
+				t.Fatalf("violations = %s, want none", got)
+			}
+			for _, want := range tc.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("violations = %s, want %s", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestPodSecurityLevel(t *testing.T) {
+	for label, want := range map[string]string{
+		"":           podSecurityPrivileged,
+		"baseline":   podSecurityBaseline,
+		"restricted": podSecurityRestricted,
+		"strict":     podSecurityRestricted,
+	} {
+		if got := podSecurityLevel(label); got != want {
+			t.Errorf("podSecurityLevel(%q) = %q, want %q", label, got, want)
+		}
+	}
+}
+
+func TestNamespaceLabelCache(t *testing.T) {
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name: "team-a", Labels: map[string]string{PodSecurityEnforceLabel: "restricted"},
+	}}
+	var gets int
+	var getErr error
+	c := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(ns).WithInterceptorFuncs(interceptor.Funcs{
+		Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+			gets++
+			if getErr != nil {
+				return getErr
+			}
+			return c.Get(ctx, key, obj, opts...)
+		},
+	}).Build()
+	ctx := context.Background()
+	now := time.Now()
+	var cache namespaceLabelCache
+
+	for i := 0; i < 3; i++ {
+		labels, err := cache.get(ctx, c, "team-a", now)
+		if err != nil || labels[PodSecurityEnforceLabel] != "restricted" {
+			t.Fatalf("labels = %v, err = %v, want the namespace labels", labels, err)
+		}
+	}
+	if gets != 1 {
+		t.Errorf("gets = %d, want later reads to be served from the cache", gets)
+	}
+
+	// 过期后重新读取，读取失败时不缓存错误
+	getErr = errors.New("apiserver unavailable")
+	if _, err := cache.get(ctx, c, "team-a", now.Add(namespaceLabelsTTL)); err == nil {
+		t.Errorf("expected the error after the entry expired")
+	}
+	getErr = nil
+	if _, err := cache.get(ctx, c, "team-a", now.Add(namespaceLabelsTTL)); err != nil || gets != 3 {
+		t.Errorf("gets = %d, err = %v, want the namespace to be read again", gets, err)
+	}
+
+	// 不存在的命名空间视为没有标签
+	if labels, err := cache.get(ctx, c, "missing", now); err != nil || len(labels) != 0 {
+		t.Errorf("labels = %v, err = %v, want no labels for a missing namespace", labels, err)
+	}
+}
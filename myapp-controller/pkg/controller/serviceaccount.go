@@ -0,0 +1,307 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	myappv1 "github.com/example/myapp-controller/pkg/apis/example/v1"
+	"github.com/example/myapp-controller/pkg/logging"
+)
+
+// ManagedAnnotationsAnnotation 记录控制器写入 ServiceAccount 的 spec.serviceAccount.annotations 的键，以逗号分隔。
+// 从 spec 中删除的键据此从 ServiceAccount 上移除，其他人添加的注解保持不变
+const ManagedAnnotationsAnnotation = "myapp.example.com/managed-annotations"
+
+// permanentError 表示需要用户修改 MyApp 或授予控制器权限才能解决的问题，重试无法恢复
+type permanentError struct {
+	msg string
+}
+
+func (e *permanentError) Error() string {
+	return e.msg
+}
+
+// serviceAccountName 返回 MyApp 的 Pod 使用的 ServiceAccount，为空表示命名空间的 default
+func serviceAccountName(m *myappv1.MyApp) string {
+	if m.Spec.ServiceAccount == nil {
+		return ""
+	}
+	return m.Name
+}
+
+// needsServiceAccountToken 判断 Pod 是否需要挂载 ServiceAccount 令牌：
+// 声明了权限且没有在 spec.security 中显式关闭时，应用需要令牌访问 apiserver
+func needsServiceAccountToken(m *myappv1.MyApp) bool {
+	return m.Spec.ServiceAccount != nil && len(m.Spec.ServiceAccount.Rules) > 0 &&
+		(m.Spec.Security == nil || m.Spec.Security.AutomountServiceAccountToken == nil)
+}
+
+// reconcileServiceAccount 创建或同步 MyApp 的 ServiceAccount、Role 和 RoleBinding，不再声明权限时删除 Role 和 RoleBinding。
+// Role 的权限变化时先检查控制器自身是否持有这些权限。未设置 spec.serviceAccount 时什么也不做，
+// 由 cleanupServiceAccount 在 Deployment 不再引用 ServiceAccount 之后删除
+func (r *MyAppReconciler) reconcileServiceAccount(ctx context.Context, m *myappv1.MyApp) error {
+	if m.Spec.ServiceAccount == nil {
+		return nil
+	}
+
+	labels := withManagedByLabel(map[string]string{"app": m.Name})
+	meta := metav1.ObjectMeta{Name: m.Name, Namespace: m.Namespace, Labels: labels}
+
+	sa := &corev1.ServiceAccount{ObjectMeta: *meta.DeepCopy()}
+	annotations := m.Spec.ServiceAccount.Annotations
+	sa.Annotations = maps.Clone(annotations)
+	managed := strings.Join(slices.Sorted(maps.Keys(annotations)), ",")
+	if managed != "" {
+		sa.Annotations[ManagedAnnotationsAnnotation] = managed
+	}
+	foundSA := &corev1.ServiceAccount{}
+	if err := r.ensureOwned(ctx, m, "ServiceAccount", sa, foundSA, func() bool {
+		changed := syncLabels(&foundSA.ObjectMeta, labels)
+		return syncServiceAccountAnnotations(&foundSA.ObjectMeta, annotations) || changed
+	}); err != nil {
+		return err
+	}
+
+	rules := m.Spec.ServiceAccount.Rules
+	if len(rules) == 0 {
+		return r.deleteOwned(ctx, m, &rbacv1.RoleBinding{}, &rbacv1.Role{})
+	}
+
+	role := &rbacv1.Role{ObjectMeta: *meta.DeepCopy(), Rules: rules}
+	foundRole := &rbacv1.Role{}
+	err := r.Get(ctx, client.ObjectKeyFromObject(role), foundRole)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	if errors.IsNotFound(err) || !equality.Semantic.DeepEqual(foundRole.Rules, rules) {
+		// RBAC 不允许授予自身没有的权限，提前检查以便给出明确的原因
+		denied, err := r.deniedPermissions(ctx, m.Namespace, rules)
+		if err != nil {
+			return err
+		}
+		if len(denied) > 0 {
+			return &permanentError{msg: fmt.Sprintf("serviceAccount rules grant permissions the controller does not hold: %s", strings.Join(denied, ", "))}
+		}
+	}
+	if err := r.ensureOwned(ctx, m, "Role", role, foundRole, func() bool {
+		changed := syncLabels(&foundRole.ObjectMeta, labels)
+		if !equality.Semantic.DeepEqual(foundRole.Rules, rules) {
+			foundRole.Rules = rules
+			changed = true
+		}
+		return changed
+	}); err != nil {
+		return err
+	}
+
+	subjects := []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: sa.Name, Namespace: m.Namespace}}
+	binding := &rbacv1.RoleBinding{
+		ObjectMeta: *meta.DeepCopy(),
+		RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: role.Name},
+		Subjects:   subjects,
+	}
+	foundBinding := &rbacv1.RoleBinding{}
+	return r.ensureOwned(ctx, m, "RoleBinding", binding, foundBinding, func() bool {
+		changed := syncLabels(&foundBinding.ObjectMeta, labels)
+		if !equality.Semantic.DeepEqual(foundBinding.Subjects, subjects) {
+			foundBinding.Subjects = subjects
+			changed = true
+		}
+		return changed
+	})
+}
+
+// syncServiceAccountAnnotations 将 annotations 同步到已存在的 ServiceAccount，有变化时返回 true。
+// 上次由控制器写入、但已不在 annotations 中的键会被删除
+func syncServiceAccountAnnotations(found *metav1.ObjectMeta, annotations map[string]string) bool {
+	changed := false
+	if previous := found.Annotations[ManagedAnnotationsAnnotation]; previous != "" {
+		for _, k := range strings.Split(previous, ",") {
+			if _, ok := annotations[k]; !ok {
+				if _, exists := found.Annotations[k]; exists {
+					delete(found.Annotations, k)
+					changed = true
+				}
+			}
+		}
+	}
+	for k, v := range annotations {
+		if found.Annotations[k] != v {
+			if found.Annotations == nil {
+				found.Annotations = map[string]string{}
+			}
+			found.Annotations[k] = v
+			changed = true
+		}
+	}
+
+	managed := strings.Join(slices.Sorted(maps.Keys(annotations)), ",")
+	if found.Annotations[ManagedAnnotationsAnnotation] != managed {
+		if managed == "" {
+			delete(found.Annotations, ManagedAnnotationsAnnotation)
+		} else {
+			if found.Annotations == nil {
+				found.Annotations = map[string]string{}
+			}
+			found.Annotations[ManagedAnnotationsAnnotation] = managed
+		}
+		changed = true
+	}
+	return changed
+}
+
+// cleanupServiceAccount 在未设置 spec.serviceAccount 时删除之前为 MyApp 创建的 RoleBinding、Role 和 ServiceAccount
+func (r *MyAppReconciler) cleanupServiceAccount(ctx context.Context, m *myappv1.MyApp) error {
+	if m.Spec.ServiceAccount != nil {
+		return nil
+	}
+	return r.deleteOwned(ctx, m, &rbacv1.RoleBinding{}, &rbacv1.Role{}, &corev1.ServiceAccount{})
+}
+
+// ensureOwned 创建 desired，已存在时调用 sync 将期望状态同步到 existing 并在有变化时更新。
+// 同名对象不属于该 MyApp 时返回 permanentError，不接管用户自己创建的对象
+func (r *MyAppReconciler) ensureOwned(ctx context.Context, m *myappv1.MyApp, kind string, desired, existing client.Object, sync func() bool) error {
+	logger := log.FromContext(ctx)
+	if err := ctrl.SetControllerReference(m, desired, r.Scheme); err != nil {
+		return err
+	}
+
+	key := client.ObjectKeyFromObject(desired)
+	err := r.Get(ctx, key, existing)
+	if errors.IsNotFound(err) {
+		err = r.Create(ctx, desired)
+		if err == nil {
+			logger.Info("Created "+kind, logging.KeyAction, actionCreate, logging.KeyResource, kind)
+			return nil
+		}
+		if !errors.IsAlreadyExists(err) {
+			logger.Error(err, "Failed to create "+kind, logging.KeyAction, actionCreate, logging.KeyResource, kind)
+			return err
+		}
+		// 没有 ManagedByLabel 的同名对象不在缓存中
+		err = r.apiReader().Get(ctx, key, existing)
+	}
+	if err != nil {
+		logger.Error(err, "Failed to get "+kind, logging.KeyAction, actionGet, logging.KeyResource, kind)
+		return err
+	}
+
+	if !metav1.IsControlledBy(existing, m) {
+		return &permanentError{msg: fmt.Sprintf("%s %s already exists and is not owned by MyApp %s", kind, key.Name, m.Name)}
+	}
+	if !sync() {
+		return nil
+	}
+	if err := r.Update(ctx, existing); err != nil {
+		logger.Error(err, "Failed to update "+kind, logging.KeyAction, actionUpdate, logging.KeyResource, kind)
+		return err
+	}
+	logger.Info("Updated "+kind, logging.KeyAction, actionUpdate, logging.KeyResource, kind)
+	return nil
+}
+
+// deleteOwned 删除 MyApp 拥有的与 MyApp 同名的对象，对象不存在或不属于该 MyApp 时忽略
+func (r *MyAppReconciler) deleteOwned(ctx context.Context, m *myappv1.MyApp, objs ...client.Object) error {
+	for _, obj := range objs {
+		err := r.Get(ctx, client.ObjectKey{Namespace: m.Namespace, Name: m.Name}, obj)
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if !metav1.IsControlledBy(obj, m) {
+			continue
+		}
+		kind := obj.GetObjectKind().GroupVersionKind().Kind
+		if gvk, err := apiutil.GVKForObject(obj, r.Scheme); err == nil {
+			kind = gvk.Kind
+		}
+		if err := r.Delete(ctx, obj); err != nil && !errors.IsNotFound(err) {
+			log.FromContext(ctx).Error(err, "Failed to delete "+kind, logging.KeyAction, actionDelete, logging.KeyResource, kind)
+			return err
+		}
+		log.FromContext(ctx).Info("Deleted "+kind, logging.KeyAction, actionDelete, logging.KeyResource, kind)
+	}
+	return nil
+}
+
+// syncLabels 将 labels 合并到对象的标签中，有变化时返回 true
+func syncLabels(obj *metav1.ObjectMeta, labels map[string]string) bool {
+	changed := false
+	for k, v := range labels {
+		if obj.Labels[k] != v {
+			if obj.Labels == nil {
+				obj.Labels = map[string]string{}
+			}
+			obj.Labels[k] = v
+			changed = true
+		}
+	}
+	return changed
+}
+
+// deniedPermissions 通过 SelfSubjectAccessReview 检查控制器在 namespace 中是否持有 rules 的全部权限，
+// 返回缺少的权限，例如 "delete secrets"
+func (r *MyAppReconciler) deniedPermissions(ctx context.Context, namespace string, rules []rbacv1.PolicyRule) ([]string, error) {
+	var denied []string
+	for _, rule := range rules {
+		names := rule.ResourceNames
+		if len(names) == 0 {
+			names = []string{""}
+		}
+		for _, group := range rule.APIGroups {
+			for _, res := range rule.Resources {
+				resource, subresource, _ := strings.Cut(res, "/")
+				for _, verb := range rule.Verbs {
+					for _, name := range names {
+						review := &authorizationv1.SelfSubjectAccessReview{
+							Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+								ResourceAttributes: &authorizationv1.ResourceAttributes{
+									Namespace:   namespace,
+									Verb:        verb,
+									Group:       group,
+									Resource:    resource,
+									Subresource: subresource,
+									Name:        name,
+								},
+							},
+						}
+						if err := r.Create(ctx, review); err != nil {
+							return nil, fmt.Errorf("failed to review access to %s: %w", res, err)
+						}
+						if !review.Status.Allowed {
+							denied = append(denied, describePermission(verb, group, res, name))
+						}
+					}
+				}
+			}
+		}
+	}
+	return denied, nil
+}
+
+// describePermission 返回权限的可读描述，例如 "get deployments.apps/web"
+func describePermission(verb, group, resource, name string) string {
+	if group != "" {
+		resource += "." + group
+	}
+	if name != "" {
+		resource += "/" + name
+	}
+	return verb + " " + resource
+}
@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	myappv1 "github.com/example/myapp-controller/pkg/apis/example/v1"
+)
+
+// computeStatus 根据 Deployment 的当前状态计算 MyApp 的状态
+func computeStatus(m *myappv1.MyApp, deploy *appsv1.Deployment) myappv1.MyAppStatus {
+	status := myappv1.MyAppStatus{
+		ReadyReplicas: deploy.Status.ReadyReplicas,
+	}
+	if deploy.Status.ReadyReplicas == m.Spec.Replicas {
+		status.Phase = "Running"
+		status.Message = "所有副本都已就绪"
+	} else {
+		status.Phase = "Pending"
+		status.Message = fmt.Sprintf("等待副本就绪: %d/%d", deploy.Status.ReadyReplicas, m.Spec.Replicas)
+	}
+	return status
+}
+
+// withCondition 返回设置了 cond 之后的状况列表，不修改 conditions 本身。
+// 状况的 status 未变化时保留原来的 LastTransitionTime
+func withCondition(conditions []metav1.Condition, cond metav1.Condition) []metav1.Condition {
+	out := make([]metav1.Condition, 0, len(conditions)+1)
+	for _, c := range conditions {
+		out = append(out, *c.DeepCopy())
+	}
+	meta.SetStatusCondition(&out, cond)
+	return out
+}
+
+// withoutCondition 返回去掉 condType 状况之后的状况列表，不修改 conditions 本身
+func withoutCondition(conditions []metav1.Condition, condType string) []metav1.Condition {
+	out := make([]metav1.Condition, 0, len(conditions))
+	for _, c := range conditions {
+		if c.Type != condType {
+			out = append(out, *c.DeepCopy())
+		}
+	}
+	return out
+}
+
+// updateStatus 通过带乐观锁的 merge patch 写入 status，冲突时重新获取最新对象并重试。
+// 状态与当前对象一致时不发起任何写请求。status 的 observedGeneration 设置为 m 的 generation
+func (r *MyAppReconciler) updateStatus(ctx context.Context, m *myappv1.MyApp, status myappv1.MyAppStatus) error {
+	status.ObservedGeneration = m.Generation
+	latest := m
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if latest == nil {
+			latest = &myappv1.MyApp{}
+			if err := r.Get(ctx, client.ObjectKeyFromObject(m), latest); err != nil {
+				return err
+			}
+		}
+		if equality.Semantic.DeepEqual(latest.Status, status) {
+			return nil
+		}
+
+		patch := client.MergeFromWithOptions(latest.DeepCopy(), client.MergeFromWithOptimisticLock{})
+		latest.Status = status
+		err := r.Status().Patch(ctx, latest, patch)
+		// 下次重试时重新读取最新对象
+		latest = nil
+		return err
+	})
+}
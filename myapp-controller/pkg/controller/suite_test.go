@@ -0,0 +1,161 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+
+	myappv1 "github.com/example/myapp-controller/pkg/apis/example/v1"
+)
+
+// envtest 集成测试共享的环境，只有设置了 KUBEBUILDER_ASSETS 时才会启动
+var (
+	testEnv   *envtest.Environment
+	cfg       *rest.Config
+	k8sClient client.Client
+)
+
+const (
+	// eventuallyTimeout 是等待控制器收敛的最长时间
+	eventuallyTimeout = 20 * time.Second
+	// eventuallyInterval 是轮询间隔
+	eventuallyInterval = 100 * time.Millisecond
+)
+
+func TestMain(m *testing.M) {
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		// 没有 kube-apiserver 和 etcd 二进制文件时只运行单元测试
+		fmt.Println("KUBEBUILDER_ASSETS is not set, envtest integration tests will be skipped")
+		os.Exit(m.Run())
+	}
+
+	logf.SetLogger(zap.New(zap.WriteTo(os.Stderr), zap.UseDevMode(true)))
+
+	testEnv = &envtest.Environment{
+		CRDDirectoryPaths:     []string{filepath.Join("..", "..", "config", "crd")},
+		ErrorIfCRDPathMissing: true,
+	}
+
+	var err error
+	cfg, err = testEnv.Start()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to start envtest: %v\n", err)
+		os.Exit(1)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := startManager(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to start manager: %v\n", err)
+		cancel()
+		_ = testEnv.Stop()
+		os.Exit(1)
+	}
+
+	code := m.Run()
+
+	cancel()
+	if err := testEnv.Stop(); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to stop envtest: %v\n", err)
+	}
+	os.Exit(code)
+}
+
+// newTestScheme 返回注册了内置类型和 MyApp 的 scheme
+func newTestScheme() *runtime.Scheme {
+	s := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(s))
+	utilruntime.Must(myappv1.AddToScheme(s))
+	return s
+}
+
+// startManager 启动运行 MyAppReconciler 的 manager，并创建直连 apiserver 的测试客户端
+func startManager(ctx context.Context) error {
+	s := newTestScheme()
+
+	var err error
+	k8sClient, err = client.New(cfg, client.Options{Scheme: s})
+	if err != nil {
+		return err
+	}
+
+	// 与 cmd/main.go 一样只缓存带有 ManagedByLabel 的 Deployment 和 Service
+	cacheOpts, err := CacheOptions(nil, "")
+	if err != nil {
+		return err
+	}
+	mgr, err := ctrl.NewManager(cfg, ctrl.Options{
+		Scheme:  s,
+		Cache:   cacheOpts,
+		Metrics: metricsserver.Options{BindAddress: "0"},
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := (&MyAppReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		return err
+	}
+
+	go func() {
+		if err := mgr.Start(ctx); err != nil {
+			fmt.Fprintf(os.Stderr, "manager exited with error: %v\n", err)
+			os.Exit(1)
+		}
+	}()
+	return nil
+}
+
+// requireEnvtest 在没有 envtest 环境时跳过集成测试
+func requireEnvtest(t *testing.T) {
+	t.Helper()
+	if testEnv == nil {
+		t.Skip("KUBEBUILDER_ASSETS is not set")
+	}
+}
+
+// createNamespace 为每个测试创建独立的命名空间
+func createNamespace(t *testing.T) string {
+	t.Helper()
+	ns := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{GenerateName: "myapp-test-"},
+	}
+	if err := k8sClient.Create(context.Background(), ns); err != nil {
+		t.Fatalf("failed to create namespace: %v", err)
+	}
+	return ns.Name
+}
+
+// eventually 反复执行 fn 直到其返回 nil 或超时
+func eventually(t *testing.T, fn func() error) {
+	t.Helper()
+	deadline := time.Now().Add(eventuallyTimeout)
+	for {
+		err := fn()
+		if err == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("condition not met within %s: %v", eventuallyTimeout, err)
+		}
+		time.Sleep(eventuallyInterval)
+	}
+}
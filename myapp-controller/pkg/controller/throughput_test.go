@@ -0,0 +1,156 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/config"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+
+	myappv1 "github.com/example/myapp-controller/pkg/apis/example/v1"
+)
+
+// BenchmarkReconcileThroughput 在独立的 envtest 环境中创建一批 MyApp，
+// 测量不同并发数下全部收敛（Service 已创建且状态已写入）所需的时间：
+//
+//	make loadtest
+//	MYAPP_LOADTEST_APPS=500 go test ./pkg/controller -run '^$' -bench ReconcileThroughput -benchtime 1x
+func BenchmarkReconcileThroughput(b *testing.B) {
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		b.Skip("KUBEBUILDER_ASSETS is not set")
+	}
+
+	apps := 100
+	if v := os.Getenv("MYAPP_LOADTEST_APPS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			b.Fatalf("invalid MYAPP_LOADTEST_APPS: %v", err)
+		}
+		apps = n
+	}
+
+	for _, workers := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			opts := DefaultOptions()
+			opts.MaxConcurrentReconciles = workers
+			// 放宽全局令牌桶，避免限速器掩盖并发数的影响
+			opts.QPS, opts.Burst = 1000, 10000
+			for i := 0; i < b.N; i++ {
+				elapsed := runThroughput(b, opts, apps)
+				b.ReportMetric(float64(apps)/elapsed.Seconds(), "myapps/s")
+			}
+		})
+	}
+}
+
+// runThroughput 启动新的 envtest 和 manager，返回 apps 个 MyApp 全部收敛所用的时间
+func runThroughput(b *testing.B, opts Options, apps int) time.Duration {
+	b.Helper()
+	b.StopTimer()
+
+	env := &envtest.Environment{
+		CRDDirectoryPaths:     []string{filepath.Join("..", "..", "config", "crd")},
+		ErrorIfCRDPathMissing: true,
+	}
+	restCfg, err := env.Start()
+	if err != nil {
+		b.Fatalf("failed to start envtest: %v", err)
+	}
+	defer func() { _ = env.Stop() }()
+
+	s := newTestScheme()
+	c, err := client.New(restCfg, client.Options{Scheme: s})
+	if err != nil {
+		b.Fatalf("failed to create client: %v", err)
+	}
+
+	mgr, err := ctrl.NewManager(restCfg, ctrl.Options{
+		Scheme:  s,
+		Metrics: metricsserver.Options{BindAddress: "0"},
+		// 同一进程中会多次创建同名控制器
+		Controller: config.Controller{SkipNameValidation: ptr.To(true)},
+	})
+	if err != nil {
+		b.Fatalf("failed to create manager: %v", err)
+	}
+	if err := (&MyAppReconciler{
+		Client:  mgr.GetClient(),
+		Scheme:  mgr.GetScheme(),
+		Options: opts,
+	}).SetupWithManager(mgr); err != nil {
+		b.Fatalf("failed to set up reconciler: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = mgr.Start(ctx) }()
+	if !mgr.GetCache().WaitForCacheSync(ctx) {
+		b.Fatalf("cache did not sync")
+	}
+
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "loadtest"}}
+	if err := c.Create(ctx, ns); err != nil {
+		b.Fatalf("failed to create namespace: %v", err)
+	}
+
+	b.StartTimer()
+	start := time.Now()
+	for i := 0; i < apps; i++ {
+		if err := c.Create(ctx, newMyApp(ns.Name, fmt.Sprintf("app-%d", i), 1)); err != nil {
+			b.Fatalf("failed to create MyApp: %v", err)
+		}
+	}
+
+	deadline := start.Add(5 * time.Minute)
+	for {
+		converged, err := countConverged(ctx, c, ns.Name)
+		if err != nil {
+			b.Fatalf("failed to list objects: %v", err)
+		}
+		if converged == apps {
+			break
+		}
+		if time.Now().After(deadline) {
+			b.Fatalf("only %d/%d MyApps converged", converged, apps)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	elapsed := time.Since(start)
+	b.StopTimer()
+	return elapsed
+}
+
+// countConverged 统计已创建 Service 且已写入状态的 MyApp 数量
+func countConverged(ctx context.Context, c client.Client, namespace string) (int, error) {
+	list := &myappv1.MyAppList{}
+	if err := c.List(ctx, list, client.InNamespace(namespace)); err != nil {
+		return 0, err
+	}
+	services := &corev1.ServiceList{}
+	if err := c.List(ctx, services, client.InNamespace(namespace)); err != nil {
+		return 0, err
+	}
+	hasService := make(map[string]bool, len(services.Items))
+	for _, svc := range services.Items {
+		hasService[svc.Name] = true
+	}
+
+	converged := 0
+	for _, app := range list.Items {
+		if hasService[app.Name+"-service"] && app.Status.Phase != "" {
+			converged++
+		}
+	}
+	return converged, nil
+}
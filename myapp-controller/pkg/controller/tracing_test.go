@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr/funcr"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/example/myapp-controller/pkg/tracing"
+)
+
+// useSpanRecorder 在测试期间将全局 TracerProvider 替换为记录到内存的 provider
+func useSpanRecorder(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+// spanAttributes 将 span 的属性转换为 map
+func spanAttributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func TestReconcileTracing(t *testing.T) {
+	recorder := useSpanRecorder(t)
+
+	app := newMyApp("default", "web", 2)
+	app.Generation = 3
+	key := client.ObjectKeyFromObject(app)
+	h := newFakeHarness(t, app)
+	h.reconciler.Client = tracing.WrapClient(h.client)
+
+	var logs []string
+	logger := funcr.New(func(prefix, args string) { logs = append(logs, args) }, funcr.Options{})
+	ctx := log.IntoContext(context.Background(), logger)
+	if _, err := h.reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+
+	var root sdktrace.ReadOnlySpan
+	children := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		if span.Name() == "Reconcile MyApp" {
+			root = span
+		} else {
+			children[span.Name()] = span
+		}
+	}
+	if root == nil {
+		t.Fatalf("no reconcile span recorded")
+	}
+
+	attrs := spanAttributes(root)
+	if attrs["myapp.namespace"].AsString() != "default" || attrs["myapp.name"].AsString() != "web" || attrs["myapp.generation"].AsInt64() != 3 {
+		t.Errorf("unexpected reconcile span attributes: %v", attrs)
+	}
+
+	for _, name := range []string{"Get MyApp", "Get Deployment", "Create Deployment", "Get Service", "Create Service", "Status.Patch MyApp"} {
+		span, ok := children[name]
+		if !ok {
+			t.Errorf("missing span %q, got %v", name, recorder.Ended())
+			continue
+		}
+		if span.Parent().SpanID() != root.SpanContext().SpanID() {
+			t.Errorf("span %q is not a child of the reconcile span", name)
+		}
+	}
+	if span, ok := children["Get Deployment"]; ok {
+		if !spanAttributes(span)["k8s.not_found"].AsBool() || span.Status().Code != codes.Unset {
+			t.Errorf("NotFound should be recorded as an attribute, not as an error: %v", span.Status())
+		}
+	}
+
+	traceID := root.SpanContext().TraceID().String()
+	found := false
+	for _, line := range logs {
+		if strings.Contains(line, "Created Deployment") {
+			found = strings.Contains(line, traceID)
+		}
+	}
+	if !found {
+		t.Errorf("trace ID %s not found in reconcile logs: %v", traceID, logs)
+	}
+}
@@ -0,0 +1,73 @@
+package debug
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// CacheEntry 是缓存中一种资源的对象数量
+type CacheEntry struct {
+	Group   string `json:"group"`
+	Version string `json:"version"`
+	Kind    string `json:"kind"`
+	Count   int    `json:"count"`
+}
+
+// CacheStatus 是 /debug/cache 的响应
+type CacheStatus struct {
+	Objects []CacheEntry `json:"objects"`
+	// Total 所有资源的对象总数
+	Total int `json:"total"`
+}
+
+// CacheHandler 返回 /debug/cache 的 handler，统计 lists 中每种资源在 reader（通常是 manager 的缓存）中的对象数量。
+//
+// 只统计控制器 watch 的资源：从缓存读取未被 watch 的资源会启动新的 informer，反而增加内存。
+// 控制器在成为 leader 之后才会启动 informer，因此 elected 关闭前返回 503。
+func CacheHandler(reader client.Reader, scheme *runtime.Scheme, elected <-chan struct{}, lists ...client.ObjectList) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-elected:
+		default:
+			writeError(w, http.StatusServiceUnavailable, "not the leader, informers are not started")
+			return
+		}
+
+		status := CacheStatus{Objects: make([]CacheEntry, 0, len(lists))}
+		for _, list := range lists {
+			gvk, err := apiutil.GVKForObject(list, scheme)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			// 每次使用新的列表对象，避免并发请求共享同一个列表；不深拷贝缓存中的对象
+			l := list.DeepCopyObject().(client.ObjectList)
+			if err := reader.List(r.Context(), l, client.UnsafeDisableDeepCopy); err != nil {
+				writeError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			count := meta.LenList(l)
+			status.Objects = append(status.Objects, CacheEntry{
+				Group:   gvk.Group,
+				Version: gvk.Version,
+				Kind:    strings.TrimSuffix(gvk.Kind, "List"),
+				Count:   count,
+			})
+			status.Total += count
+		}
+		sort.Slice(status.Objects, func(i, j int) bool {
+			a, b := status.Objects[i], status.Objects[j]
+			if a.Group != b.Group {
+				return a.Group < b.Group
+			}
+			return a.Kind < b.Kind
+		})
+		writeJSON(w, http.StatusOK, status)
+	})
+}
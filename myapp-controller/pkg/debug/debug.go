@@ -0,0 +1,34 @@
+// Package debug 提供排查控制器内存和积压问题的诊断端点：
+//   - /debug/cache 列出 informer 缓存中每种资源的对象数量
+//   - /debug/queue 显示工作队列深度和等待最久的 MyApp
+//
+// 这些端点注册在 metrics server 上，开启 --metrics-secure 时与 /metrics 一样需要认证和鉴权，
+// 访问者需要：
+//   - nonResourceURLs: /debug/*, verbs: get
+package debug
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+const (
+	// CachePath 是缓存诊断端点的路径
+	CachePath = "/debug/cache"
+	// QueuePath 是工作队列诊断端点的路径
+	QueuePath = "/debug/queue"
+)
+
+// writeJSON 以缩进的 JSON 格式返回 v
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
+
+// writeError 以 {"error": "..."} 的格式返回错误
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
@@ -0,0 +1,120 @@
+package debug
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func get(t *testing.T, h http.Handler, out any) int {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if out != nil && rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("failed to decode response %q: %v", rec.Body.String(), err)
+		}
+	}
+	return rec.Code
+}
+
+func TestCacheHandler(t *testing.T) {
+	s := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	c := fake.NewClientBuilder().WithScheme(s).WithObjects(
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "a"}},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: "other", Name: "b"}},
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "a"}},
+	).Build()
+
+	elected := make(chan struct{})
+	h := CacheHandler(c, s, elected, &corev1.ServiceList{}, &appsv1.DeploymentList{})
+	if code := get(t, h, nil); code != http.StatusServiceUnavailable {
+		t.Fatalf("status before election = %d, want %d", code, http.StatusServiceUnavailable)
+	}
+
+	close(elected)
+	var status CacheStatus
+	if code := get(t, h, &status); code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", code, http.StatusOK)
+	}
+	want := []CacheEntry{
+		{Group: "", Version: "v1", Kind: "Service", Count: 1},
+		{Group: "apps", Version: "v1", Kind: "Deployment", Count: 2},
+	}
+	if len(status.Objects) != len(want) {
+		t.Fatalf("objects = %+v, want %+v", status.Objects, want)
+	}
+	for i := range want {
+		if status.Objects[i] != want[i] {
+			t.Errorf("objects[%d] = %+v, want %+v", i, status.Objects[i], want[i])
+		}
+	}
+	if status.Total != 3 {
+		t.Errorf("total = %d, want 3", status.Total)
+	}
+}
+
+func TestQueueTracker(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tracker := NewQueueTracker()
+	tracker.now = func() time.Time { return now }
+	h := QueueHandler(tracker)
+
+	if code := get(t, h, nil); code != http.StatusServiceUnavailable {
+		t.Fatalf("status before start = %d, want %d", code, http.StatusServiceUnavailable)
+	}
+
+	q := tracker.NewQueue("myapp", workqueue.DefaultTypedControllerRateLimiter[reconcile.Request]())
+	defer q.ShutDown()
+	first := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "first"}}
+	second := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "second"}}
+	delayed := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "delayed"}}
+
+	q.Add(first)
+	now = now.Add(time.Second)
+	q.Add(second)
+	// 重复入队不会更新等待时间
+	q.Add(first)
+	q.AddAfter(delayed, time.Hour)
+	now = now.Add(time.Second)
+
+	var status QueueStatus
+	if code := get(t, h, &status); code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", code, http.StatusOK)
+	}
+	if status.Name != "myapp" || status.Depth != 2 || status.Delayed != 1 {
+		t.Fatalf("status = %+v, want name myapp, depth 2, delayed 1", status)
+	}
+	if status.Oldest == nil || status.Oldest.Name != "first" || status.Oldest.Age != "2s" {
+		t.Fatalf("oldest = %+v, want first waiting for 2s", status.Oldest)
+	}
+
+	item, _ := q.Get()
+	q.Done(item)
+	status, _ = tracker.Status()
+	if status.Depth != 1 || status.Oldest == nil || status.Oldest.Name != "second" || status.Oldest.Age != "1s" {
+		t.Fatalf("status after Get = %+v, want second waiting for 1s", status)
+	}
+
+	item, _ = q.Get()
+	q.Done(item)
+	status, _ = tracker.Status()
+	if status.Depth != 0 || status.Oldest != nil || status.Delayed != 1 {
+		t.Fatalf("status after draining = %+v, want an empty queue with one delayed item", status)
+	}
+}
@@ -0,0 +1,168 @@
+package debug
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// PendingItem 是队列中等待处理的一个对象
+type PendingItem struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// Since 对象可以被处理的时间，延迟入队的对象从延迟结束时算起
+	Since time.Time `json:"since"`
+	// Age 对象已经等待的时间
+	Age string `json:"age"`
+}
+
+// QueueStatus 是 /debug/queue 的响应
+type QueueStatus struct {
+	Name string `json:"name"`
+	// Depth 可以立即处理的对象数量，与 workqueue_depth 指标一致
+	Depth int `json:"depth"`
+	// Delayed 因退避或 RequeueAfter 尚未到期的对象数量
+	Delayed int `json:"delayed"`
+	// Oldest 等待最久的对象，队列为空时为 nil
+	Oldest *PendingItem `json:"oldest,omitempty"`
+}
+
+// QueueTracker 记录控制器工作队列中每个对象的入队时间。
+// 将 NewQueue 设置为 controller.Options.NewQueue 后即可通过 Status 查询队列状态。
+type QueueTracker struct {
+	mu    sync.Mutex
+	queue *trackingQueue
+	now   func() time.Time
+}
+
+// NewQueueTracker 创建 QueueTracker
+func NewQueueTracker() *QueueTracker {
+	return &QueueTracker{now: time.Now}
+}
+
+// NewQueue 构造与 controller-runtime 默认实现相同的限速队列，并记录每个对象的入队时间。
+// 签名与 controller.Options.NewQueue 一致，控制器启动时调用。
+func (t *QueueTracker) NewQueue(name string, rateLimiter workqueue.TypedRateLimiter[reconcile.Request]) workqueue.TypedRateLimitingInterface[reconcile.Request] {
+	q := &trackingQueue{
+		TypedRateLimitingInterface: workqueue.NewTypedRateLimitingQueueWithConfig(rateLimiter,
+			workqueue.TypedRateLimitingQueueConfig[reconcile.Request]{Name: name}),
+		name:        name,
+		rateLimiter: rateLimiter,
+		now:         t.now,
+		pending:     map[reconcile.Request]time.Time{},
+	}
+	t.mu.Lock()
+	t.queue = q
+	t.mu.Unlock()
+	return q
+}
+
+// Status 返回队列当前的状态，控制器尚未启动时第二个返回值为 false
+func (t *QueueTracker) Status() (QueueStatus, bool) {
+	t.mu.Lock()
+	q := t.queue
+	t.mu.Unlock()
+	if q == nil {
+		return QueueStatus{}, false
+	}
+	return q.status(), true
+}
+
+// QueueHandler 返回 /debug/queue 的 handler。
+// 控制器在成为 leader 之后才会创建队列，此前返回 503。
+func QueueHandler(tracker *QueueTracker) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		status, ok := tracker.Status()
+		if !ok {
+			writeError(w, http.StatusServiceUnavailable, "controller is not started")
+			return
+		}
+		writeJSON(w, http.StatusOK, status)
+	})
+}
+
+// trackingQueue 包装限速队列，记录每个对象可以被处理的时间，对象被 Get 取出后删除记录。
+//
+// 底层的延迟队列在延迟到期时直接调用内部的 Add，不经过这里，
+// 因此 AddAfter 和 AddRateLimited 在入队时就按到期时间记录。
+type trackingQueue struct {
+	workqueue.TypedRateLimitingInterface[reconcile.Request]
+
+	name        string
+	rateLimiter workqueue.TypedRateLimiter[reconcile.Request]
+	now         func() time.Time
+
+	mu      sync.Mutex
+	pending map[reconcile.Request]time.Time
+}
+
+func (q *trackingQueue) Add(item reconcile.Request) {
+	q.track(item, q.now())
+	q.TypedRateLimitingInterface.Add(item)
+}
+
+func (q *trackingQueue) AddAfter(item reconcile.Request, duration time.Duration) {
+	if duration <= 0 {
+		q.Add(item)
+		return
+	}
+	q.track(item, q.now().Add(duration))
+	q.TypedRateLimitingInterface.AddAfter(item, duration)
+}
+
+// AddRateLimited 与底层实现相同：由限速器计算延迟后调用 AddAfter。
+// 限速器与底层队列共享，NumRequeues 和 Forget 仍然有效。
+func (q *trackingQueue) AddRateLimited(item reconcile.Request) {
+	q.AddAfter(item, q.rateLimiter.When(item))
+}
+
+func (q *trackingQueue) Get() (reconcile.Request, bool) {
+	item, shutdown := q.TypedRateLimitingInterface.Get()
+	if !shutdown {
+		q.mu.Lock()
+		delete(q.pending, item)
+		q.mu.Unlock()
+	}
+	return item, shutdown
+}
+
+// track 记录对象可以被处理的时间。对象已在队列中时保留较早的时间，与队列的去重行为一致。
+func (q *trackingQueue) track(item reconcile.Request, at time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if existing, ok := q.pending[item]; ok && !at.Before(existing) {
+		return
+	}
+	q.pending[item] = at
+}
+
+func (q *trackingQueue) status() QueueStatus {
+	now := q.now()
+	status := QueueStatus{Name: q.name, Depth: q.Len()}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var oldest *reconcile.Request
+	var oldestAt time.Time
+	for item, at := range q.pending {
+		if at.After(now) {
+			status.Delayed++
+			continue
+		}
+		if oldest == nil || at.Before(oldestAt) {
+			oldest, oldestAt = &item, at
+		}
+	}
+	if oldest != nil {
+		status.Oldest = &PendingItem{
+			Namespace: oldest.Namespace,
+			Name:      oldest.Name,
+			Since:     oldestAt,
+			Age:       now.Sub(oldestAt).Round(time.Millisecond).String(),
+		}
+	}
+	return status
+}
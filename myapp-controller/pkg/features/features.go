@@ -0,0 +1,201 @@
+// Package features 定义 myapp-controller 的功能开关。
+//
+// 新行为先以 Alpha（默认关闭）引入，稳定后升级为 Beta（默认开启），
+// 最终成为 GA 并锁定为开启，下一个版本删除开关。
+package features
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// Feature 是功能开关的名称
+type Feature string
+
+// Stage 是功能的成熟度
+type Stage string
+
+const (
+	// Alpha 功能默认关闭，可能存在缺陷，随时可能被修改或删除
+	Alpha Stage = "ALPHA"
+	// Beta 功能默认开启，经过充分测试，仍可以关闭
+	Beta Stage = "BETA"
+	// GA 功能始终开启，不能关闭
+	GA Stage = "GA"
+)
+
+// FeatureSpec 描述一个功能开关的默认值和成熟度
+type FeatureSpec struct {
+	Default bool
+	Stage   Stage
+}
+
+const (
+	// ServerSideApply 使用 server-side apply 管理 Deployment 和 Service，
+	// 只声明控制器关心的字段，不会覆盖其他控制器（例如 HPA）设置的字段
+	ServerSideApply Feature = "ServerSideApply"
+	// MyAppSet 启用 MyAppSet 控制器，根据生成器为多个租户生成 MyApp。
+	// 需要安装 MyAppSet CRD 并授予控制器集群级别的 myappsets 和 namespaces 权限
+	MyAppSet Feature = "MyAppSet"
+	// MyAppClass 为 MyApp 应用 spec.className 或默认 MyAppClass 中的默认值和限制。
+	// 需要安装 MyAppClass CRD 并授予控制器集群级别的 myappclasses 读取权限
+	MyAppClass Feature = "MyAppClass"
+	// MyAppPolicy 检查 MyApp 是否满足其命名空间中 MyAppPolicy 的规则。
+	// 需要安装 MyAppPolicy CRD 并授予控制器 myapppolicies 的读取权限
+	MyAppPolicy Feature = "MyAppPolicy"
+)
+
+// defaultFeatures 是所有已知的功能开关
+var defaultFeatures = map[Feature]FeatureSpec{
+	ServerSideApply: {Default: false, Stage: Alpha},
+	MyAppSet:        {Default: false, Stage: Alpha},
+	MyAppClass:      {Default: false, Stage: Alpha},
+	MyAppPolicy:     {Default: false, Stage: Alpha},
+}
+
+// featureEnabled 表示每个功能开关是否开启，开启为 1
+var featureEnabled = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "myapp_feature_enabled",
+		Help: "功能开关是否开启 (1 表示开启)",
+	},
+	[]string{"name", "stage"},
+)
+
+func init() {
+	metrics.Registry.MustRegister(featureEnabled)
+}
+
+// FeatureGate 保存功能开关的当前值，可被多个 goroutine 并发读取。
+// nil 的 FeatureGate 对所有功能返回默认值。
+type FeatureGate struct {
+	mu      sync.RWMutex
+	known   map[Feature]FeatureSpec
+	enabled map[Feature]bool
+}
+
+// NewFeatureGate 返回使用默认值的 FeatureGate
+func NewFeatureGate() *FeatureGate {
+	return &FeatureGate{
+		known:   defaultFeatures,
+		enabled: map[Feature]bool{},
+	}
+}
+
+// Enabled 返回功能是否开启，未知的功能始终关闭
+func (g *FeatureGate) Enabled(f Feature) bool {
+	if g == nil {
+		return defaultFeatures[f].Default
+	}
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if v, ok := g.enabled[f]; ok {
+		return v
+	}
+	return g.known[f].Default
+}
+
+// SetFromMap 设置功能开关，任一开关未知或试图关闭 GA 功能时返回错误且不做任何修改
+func (g *FeatureGate) SetFromMap(values map[string]bool) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for name, v := range values {
+		spec, ok := g.known[Feature(name)]
+		if !ok {
+			return fmt.Errorf("unrecognized feature gate %q, known gates are: %s", name, strings.Join(g.knownNames(), ", "))
+		}
+		if spec.Stage == GA && !v {
+			return fmt.Errorf("cannot disable feature gate %q, the feature is GA and always enabled", name)
+		}
+	}
+	for name, v := range values {
+		g.enabled[Feature(name)] = v
+	}
+	return nil
+}
+
+// Snapshot 返回所有已知功能开关的当前值
+func (g *FeatureGate) Snapshot() map[string]bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	out := make(map[string]bool, len(g.known))
+	for f, spec := range g.known {
+		v, ok := g.enabled[f]
+		if !ok {
+			v = spec.Default
+		}
+		out[string(f)] = v
+	}
+	return out
+}
+
+// String 以 "A=true,B=false" 的格式返回所有功能开关的当前值
+func (g *FeatureGate) String() string {
+	snapshot := g.Snapshot()
+	pairs := make([]string, 0, len(snapshot))
+	for name, v := range snapshot {
+		pairs = append(pairs, fmt.Sprintf("%s=%t", name, v))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// RecordMetrics 将所有功能开关的当前值写入 myapp_feature_enabled 指标
+func (g *FeatureGate) RecordMetrics() {
+	for name, v := range g.Snapshot() {
+		value := 0.0
+		if v {
+			value = 1
+		}
+		featureEnabled.WithLabelValues(name, string(g.known[Feature(name)].Stage)).Set(value)
+	}
+}
+
+// KnownFeatures 返回所有已知功能开关的说明，用于命令行帮助
+func (g *FeatureGate) KnownFeatures() []string {
+	var out []string
+	for _, name := range g.knownNames() {
+		spec := g.known[Feature(name)]
+		out = append(out, fmt.Sprintf("%s=true|false (%s - default=%t)", name, spec.Stage, spec.Default))
+	}
+	return out
+}
+
+// knownNames 返回排序后的所有已知功能名称
+func (g *FeatureGate) knownNames() []string {
+	names := make([]string, 0, len(g.known))
+	for f := range g.known {
+		names = append(names, string(f))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseFeatureGates 解析 "A=true,B=false" 格式的功能开关列表
+func ParseFeatureGates(value string) (map[string]bool, error) {
+	out := map[string]bool{}
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, raw, found := strings.Cut(pair, "=")
+		if !found {
+			return nil, fmt.Errorf("missing bool value for feature gate %q", name)
+		}
+		v, err := strconv.ParseBool(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q for feature gate %q", raw, name)
+		}
+		out[strings.TrimSpace(name)] = v
+	}
+	return out, nil
+}
@@ -0,0 +1,110 @@
+package features
+
+import (
+	"testing"
+
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// newTestGate 返回包含各个阶段功能的 FeatureGate
+func newTestGate() *FeatureGate {
+	g := NewFeatureGate()
+	g.known = map[Feature]FeatureSpec{
+		"AlphaFeature": {Default: false, Stage: Alpha},
+		"BetaFeature":  {Default: true, Stage: Beta},
+		"GAFeature":    {Default: true, Stage: GA},
+	}
+	return g
+}
+
+func TestFeatureGateDefaults(t *testing.T) {
+	var nilGate *FeatureGate
+	if nilGate.Enabled(ServerSideApply) {
+		t.Errorf("nil gate enabled ServerSideApply, want default false")
+	}
+
+	g := newTestGate()
+	if g.Enabled("AlphaFeature") || !g.Enabled("BetaFeature") || !g.Enabled("GAFeature") {
+		t.Errorf("unexpected defaults: %s", g)
+	}
+	if g.Enabled("Unknown") {
+		t.Errorf("unknown feature is enabled")
+	}
+}
+
+func TestFeatureGateSetFromMap(t *testing.T) {
+	g := newTestGate()
+	if err := g.SetFromMap(map[string]bool{"AlphaFeature": true, "BetaFeature": false, "GAFeature": true}); err != nil {
+		t.Fatalf("SetFromMap() error = %v", err)
+	}
+	if got, want := g.String(), "AlphaFeature=true,BetaFeature=false,GAFeature=true"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	tests := []struct {
+		name   string
+		values map[string]bool
+	}{
+		{name: "unknown", values: map[string]bool{"AlphaFeature": false, "Unknown": true}},
+		{name: "disable GA", values: map[string]bool{"AlphaFeature": false, "GAFeature": false}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := g.SetFromMap(tc.values); err == nil {
+				t.Fatalf("SetFromMap() succeeded, want error")
+			}
+			// 出错时不做任何修改
+			if !g.Enabled("AlphaFeature") {
+				t.Errorf("failed SetFromMap() modified the gate")
+			}
+		})
+	}
+}
+
+func TestParseFeatureGates(t *testing.T) {
+	got, err := ParseFeatureGates(" A=true, B=false ,")
+	if err != nil {
+		t.Fatalf("ParseFeatureGates() error = %v", err)
+	}
+	if len(got) != 2 || !got["A"] || got["B"] {
+		t.Errorf("ParseFeatureGates() = %v", got)
+	}
+
+	for _, value := range []string{"A", "A=yes"} {
+		if _, err := ParseFeatureGates(value); err == nil {
+			t.Errorf("ParseFeatureGates(%q) succeeded, want error", value)
+		}
+	}
+}
+
+func TestFeatureGateRecordMetrics(t *testing.T) {
+	g := newTestGate()
+	if err := g.SetFromMap(map[string]bool{"AlphaFeature": true}); err != nil {
+		t.Fatal(err)
+	}
+	g.RecordMetrics()
+
+	families, err := metrics.Registry.Gather()
+	if err != nil {
+		t.Fatalf("failed to gather metrics: %v", err)
+	}
+	got := map[string]float64{}
+	for _, mf := range families {
+		if mf.GetName() != "myapp_feature_enabled" {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			labels := map[string]string{}
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			got[labels["name"]+"/"+labels["stage"]] = m.GetGauge().GetValue()
+		}
+	}
+	want := map[string]float64{"AlphaFeature/ALPHA": 1, "BetaFeature/BETA": 1, "GAFeature/GA": 1}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("myapp_feature_enabled{%s} = %v, want %v", k, got[k], v)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+// Package health 提供 manager 使用的健康检查。
+package health
+
+import (
+	"errors"
+	"net/http"
+
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+)
+
+// errNotLeader 表示当前实例处于备用状态
+var errNotLeader = errors.New("not the leader")
+
+// LeaderCheck 返回一个就绪检查：当前实例是 leader 时通过，否则失败。
+// elected 通常是 manager.Elected()，未开启选主时该 channel 会立即关闭。
+//
+// 备用实例本身是健康的，因此 Deployment 的 readinessProbe 应使用
+// /readyz?exclude=leader，而 /readyz/leader 用于查询当前实例是否为 leader。
+func LeaderCheck(elected <-chan struct{}) healthz.Checker {
+	return func(_ *http.Request) error {
+		select {
+		case <-elected:
+			return nil
+		default:
+			return errNotLeader
+		}
+	}
+}
@@ -0,0 +1,16 @@
+package health
+
+import "testing"
+
+func TestLeaderCheck(t *testing.T) {
+	elected := make(chan struct{})
+	check := LeaderCheck(elected)
+
+	if err := check(nil); err == nil {
+		t.Fatalf("check passed before the lease was acquired")
+	}
+	close(elected)
+	if err := check(nil); err != nil {
+		t.Fatalf("check failed after the lease was acquired: %v", err)
+	}
+}
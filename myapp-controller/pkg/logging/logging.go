@@ -0,0 +1,111 @@
+// Package logging 构造控制器使用的结构化日志：
+// 默认输出 JSON，对高频日志采样，并支持为单个对象临时提高日志详细程度。
+package logging
+
+import (
+	"github.com/go-logr/logr"
+	uberzap "go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+// 日志中使用的稳定键名，日志查询和告警依赖这些键，不要修改
+const (
+	// KeyMyApp MyApp 的名称
+	KeyMyApp = "myapp"
+	// KeyNamespace MyApp 所在的命名空间
+	KeyNamespace = "namespace"
+	// KeyGeneration MyApp 的 metadata.generation
+	KeyGeneration = "generation"
+	// KeyReconcileID 单次协调的 ID，由 controller-runtime 生成
+	KeyReconcileID = "reconcileID"
+	// KeyAction 本条日志对应的操作，例如 create、update、apply
+	KeyAction = "action"
+	// KeyResource 操作的资源类型，例如 Deployment、Service
+	KeyResource = "resource"
+	// KeyResult 操作或协调的结果
+	KeyResult = "result"
+)
+
+// Options 控制日志的输出
+type Options struct {
+	// Zap controller-runtime 的 zap 选项，通常来自 --zap-* 命令行参数
+	Zap zap.Options
+	// Level 日志级别，可以在运行时修改
+	Level uberzap.AtomicLevel
+	// SamplingInitial 每秒内相同级别和消息的日志先完整输出的条数，0 表示不采样
+	SamplingInitial int
+	// SamplingThereafter 超过 SamplingInitial 后每隔多少条输出一条
+	SamplingThereafter int
+}
+
+// New 构造日志。日志级别由 opts.Level 决定，但通过 WithVerbosity 提高了详细程度的 logger
+// 不受其限制，因此底层 zap core 允许所有级别，由 levelSink 负责过滤。
+func New(opts Options) logr.Logger {
+	zo := opts.Zap
+	zo.Level = zapcore.LevelEnabler(uberzap.LevelEnablerFunc(func(zapcore.Level) bool { return true }))
+	if opts.SamplingInitial > 0 {
+		zo.ZapOpts = append(zo.ZapOpts, uberzap.WrapCore(func(core zapcore.Core) zapcore.Core {
+			return newSampler(core, opts.SamplingInitial, opts.SamplingThereafter)
+		}))
+	}
+	base := zap.New(zap.UseFlagOptions(&zo))
+	return logr.New(&levelSink{sink: base.GetSink(), level: opts.Level})
+}
+
+// WithVerbosity 返回详细程度至少为 v 的 logger，不受全局日志级别限制。
+// 不是由 New 构造的 logger 原样返回。
+func WithVerbosity(logger logr.Logger, v int) logr.Logger {
+	s, ok := logger.GetSink().(*levelSink)
+	if !ok || v <= s.verbosity {
+		return logger
+	}
+	boosted := *s
+	boosted.verbosity = v
+	return logger.WithSink(&boosted)
+}
+
+// levelSink 根据全局日志级别和单个 logger 的详细程度过滤日志
+type levelSink struct {
+	sink      logr.LogSink
+	level     uberzap.AtomicLevel
+	verbosity int
+}
+
+var _ logr.CallDepthLogSink = &levelSink{}
+
+func (s *levelSink) Init(info logr.RuntimeInfo) {
+	// 底层 sink 已经按 logr.Logger 的调用深度初始化过，这里再加上 levelSink 自身这一层
+	s.sink.Init(info)
+}
+
+func (s *levelSink) Enabled(level int) bool {
+	if level <= s.verbosity {
+		return true
+	}
+	return s.level.Enabled(zapcore.Level(-level))
+}
+
+func (s *levelSink) Info(level int, msg string, keysAndValues ...interface{}) {
+	s.sink.Info(level, msg, keysAndValues...)
+}
+
+func (s *levelSink) Error(err error, msg string, keysAndValues ...interface{}) {
+	s.sink.Error(err, msg, keysAndValues...)
+}
+
+func (s *levelSink) WithValues(keysAndValues ...interface{}) logr.LogSink {
+	return &levelSink{sink: s.sink.WithValues(keysAndValues...), level: s.level, verbosity: s.verbosity}
+}
+
+func (s *levelSink) WithName(name string) logr.LogSink {
+	return &levelSink{sink: s.sink.WithName(name), level: s.level, verbosity: s.verbosity}
+}
+
+func (s *levelSink) WithCallDepth(depth int) logr.LogSink {
+	sink := s.sink
+	if withCallDepth, ok := sink.(logr.CallDepthLogSink); ok {
+		sink = withCallDepth.WithCallDepth(depth)
+	}
+	return &levelSink{sink: sink, level: s.level, verbosity: s.verbosity}
+}
@@ -0,0 +1,85 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	uberzap "go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+// newTestLogger 返回输出 JSON 到 buf 的生产模式 logger
+func newTestLogger(buf *bytes.Buffer, level zapcore.Level, initial, thereafter int) (Options, uberzap.AtomicLevel) {
+	atomic := uberzap.NewAtomicLevelAt(level)
+	return Options{
+		Zap:                zap.Options{DestWriter: buf},
+		Level:              atomic,
+		SamplingInitial:    initial,
+		SamplingThereafter: thereafter,
+	}, atomic
+}
+
+// entries 解析 buf 中的 JSON 日志
+func entries(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var out []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		entry := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("log line is not JSON: %q", line)
+		}
+		out = append(out, entry)
+	}
+	return out
+}
+
+func TestLevelAndVerbosity(t *testing.T) {
+	var buf bytes.Buffer
+	opts, level := newTestLogger(&buf, zapcore.InfoLevel, 0, 0)
+	logger := New(opts).WithValues(KeyMyApp, "web")
+
+	logger.V(1).Info("hidden")
+	WithVerbosity(logger, 1).V(1).Info("boosted")
+	WithVerbosity(logger, 1).V(2).Info("too verbose")
+	WithVerbosity(logger, 2).WithValues(KeyNamespace, "default").V(2).Info("boosted child")
+	level.SetLevel(zapcore.DebugLevel)
+	logger.V(1).Info("after reload")
+
+	var msgs []string
+	for _, e := range entries(t, &buf) {
+		msgs = append(msgs, e["msg"].(string))
+		if e[KeyMyApp] != "web" {
+			t.Errorf("entry %v lost the %s key", e, KeyMyApp)
+		}
+	}
+	if got, want := strings.Join(msgs, ","), "boosted,boosted child,after reload"; got != want {
+		t.Errorf("logged %q, want %q", got, want)
+	}
+}
+
+func TestSamplingOnlyAffectsDebugAndInfo(t *testing.T) {
+	var buf bytes.Buffer
+	opts, _ := newTestLogger(&buf, zapcore.InfoLevel, 2, 1000)
+	logger := New(opts)
+
+	for i := 0; i < 10; i++ {
+		logger.Info("hot path")
+		logger.Error(nil, "failure")
+		// 比 Debug 更详细的级别不经过采样器，不会越界
+		WithVerbosity(logger, 3).V(3).Info("very verbose")
+	}
+
+	counts := map[string]int{}
+	for _, e := range entries(t, &buf) {
+		counts[e["msg"].(string)]++
+	}
+	if counts["hot path"] != 2 || counts["failure"] != 10 || counts["very verbose"] != 10 {
+		t.Errorf("unexpected counts: %v", counts)
+	}
+}
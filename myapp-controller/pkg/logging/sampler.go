@@ -0,0 +1,35 @@
+package logging
+
+import (
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// samplingCore 只对 Debug 和 Info 级别的日志采样：
+//   - Warn 及以上级别的日志总是输出
+//   - zap 的采样器只支持 Debug 及以上级别，更详细的 V 级别日志（例如 V(2)）不经过采样器
+type samplingCore struct {
+	zapcore.Core
+	sampled zapcore.Core
+}
+
+// newSampler 返回对高频日志采样的 core：每秒内相同级别和消息的日志先输出 initial 条，
+// 之后每 thereafter 条输出一条
+func newSampler(core zapcore.Core, initial, thereafter int) zapcore.Core {
+	return &samplingCore{
+		Core:    core,
+		sampled: zapcore.NewSamplerWithOptions(core, time.Second, initial, thereafter),
+	}
+}
+
+func (c *samplingCore) With(fields []zapcore.Field) zapcore.Core {
+	return &samplingCore{Core: c.Core.With(fields), sampled: c.sampled.With(fields)}
+}
+
+func (c *samplingCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if ent.Level >= zapcore.DebugLevel && ent.Level <= zapcore.InfoLevel {
+		return c.sampled.Check(ent, ce)
+	}
+	return c.Core.Check(ent, ce)
+}
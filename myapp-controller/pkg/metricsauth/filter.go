@@ -0,0 +1,241 @@
+// Package metricsauth 为 manager 的 metrics server 提供基于 TokenReview 和
+// SubjectAccessReview 的认证与鉴权过滤器。
+//
+// 控制器需要以下权限：
+//   - apiGroups: authentication.k8s.io, resources: tokenreviews, verbs: create
+//   - apiGroups: authorization.k8s.io, resources: subjectaccessreviews, verbs: create
+//
+// 抓取指标的客户端（例如 Prometheus）需要：
+//   - nonResourceURLs: /metrics, verbs: get
+package metricsauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	authnv1 "k8s.io/api/authentication/v1"
+	authzv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	authenticationv1 "k8s.io/client-go/kubernetes/typed/authentication/v1"
+	authorizationv1 "k8s.io/client-go/kubernetes/typed/authorization/v1"
+	"k8s.io/client-go/rest"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+)
+
+const (
+	// 认证结果的缓存时间
+	tokenCacheTTL = time.Minute
+	// 鉴权通过的缓存时间
+	allowCacheTTL = 5 * time.Minute
+	// 鉴权拒绝的缓存时间
+	denyCacheTTL = 30 * time.Second
+	// 单次 TokenReview/SubjectAccessReview 请求的超时时间
+	reviewTimeout = 10 * time.Second
+)
+
+// WithAuthenticationAndAuthorization 返回一个 metricsserver.Filter，
+// 请求需携带 Bearer Token，并通过 kube-apiserver 完成认证和鉴权。
+func WithAuthenticationAndAuthorization(config *rest.Config, httpClient *http.Client) (metricsserver.Filter, error) {
+	authnClient, err := authenticationv1.NewForConfigAndClient(config, httpClient)
+	if err != nil {
+		return nil, err
+	}
+	authzClient, err := authorizationv1.NewForConfigAndClient(config, httpClient)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &delegatingAuth{
+		tokenReviews:         authnClient.TokenReviews(),
+		subjectAccessReviews: authzClient.SubjectAccessReviews(),
+		tokens:               newTTLCache[authnv1.UserInfo](),
+		decisions:            newTTLCache[bool](),
+		now:                  time.Now,
+	}
+	return d.filter, nil
+}
+
+// filter 是 metricsserver.Filter，请求通过认证和鉴权后才交给 handler
+func (d *delegatingAuth) filter(log logr.Logger, handler http.Handler) (http.Handler, error) {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx := req.Context()
+
+		user, ok, err := d.authenticate(ctx, req)
+		if err != nil {
+			log.Error(err, "Authentication failed")
+			http.Error(w, "Authentication failed", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			log.V(4).Info("Authentication failed")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		allowed, err := d.authorize(ctx, user, strings.ToLower(req.Method), req.URL.Path)
+		if err != nil {
+			msg := fmt.Sprintf("Authorization for user %s failed", user.Username)
+			log.Error(err, msg)
+			http.Error(w, msg, http.StatusInternalServerError)
+			return
+		}
+		if !allowed {
+			msg := fmt.Sprintf("Authorization denied for user %s", user.Username)
+			log.V(4).Info(msg)
+			http.Error(w, msg, http.StatusForbidden)
+			return
+		}
+
+		handler.ServeHTTP(w, req)
+	}), nil
+}
+
+// delegatingAuth 将认证和鉴权委托给 kube-apiserver，并缓存结果
+type delegatingAuth struct {
+	tokenReviews         authenticationv1.TokenReviewInterface
+	subjectAccessReviews authorizationv1.SubjectAccessReviewInterface
+
+	tokens    *ttlCache[authnv1.UserInfo]
+	decisions *ttlCache[bool]
+	now       func() time.Time
+}
+
+// authenticate 通过 TokenReview 校验请求中的 Bearer Token
+func (d *delegatingAuth) authenticate(ctx context.Context, req *http.Request) (authnv1.UserInfo, bool, error) {
+	token, ok := bearerToken(req)
+	if !ok {
+		return authnv1.UserInfo{}, false, nil
+	}
+
+	key := hashKey(token)
+	if user, found := d.tokens.get(key, d.now()); found {
+		return user, true, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, reviewTimeout)
+	defer cancel()
+
+	review, err := d.tokenReviews.Create(ctx, &authnv1.TokenReview{
+		Spec: authnv1.TokenReviewSpec{Token: token},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return authnv1.UserInfo{}, false, err
+	}
+	if !review.Status.Authenticated {
+		return authnv1.UserInfo{}, false, nil
+	}
+
+	d.tokens.set(key, review.Status.User, d.now(), tokenCacheTTL)
+	return review.Status.User, true, nil
+}
+
+// authorize 通过 SubjectAccessReview 检查用户是否可以访问给定的非资源路径
+func (d *delegatingAuth) authorize(ctx context.Context, user authnv1.UserInfo, verb, path string) (bool, error) {
+	groups := append([]string(nil), user.Groups...)
+	sort.Strings(groups)
+	key := hashKey(user.Username, user.UID, strings.Join(groups, ","), verb, path)
+	if allowed, found := d.decisions.get(key, d.now()); found {
+		return allowed, nil
+	}
+
+	extra := make(map[string]authzv1.ExtraValue, len(user.Extra))
+	for k, v := range user.Extra {
+		extra[k] = authzv1.ExtraValue(v)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, reviewTimeout)
+	defer cancel()
+
+	review, err := d.subjectAccessReviews.Create(ctx, &authzv1.SubjectAccessReview{
+		Spec: authzv1.SubjectAccessReviewSpec{
+			User:   user.Username,
+			UID:    user.UID,
+			Groups: user.Groups,
+			Extra:  extra,
+			NonResourceAttributes: &authzv1.NonResourceAttributes{
+				Path: path,
+				Verb: verb,
+			},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return false, err
+	}
+
+	ttl := denyCacheTTL
+	if review.Status.Allowed {
+		ttl = allowCacheTTL
+	}
+	d.decisions.set(key, review.Status.Allowed, d.now(), ttl)
+	return review.Status.Allowed, nil
+}
+
+// bearerToken 从 Authorization 头中取出 Bearer Token
+func bearerToken(req *http.Request) (string, bool) {
+	auth := strings.TrimSpace(req.Header.Get("Authorization"))
+	scheme, token, found := strings.Cut(auth, " ")
+	if !found || !strings.EqualFold(scheme, "bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// hashKey 生成缓存键，避免在内存中以明文保存 Token
+func hashKey(parts ...string) string {
+	h := sha256.New()
+	for _, p := range parts {
+		h.Write([]byte(p))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ttlCache 是一个带过期时间的简单缓存
+type ttlCache[V any] struct {
+	mu      sync.Mutex
+	entries map[string]ttlEntry[V]
+}
+
+type ttlEntry[V any] struct {
+	value   V
+	expires time.Time
+}
+
+func newTTLCache[V any]() *ttlCache[V] {
+	return &ttlCache[V]{entries: map[string]ttlEntry[V]{}}
+}
+
+func (c *ttlCache[V]) get(key string, now time.Time) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok || now.After(e.expires) {
+		delete(c.entries, key)
+		var zero V
+		return zero, false
+	}
+	return e.value, true
+}
+
+func (c *ttlCache[V]) set(key string, value V, now time.Time, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// 顺带清理过期条目，防止缓存无限增长
+	for k, e := range c.entries {
+		if now.After(e.expires) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = ttlEntry[V]{value: value, expires: now.Add(ttl)}
+}
@@ -0,0 +1,182 @@
+package metricsauth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	authnv1 "k8s.io/api/authentication/v1"
+	authzv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// fakeAPIServer 模拟 kube-apiserver 的 TokenReview 和 SubjectAccessReview，并统计调用次数
+type fakeAPIServer struct {
+	// tokens 是已认证的 Token 及其用户名
+	tokens map[string]string
+	// allowed 是允许访问的用户名
+	allowed map[string]bool
+	// tokenErr 和 accessErr 不为 nil 时对应的请求返回错误
+	tokenErr, accessErr error
+
+	tokenReviews, accessReviews int
+}
+
+// newTestAuth 返回使用 fakeAPIServer 的 delegatingAuth，当前时间由 now 指定
+func newTestAuth(api *fakeAPIServer, now *time.Time) *delegatingAuth {
+	clientset := fake.NewClientset()
+	clientset.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		api.tokenReviews++
+		if api.tokenErr != nil {
+			return true, nil, api.tokenErr
+		}
+		review := action.(k8stesting.CreateAction).GetObject().(*authnv1.TokenReview)
+		if user, ok := api.tokens[review.Spec.Token]; ok {
+			review.Status = authnv1.TokenReviewStatus{Authenticated: true, User: authnv1.UserInfo{Username: user}}
+		}
+		return true, review, nil
+	})
+	clientset.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		api.accessReviews++
+		if api.accessErr != nil {
+			return true, nil, api.accessErr
+		}
+		review := action.(k8stesting.CreateAction).GetObject().(*authzv1.SubjectAccessReview)
+		review.Status.Allowed = api.allowed[review.Spec.User] &&
+			review.Spec.NonResourceAttributes.Path == "/metrics" && review.Spec.NonResourceAttributes.Verb == "get"
+		return true, review, nil
+	})
+	return &delegatingAuth{
+		tokenReviews:         clientset.AuthenticationV1().TokenReviews(),
+		subjectAccessReviews: clientset.AuthorizationV1().SubjectAccessReviews(),
+		tokens:               newTTLCache[authnv1.UserInfo](),
+		decisions:            newTTLCache[bool](),
+		now:                  func() time.Time { return *now },
+	}
+}
+
+// serve 通过过滤器请求 /metrics，返回响应状态码
+func serve(t *testing.T, d *delegatingAuth, authorization string) int {
+	t.Helper()
+	handler, err := d.filter(logr.Discard(), http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	if err != nil {
+		t.Fatalf("failed to build filter: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestBearerToken(t *testing.T) {
+	tests := []struct {
+		header string
+		token  string
+		ok     bool
+	}{
+		{header: "Bearer abc", token: "abc", ok: true},
+		{header: "bearer  abc ", token: "abc", ok: true},
+		{header: "Basic abc", ok: false},
+		{header: "Bearer", ok: false},
+		{header: "Bearer   ", ok: false},
+		{header: "", ok: false},
+	}
+	for _, tc := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		req.Header.Set("Authorization", tc.header)
+		token, ok := bearerToken(req)
+		if token != tc.token || ok != tc.ok {
+			t.Errorf("bearerToken(%q) = %q, %v, want %q, %v", tc.header, token, ok, tc.token, tc.ok)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	now := time.Now()
+	api := &fakeAPIServer{
+		tokens:  map[string]string{"prometheus-token": "prometheus", "other-token": "other"},
+		allowed: map[string]bool{"prometheus": true},
+	}
+
+	tests := []struct {
+		name          string
+		authorization string
+		tokenErr      error
+		accessErr     error
+		want          int
+	}{
+		{name: "allowed", authorization: "Bearer prometheus-token", want: http.StatusOK},
+		{name: "no token", want: http.StatusUnauthorized},
+		{name: "unknown token", authorization: "Bearer unknown", want: http.StatusUnauthorized},
+		{name: "denied", authorization: "Bearer other-token", want: http.StatusForbidden},
+		{name: "token review error", authorization: "Bearer prometheus-token", tokenErr: errors.New("apiserver unavailable"), want: http.StatusInternalServerError},
+		{name: "access review error", authorization: "Bearer prometheus-token", accessErr: errors.New("apiserver unavailable"), want: http.StatusInternalServerError},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			api.tokenErr, api.accessErr = tc.tokenErr, tc.accessErr
+			// 每个用例使用新的缓存，避免前一个用例的结果被缓存
+			if got := serve(t, newTestAuth(api, &now), tc.authorization); got != tc.want {
+				t.Errorf("status = %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFilterCache(t *testing.T) {
+	now := time.Now()
+	api := &fakeAPIServer{
+		tokens:  map[string]string{"prometheus-token": "prometheus", "other-token": "other"},
+		allowed: map[string]bool{"prometheus": true},
+	}
+	d := newTestAuth(api, &now)
+
+	serve(t, d, "Bearer prometheus-token")
+	serve(t, d, "Bearer prometheus-token")
+	if api.tokenReviews != 1 || api.accessReviews != 1 {
+		t.Fatalf("reviews = %d/%d, want the second request to be served from the cache", api.tokenReviews, api.accessReviews)
+	}
+
+	// Token 的缓存过期后重新认证，鉴权结果仍在缓存中
+	now = now.Add(tokenCacheTTL + time.Second)
+	serve(t, d, "Bearer prometheus-token")
+	if api.tokenReviews != 2 || api.accessReviews != 1 {
+		t.Errorf("reviews = %d/%d, want only the token to be reviewed again", api.tokenReviews, api.accessReviews)
+	}
+	now = now.Add(allowCacheTTL)
+	serve(t, d, "Bearer prometheus-token")
+	if api.accessReviews != 2 {
+		t.Errorf("access reviews = %d, want the allow decision to expire", api.accessReviews)
+	}
+
+	// 拒绝的结果缓存时间更短，授权之后很快生效
+	if got := serve(t, d, "Bearer other-token"); got != http.StatusForbidden {
+		t.Fatalf("status = %d, want %d", got, http.StatusForbidden)
+	}
+	api.allowed["other"] = true
+	if got := serve(t, d, "Bearer other-token"); got != http.StatusForbidden {
+		t.Errorf("status = %d, want the cached denial", got)
+	}
+	now = now.Add(denyCacheTTL + time.Second)
+	if got := serve(t, d, "Bearer other-token"); got != http.StatusOK {
+		t.Errorf("status = %d, want the denial to expire", got)
+	}
+
+	// 认证失败的 Token 不缓存
+	before := api.tokenReviews
+	serve(t, d, "Bearer unknown")
+	serve(t, d, "Bearer unknown")
+	if api.tokenReviews != before+2 {
+		t.Errorf("token reviews = %d, want failed authentications not to be cached", api.tokenReviews-before)
+	}
+}
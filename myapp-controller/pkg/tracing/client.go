@@ -0,0 +1,161 @@
+package tracing
+
+import (
+	"context"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// tracingClient 为每个 API 调用创建一个子 span
+type tracingClient struct {
+	client.Client
+}
+
+// WrapClient 返回为每个 API 调用创建子 span 的 client
+func WrapClient(c client.Client) client.Client {
+	return &tracingClient{Client: c}
+}
+
+// startSpan 为一次 API 调用创建 span，span 名称形如 "Get Deployment" 或 "Status.Patch MyApp"
+func startSpan(ctx context.Context, c client.Client, verb string, obj runtime.Object, key client.ObjectKey) (context.Context, trace.Span) {
+	kind := "Unknown"
+	if gvk, err := c.GroupVersionKindFor(obj); err == nil {
+		kind = gvk.Kind
+	}
+	attrs := []attribute.KeyValue{
+		attribute.String("k8s.verb", verb),
+		attribute.String("k8s.kind", kind),
+	}
+	if key.Namespace != "" {
+		attrs = append(attrs, attribute.String("k8s.namespace", key.Namespace))
+	}
+	if key.Name != "" {
+		attrs = append(attrs, attribute.String("k8s.name", key.Name))
+	}
+	return Tracer().Start(ctx, verb+" "+kind, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+// endSpan 记录调用结果并结束 span。NotFound 是协调中预期的结果，不视为错误。
+func endSpan(span trace.Span, err error) {
+	switch {
+	case err == nil:
+	case apierrors.IsNotFound(err):
+		span.SetAttributes(attribute.Bool("k8s.not_found", true))
+	default:
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (c *tracingClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	ctx, span := startSpan(ctx, c.Client, "Get", obj, key)
+	err := c.Client.Get(ctx, key, obj, opts...)
+	endSpan(span, err)
+	return err
+}
+
+func (c *tracingClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	ctx, span := startSpan(ctx, c.Client, "List", list, client.ObjectKey{})
+	err := c.Client.List(ctx, list, opts...)
+	endSpan(span, err)
+	return err
+}
+
+func (c *tracingClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	ctx, span := startSpan(ctx, c.Client, "Create", obj, client.ObjectKeyFromObject(obj))
+	err := c.Client.Create(ctx, obj, opts...)
+	endSpan(span, err)
+	return err
+}
+
+func (c *tracingClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	ctx, span := startSpan(ctx, c.Client, "Delete", obj, client.ObjectKeyFromObject(obj))
+	err := c.Client.Delete(ctx, obj, opts...)
+	endSpan(span, err)
+	return err
+}
+
+func (c *tracingClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	ctx, span := startSpan(ctx, c.Client, "Update", obj, client.ObjectKeyFromObject(obj))
+	err := c.Client.Update(ctx, obj, opts...)
+	endSpan(span, err)
+	return err
+}
+
+func (c *tracingClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	ctx, span := startSpan(ctx, c.Client, "Patch", obj, client.ObjectKeyFromObject(obj))
+	span.SetAttributes(attribute.String("k8s.patch_type", string(patch.Type())))
+	err := c.Client.Patch(ctx, obj, patch, opts...)
+	endSpan(span, err)
+	return err
+}
+
+func (c *tracingClient) DeleteAllOf(ctx context.Context, obj client.Object, opts ...client.DeleteAllOfOption) error {
+	ctx, span := startSpan(ctx, c.Client, "DeleteAllOf", obj, client.ObjectKey{})
+	err := c.Client.DeleteAllOf(ctx, obj, opts...)
+	endSpan(span, err)
+	return err
+}
+
+func (c *tracingClient) Status() client.SubResourceWriter {
+	return c.SubResource("status")
+}
+
+func (c *tracingClient) SubResource(subResource string) client.SubResourceClient {
+	return &tracingSubResourceClient{
+		SubResourceClient: c.Client.SubResource(subResource),
+		client:            c.Client,
+		prefix:            subResourcePrefix(subResource),
+	}
+}
+
+// subResourcePrefix 返回子资源调用 span 名称的前缀，例如 status 对应 "Status."
+func subResourcePrefix(subResource string) string {
+	if subResource == "" {
+		return ""
+	}
+	return strings.ToUpper(subResource[:1]) + subResource[1:] + "."
+}
+
+// tracingSubResourceClient 为每个子资源 API 调用创建一个子 span
+type tracingSubResourceClient struct {
+	client.SubResourceClient
+	client client.Client
+	prefix string
+}
+
+func (c *tracingSubResourceClient) Get(ctx context.Context, obj client.Object, subResource client.Object, opts ...client.SubResourceGetOption) error {
+	ctx, span := startSpan(ctx, c.client, c.prefix+"Get", obj, client.ObjectKeyFromObject(obj))
+	err := c.SubResourceClient.Get(ctx, obj, subResource, opts...)
+	endSpan(span, err)
+	return err
+}
+
+func (c *tracingSubResourceClient) Create(ctx context.Context, obj client.Object, subResource client.Object, opts ...client.SubResourceCreateOption) error {
+	ctx, span := startSpan(ctx, c.client, c.prefix+"Create", obj, client.ObjectKeyFromObject(obj))
+	err := c.SubResourceClient.Create(ctx, obj, subResource, opts...)
+	endSpan(span, err)
+	return err
+}
+
+func (c *tracingSubResourceClient) Update(ctx context.Context, obj client.Object, opts ...client.SubResourceUpdateOption) error {
+	ctx, span := startSpan(ctx, c.client, c.prefix+"Update", obj, client.ObjectKeyFromObject(obj))
+	err := c.SubResourceClient.Update(ctx, obj, opts...)
+	endSpan(span, err)
+	return err
+}
+
+func (c *tracingSubResourceClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+	ctx, span := startSpan(ctx, c.client, c.prefix+"Patch", obj, client.ObjectKeyFromObject(obj))
+	span.SetAttributes(attribute.String("k8s.patch_type", string(patch.Type())))
+	err := c.SubResourceClient.Patch(ctx, obj, patch, opts...)
+	endSpan(span, err)
+	return err
+}
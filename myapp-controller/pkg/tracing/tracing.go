@@ -0,0 +1,77 @@
+// Package tracing 为控制器提供 OpenTelemetry 链路追踪：
+// 每次 Reconcile 是一个 span，其中的每个 API 调用是它的子 span。
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName 是控制器创建 span 时使用的 tracer 名称
+const instrumentationName = "github.com/example/myapp-controller"
+
+// Options 控制追踪数据的导出
+type Options struct {
+	// Endpoint OTLP gRPC 接收端地址，例如 otel-collector.observability:4317
+	Endpoint string
+	// Insecure 是否使用明文连接接收端
+	Insecure bool
+	// SamplingRatio 新建 trace 的采样比例，0 到 1 之间
+	SamplingRatio float64
+	// ServiceName 上报的服务名
+	ServiceName string
+}
+
+// Setup 创建通过 OTLP 导出的 TracerProvider 并设置为全局 provider。
+// 返回的函数在退出前调用，用于导出尚未发送的 span。
+func Setup(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	exporterOpts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(opts.Endpoint)}
+	if opts.Insecure {
+		exporterOpts = append(exporterOpts, otlptracegrpc.WithInsecure())
+	}
+	exporter, err := otlptracegrpc.New(ctx, exporterOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP trace exporter: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(opts.ServiceName),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SamplingRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider.Shutdown, nil
+}
+
+// Tracer 返回控制器使用的 tracer，未调用 Setup 时所有 span 都不会被记录
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// WithTraceIDs 在 span 被采样时为 logger 加上 traceID 和 spanID，
+// 以便从日志跳转到对应的 trace
+func WithTraceIDs(logger logr.Logger, span trace.Span) logr.Logger {
+	sc := span.SpanContext()
+	if !sc.IsValid() {
+		return logger
+	}
+	return logger.WithValues("traceID", sc.TraceID().String(), "spanID", sc.SpanID().String())
+}